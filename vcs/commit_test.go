@@ -0,0 +1,25 @@
+package vcs_test
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestCommit_IsMerge(t *testing.T) {
+	tests := map[string]struct {
+		parents []vcs.CommitID
+		want    bool
+	}{
+		"root":    {parents: nil, want: false},
+		"linear":  {parents: []vcs.CommitID{"a"}, want: false},
+		"merge":   {parents: []vcs.CommitID{"a", "b"}, want: true},
+		"octopus": {parents: []vcs.CommitID{"a", "b", "c"}, want: true},
+	}
+	for label, test := range tests {
+		c := &vcs.Commit{Parents: test.parents}
+		if got := c.IsMerge(); got != test.want {
+			t.Errorf("%s: got IsMerge %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -71,9 +71,18 @@ func TestRepository_Diff(t *testing.T) {
 				Raw: "diff --git .hgtags .hgtags\nnew file mode 100644\n--- /dev/null\n+++ .hgtags\n@@ -0,0 +1,1 @@\n+%(baseCommitID) testbase\ndiff --git f f\n--- f\n+++ f\n@@ -1,1 +1,2 @@\n line1\n+line2\n",
 			},
 		},
+		"git cmd word diff": {
+			repo: makeGitRepositoryCmd(t, gitCommands...),
+			base: "testbase", head: "testhead",
+			opt: &vcs.DiffOptions{WordDiff: true},
+			wantDiff: &vcs.Diff{
+				Raw: "diff --git f f\nindex a29bdeb434d874c9b1d8969c40c42161b03fafdc..c0d0fb45c382919737f8d0c20aaf57cf89b74af8 100644\n--- f\n+++ f\n@@ -1 +1,2 @@\nline1\n{+line2+}\n",
+			},
+		},
 	}
 
-	// TODO(sqs): implement diff for hg native
+	// The native hg Diff is tested in package hg, which doesn't need
+	// the hg command.
 
 	for label, test := range tests {
 		if strings.HasPrefix(label, "hg ") {
@@ -179,8 +188,6 @@ func TestRepository_Diff_rename(t *testing.T) {
 		},
 	}
 
-	// TODO(sqs): implement diff for hg native
-
 	for label, test := range tests {
 		if strings.HasPrefix(label, "hg ") {
 			continue // hg broken, see issue #104.
@@ -279,7 +286,7 @@ func TestRepository_CrossRepoDiff_git(t *testing.T) {
 		},
 	}
 
-	// TODO(sqs): implement diff for hg native
+	// TODO(sqs): implement cross-repo diff for hg
 
 	for label, test := range tests {
 		baseCommitID, err := test.baseRepo.ResolveRevision(test.base)
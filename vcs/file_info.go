@@ -21,3 +21,12 @@ type SymlinkInfo struct {
 	// Dest is the path that the symlink points to.
 	Dest string
 }
+
+// LastCommitInfo holds information about the commit that last
+// modified a file and is returned in the FileInfo's Sys field by
+// ReadDir calls on FileSystems that support it (see the hg package's
+// Repository.ReadDirLastCommits).
+type LastCommitInfo struct {
+	// CommitID is the ID of the commit that last modified the file.
+	CommitID
+}
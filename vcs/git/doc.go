@@ -1,6 +1,14 @@
 // Package git implements a git backend for the vcs interface.
 //
-// This package aims to be a pure-Go implementation, but it's currently using a fallback to
-// the gitcmd backend for some of the missing features. See repo_fallback.go
-// for the list of fallback functions.
+// This package aims to be a pure-Go implementation, like the hg
+// package's native backend. Revision, branch, and tag resolution
+// (including dereferencing annotated tags), tag listings, GetCommit,
+// commit logs, and FileSystems (including symlink modes and
+// vcs.SymlinkReader) read git objects directly, but it's currently
+// using a fallback to the gitcmd backend (which shells out to git)
+// for the remaining features:
+//
+//   - Commit logs limited to a path (which need `git log --follow`'s
+//     rename detection) or given revision specs other than commit IDs.
+//   - Branch listings, diffs, and blame.
 package git
@@ -0,0 +1,167 @@
+package git
+
+import (
+	"container/heap"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-git"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// isCommitID reports whether id is a full (40-character hex) commit
+// ID, as opposed to another revision spec such as a branch name.
+func isCommitID(id vcs.CommitID) bool {
+	if len(id) != 40 {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// A logWalker walks the history of a commit in `git log` order: like
+// git, it keeps a queue of commits ordered by committer date and
+// repeatedly shows the newest one and queues its parents, so a commit
+// is shown after its children unless their dates are skewed.
+//
+// Hidden commits are walked along with the others, hiding their
+// parents as they go, and the walk ends once only hidden commits are
+// queued. As in git, a commit whose date is skewed ahead of a hidden
+// descendant's may be shown before the walk learns it is hidden.
+type logWalker struct {
+	queue       commitQueue
+	seen        map[string]bool // commits that have been queued
+	queued      map[string]bool // commits that are still queued
+	hidden      map[string]bool // commits reachable from a hidden commit
+	interesting int             // the number of queued commits that aren't hidden
+	n           int             // the number of commits queued so far
+}
+
+func newLogWalker(head *git.Commit) *logWalker {
+	w := &logWalker{seen: map[string]bool{}, queued: map[string]bool{}, hidden: map[string]bool{}}
+	w.push(head)
+	return w
+}
+
+func (w *logWalker) push(c *git.Commit) {
+	id := c.Id.String()
+	w.seen[id] = true
+	w.queued[id] = true
+	if !w.hidden[id] {
+		w.interesting++
+	}
+	heap.Push(&w.queue, queuedCommit{c, commitDate(c), w.n})
+	w.n++
+}
+
+// hide excludes c and its ancestors from the walk, like the "^c" in
+// `git log ^c head`.
+func (w *logWalker) hide(c *git.Commit) error {
+	if err := w.markHidden(c); err != nil {
+		return err
+	}
+	if !w.seen[c.Id.String()] {
+		w.push(c)
+	}
+	return nil
+}
+
+// markHidden marks c as hidden. If c has already been walked, its
+// parents (which it queued) are marked hidden too.
+func (w *logWalker) markHidden(c *git.Commit) error {
+	id := c.Id.String()
+	if w.hidden[id] {
+		return nil
+	}
+	w.hidden[id] = true
+	if w.queued[id] {
+		w.interesting--
+		return nil
+	}
+	if !w.seen[id] {
+		return nil
+	}
+	for i, n := 0, c.ParentCount(); i < n; i++ {
+		p, err := c.Parent(i)
+		if err != nil {
+			return err
+		}
+		if err := w.markHidden(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next returns the next commit of the walk, or nil if there are no
+// more.
+func (w *logWalker) next() (*git.Commit, error) {
+	for w.interesting > 0 {
+		c := heap.Pop(&w.queue).(queuedCommit).Commit
+		id := c.Id.String()
+		delete(w.queued, id)
+		hidden := w.hidden[id]
+		if !hidden {
+			w.interesting--
+		}
+		for i, n := 0, c.ParentCount(); i < n; i++ {
+			p, err := c.Parent(i)
+			if err != nil {
+				return nil, err
+			}
+			if hidden {
+				if err := w.markHidden(p); err != nil {
+					return nil, err
+				}
+			}
+			if !w.seen[p.Id.String()] {
+				w.push(p)
+			}
+		}
+		if !hidden {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+// commitDate returns the date that git orders c by in logs: its
+// committer date (or, if it has no committer, its author date).
+func commitDate(c *git.Commit) time.Time {
+	if c.Committer != nil {
+		return c.Committer.When
+	}
+	if c.Author != nil {
+		return c.Author.When
+	}
+	return time.Time{}
+}
+
+type queuedCommit struct {
+	*git.Commit
+	date time.Time
+	n    int // the order in which it was queued, to break ties
+}
+
+// A commitQueue is a heap of commits, newest first; commits with the
+// same date are in the order they were queued, like in git.
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if !q[i].date.Equal(q[j].date) {
+		return q[i].date.After(q[j].date)
+	}
+	return q[i].n < q[j].n
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(queuedCommit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -99,21 +99,18 @@ func (r *Repository) ResolveRevision(spec string) (vcs.CommitID, error) {
 	return ci, vcs.ErrRevisionNotFound
 }
 
-// ResolveTag returns the tag with the given name, or
-// ErrTagNotFound if no such tag exists.
+// ResolveTag returns the commit that the tag with the given name
+// points to, or ErrTagNotFound if no such tag exists. Annotated tags
+// are dereferenced to their commits, like in gitcmd.
 func (r *Repository) ResolveTag(name string) (vcs.CommitID, error) {
-	// TODO: Implement non-fallback that dereferences annotated tags
-	//       consistently with gitcmd version. See issue #24.
-	return r.Repository.ResolveTag(name)
-
-	id, err := r.repo.GetCommitIdOfTag(name)
+	commit, err := r.repo.GetCommitOfTag(name)
 	if _, ok := err.(git.RefNotFound); ok {
 		return "", vcs.ErrTagNotFound
 	} else if err != nil {
 		// Unexpected error
 		return "", err
 	}
-	return vcs.CommitID(id), nil
+	return vcs.CommitID(commit.Id.String()), nil
 }
 
 // ResolveBranch returns the branch with the given name, or
@@ -205,9 +202,6 @@ func (r *Repository) Branches(opt vcs.BranchesOptions) ([]*vcs.Branch, error) {
 
 // Tags returns a list of all tags in the repository.
 func (r *Repository) Tags() ([]*vcs.Tag, error) {
-	// TODO: implement non-fallback (similar to Branches endpoint)
-	return r.Repository.Tags()
-
 	names, err := r.repo.GetTags()
 	if err != nil {
 		return nil, err
@@ -219,7 +213,7 @@ func (r *Repository) Tags() ([]*vcs.Tag, error) {
 		if err != nil {
 			return nil, err
 		}
-		tags = append(tags, &vcs.Tag{Name: name, CommitID: vcs.CommitID(id)})
+		tags = append(tags, &vcs.Tag{Name: name, CommitID: id})
 	}
 
 	return tags, nil
@@ -280,79 +274,58 @@ func (r *Repository) GetCommit(commitID vcs.CommitID) (*vcs.Commit, error) {
 //
 // Optionally, the caller can request the total not to be computed,
 // as this can be expensive for large branches.
+//
+// Commits are listed in the same order as by `git log`: newest
+// committer date first, so a commit is listed after its children
+// unless their dates are skewed.
 func (r *Repository) Commits(opt vcs.CommitsOptions) ([]*vcs.Commit, uint, error) {
-	// TODO(sqs): implement non-fallback
-	return r.Repository.Commits(opt)
-
-	var total uint = 0
-	var commits []*vcs.Commit
-	var err error
+	// Path-limited logs need `git log --follow`'s rename detection,
+	// and Head and Base may be any revision specs that gitcmd
+	// accepts, not just commit IDs.
+	// TODO: Remove fallback usage: Commits with a Path or non-ID spec
+	if opt.Path != "" || !isCommitID(opt.Head) || (opt.Base != "" && !isCommitID(opt.Base)) {
+		return r.Repository.Commits(opt)
+	}
 
-	cur, err := r.repo.GetCommit(string(opt.Head))
+	head, err := r.repo.GetCommit(string(opt.Head))
 	if err != nil {
-		return commits, total, standardizeError(err)
+		return nil, 0, standardizeError(err)
 	}
-
-	parents := []*git.Commit{cur}
-	for opt.N == 0 || opt.N > uint(len(commits)) {
-		// Pop FIFO
-		cur, parents = parents[len(parents)-1], parents[:len(parents)-1]
-		if cur.Id.String() == string(opt.Base) {
-			// FIXME: Is this the correct condition for opt.Base? Please review.
-			break
+	w := newLogWalker(head)
+	if opt.Base != "" {
+		base, err := r.repo.GetCommit(string(opt.Base))
+		if err != nil {
+			return nil, 0, standardizeError(err)
 		}
-
-		if opt.Skip <= total {
-			ci, err := r.GetCommit(vcs.CommitID(cur.Id.String()))
-			if err != nil {
-				return nil, 0, err
-			}
-			commits = append(commits, ci)
+		if err := w.hide(base); err != nil {
+			return nil, 0, err
 		}
-		total++
+	}
 
-		// Store all the parents
-		for p, stop := 0, cur.ParentCount(); p < stop; p++ {
-			pcommit, err := cur.Parent(p)
-			if err != nil {
-				return nil, 0, err
-			}
-			parents = append(parents, pcommit)
+	var (
+		commits []*vcs.Commit
+		total   uint
+	)
+	for {
+		if opt.NoTotal && opt.N != 0 && uint(len(commits)) == opt.N {
+			break
 		}
-		if len(parents) == 0 {
+		c, err := w.next()
+		if err != nil {
+			return nil, 0, standardizeError(err)
+		}
+		if c == nil {
 			break
 		}
+		if total >= opt.Skip && (opt.N == 0 || uint(len(commits)) < opt.N) {
+			commits = append(commits, r.vcsCommit(c))
+		}
+		total++
 	}
-
 	if opt.NoTotal {
-		return commits, 0, err
-	}
-
-	// TODO(sqs): Is this the right way of not getting in a loop when there are merge commits?
-	seen := map[string]struct{}{} // avoid
-	for len(parents) > 0 {
-		// Pop FIFO
-		cur, parents = parents[len(parents)-1], parents[:len(parents)-1]
-		total++
-
-		if _, seen := seen[cur.Id.String()]; seen {
-			continue
-		}
-
-		// Store all the parents
-
-		for p, stop := 0, cur.ParentCount(); p < stop; p++ {
-			pcommit, err := cur.Parent(p)
-			if err != nil {
-				return nil, 0, err
-			}
-			parents = append(parents, pcommit)
-		}
-
-		seen[cur.Id.String()] = struct{}{}
+		total = 0
 	}
-
-	return commits, total, err
+	return commits, total, nil
 }
 
 // FileSystem opens the repository file tree at a given commit ID.
@@ -77,6 +77,25 @@ func (fs *filesystem) Lstat(path string) (os.FileInfo, error) {
 	return fi, nil
 }
 
+// ReadLink implements vcs.SymlinkReader. git stores a symlink's
+// target as the contents of its blob.
+func (fs *filesystem) ReadLink(name string) (string, error) {
+	name = filepath.Clean(internal.Rel(name))
+
+	e, err := fs.tree.GetTreeEntryByPath(name)
+	if err != nil {
+		return "", err
+	}
+	if e.EntryMode() != git.ModeSymlink {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: vcs.ErrNotSymlink}
+	}
+	b, err := e.Blob().Data()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 func (fs *filesystem) Stat(path string) (os.FileInfo, error) {
 	path = filepath.Clean(internal.Rel(path))
 
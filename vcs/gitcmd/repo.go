@@ -560,6 +560,12 @@ func (r *Repository) Diff(base, head vcs.CommitID, opt *vcs.DiffOptions) (*vcs.D
 	if opt.DetectRenames {
 		args = append(args, "-M")
 	}
+	if opt.ContextLines > 0 {
+		args = append(args, "--unified="+strconv.Itoa(opt.ContextLines))
+	}
+	if opt.WordDiff {
+		args = append(args, "--word-diff=plain")
+	}
 	args = append(args, "--src-prefix="+opt.OrigPrefix)
 	args = append(args, "--dst-prefix="+opt.NewPrefix)
 
@@ -859,11 +865,26 @@ func (r *Repository) Search(at vcs.CommitID, opt vcs.SearchOptions) ([]*vcs.Sear
 	switch opt.QueryType {
 	case vcs.FixedQuery:
 		queryType = "--fixed-strings"
+	case vcs.RegexpQuery:
+		queryType = "--extended-regexp"
 	default:
 		return nil, fmt.Errorf("unrecognized QueryType: %q", opt.QueryType)
 	}
 
-	cmd := exec.Command("git", "grep", "--null", "--line-number", "-I", "--no-color", "--context", strconv.Itoa(int(opt.ContextLines)), queryType, "-e", opt.Query, string(at))
+	args := []string{"grep", "--null", "--line-number", "-I", "--no-color", "--context", strconv.Itoa(int(opt.ContextLines)), queryType, "-e", opt.Query, string(at)}
+	if len(opt.PathInclude) > 0 || len(opt.PathExclude) > 0 {
+		args = append(args, "--")
+		for _, p := range opt.PathInclude {
+			args = append(args, ":(glob)"+p)
+		}
+		if len(opt.PathInclude) == 0 {
+			args = append(args, ".")
+		}
+		for _, p := range opt.PathExclude {
+			args = append(args, ":(exclude,glob)"+p)
+		}
+	}
+	cmd := exec.Command("git", args...)
 	cmd.Dir = r.Dir
 	cmd.Stderr = os.Stderr
 	out, err := cmd.StdoutPipe()
@@ -0,0 +1,103 @@
+package hg
+
+import (
+	"time"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// walkSince calls fn for each commit reachable from rec that was
+// authored at or after since, in no particular order.
+//
+// The walk follows parent links from rec and stops descending at the
+// first commit on each line of history that predates since. Commits
+// that are only reachable through such an older commit are not
+// visited, even if they are themselves newer than since (which can
+// happen with clock skew or rebased commits).
+func walkSince(rec *hg_revlog.Rec, since time.Time, fn func(*hg_revlog.Rec, *changeset) error) error {
+	seen := map[int]struct{}{}
+	stack := []*hg_revlog.Rec{rec}
+	for len(stack) > 0 {
+		rec, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if _, ok := seen[rec.FileRev()]; ok {
+			continue
+		}
+		seen[rec.FileRev()] = struct{}{}
+
+		cs, err := readChangeset(rec)
+		if err != nil {
+			return err
+		}
+		if cs.Date.Before(since) {
+			continue
+		}
+		if err := fn(rec, cs); err != nil {
+			return err
+		}
+		stack = append(stack, parentRecs(rec)...)
+	}
+	return nil
+}
+
+// ActivitySummary returns the number of commits reachable from to
+// that were authored at or after since, keyed by the UTC date of the
+// commit's author date ("2006-01-02"). See walkSince for how the
+// history is walked.
+func (r *Repository) ActivitySummary(to vcs.CommitID, since time.Time) (map[string]int, error) {
+	rec, err := r.getRec(to)
+	if err != nil {
+		return nil, err
+	}
+
+	days := map[string]int{}
+	err = walkSince(rec, since, func(_ *hg_revlog.Rec, cs *changeset) error {
+		days[cs.Date.UTC().Format("2006-01-02")]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+// FileChurn returns the number of commits reachable from to that were
+// authored at or after since and changed (added, modified, or
+// removed) each file, keyed by path. Each commit is compared to its
+// parent. Merge commits are not counted, because their changes
+// relative to the first parent are those of the merged-in commits,
+// which are counted themselves. See walkSince for how the history is
+// walked.
+func (r *Repository) FileChurn(to vcs.CommitID, since time.Time) (map[string]int, error) {
+	rec, err := r.getRec(to)
+	if err != nil {
+		return nil, err
+	}
+
+	churn := map[string]int{}
+	err = walkSince(rec, since, func(rec *hg_revlog.Rec, _ *changeset) error {
+		ps := parentRecs(rec)
+		if len(ps) > 1 {
+			return nil
+		}
+		m, err := r.manifest(rec)
+		if err != nil {
+			return err
+		}
+		var parentM hg_store.Manifest
+		if len(ps) == 1 {
+			if parentM, err = r.manifest(ps[0]); err != nil {
+				return err
+			}
+		}
+		for path := range changedPaths(parentM, m) {
+			churn[path]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return churn, nil
+}
@@ -0,0 +1,94 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_ActivitySummary(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 was made at 23:00 UTC on Jan 2 in UTC+1, where it was
+		// already Jan 3, and commit 2 on Jan 3 in UTC+2. hg's offsets
+		// are in seconds west of UTC.
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{date: "1136160000 0"},
+			{date: "1136242800 -3600", parents: []int{0}},
+			{date: "1136250000 -7200", parents: []int{1}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		since time.Time
+		want  map[string]int
+	}{
+		"all":   {since: time.Unix(0, 0), want: map[string]int{"2006-01-02": 2, "2006-01-03": 1}},
+		"since": {since: time.Unix(1136242800, 0), want: map[string]int{"2006-01-02": 1, "2006-01-03": 1}},
+		"none":  {since: time.Unix(1136250001, 0), want: map[string]int{}},
+	}
+	for label, test := range tests {
+		days, err := r.ActivitySummary(vcs.CommitID(ids[2]), test.since)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(days, test.want) {
+			t.Errorf("%s: got %v, want %v", label, days, test.want)
+		}
+	}
+}
+
+func TestRepository_FileChurn(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 modifies a, commit 2 modifies b and adds c, commit 3
+		// merges them, and commit 4 modifies a and removes c.
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{date: "1000 0", files: map[string]string{"a": "0", "b": "0"}},
+			{date: "2000 0", parents: []int{0}, files: map[string]string{"a": "1", "b": "0"}},
+			{date: "3000 0", parents: []int{0}, files: map[string]string{"a": "0", "b": "1", "c": "0"}},
+			{date: "4000 0", parents: []int{1, 2}, files: map[string]string{"a": "1", "b": "1", "c": "0"}},
+			{date: "5000 0", parents: []int{3}, files: map[string]string{"a": "2", "b": "1"}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		since time.Time
+		want  map[string]int
+	}{
+		// The root commit adds a and b, and the merge isn't counted
+		// (otherwise b and c would have changed again relative to the
+		// merge's first parent).
+		"all": {since: time.Unix(0, 0), want: map[string]int{"a": 3, "b": 2, "c": 2}},
+
+		// The walk stops at commits 1 and 0, which predate since.
+		"since": {since: time.Unix(2500, 0), want: map[string]int{"a": 1, "b": 1, "c": 2}},
+
+		"none": {since: time.Unix(6000, 0), want: map[string]int{}},
+	}
+	for label, test := range tests {
+		churn, err := r.FileChurn(vcs.CommitID(ids[4]), test.since)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(churn, test.want) {
+			t.Errorf("%s: got churn %v, want %v", label, churn, test.want)
+		}
+	}
+
+	// A root commit's files are all added.
+	churn, err := r.FileChurn(vcs.CommitID(ids[0]), time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"a": 1, "b": 1}; !reflect.DeepEqual(churn, want) {
+		t.Errorf("root commit: got churn %v, want %v", churn, want)
+	}
+}
@@ -0,0 +1,276 @@
+package hg
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// parentRecs returns the changelog records of rec's parents (first
+// parent first). It returns nil for a root commit.
+func parentRecs(rec *hg_revlog.Rec) []*hg_revlog.Rec {
+	if rec.IsStartOfBranch() {
+		return nil
+	}
+	var ps []*hg_revlog.Rec
+	if p := rec.Parent(); p != nil {
+		ps = append(ps, p)
+	}
+	if rec.Parent2Present() {
+		ps = append(ps, rec.Parent2())
+	}
+	return ps
+}
+
+// Parents returns the IDs of the commit's parents, in the same order
+// as the Parents of the commit returned by GetCommit (see
+// CanonicalParentOrder), or nil for a root commit. Only the
+// changelog index is read, not the changeset, so it is much cheaper
+// than GetCommit for walking the commit graph.
+func (r *Repository) Parents(id vcs.CommitID) ([]vcs.CommitID, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return nil, err
+	}
+	parents, _ := r.parentIDs(rec)
+	return parents, nil
+}
+
+// parentIDs returns the IDs of rec's parents, sorted if
+// r.CanonicalParentOrder is set, and the ID of its first parent if
+// the parents were reordered.
+func (r *Repository) parentIDs(rec *hg_revlog.Rec) (parents []vcs.CommitID, first vcs.CommitID) {
+	for _, p := range parentRecs(rec) {
+		parents = append(parents, vcs.CommitID(hex.EncodeToString(p.Id())))
+	}
+	if r.CanonicalParentOrder && len(parents) > 0 {
+		first = parents[0]
+		sort.Sort(commitIDs(parents))
+	}
+	return parents, first
+}
+
+// ancestorRecs returns the set of records reachable from rec
+// (including rec itself), keyed by revision number. Each record is
+// visited once, so histories with many merges don't cause repeated
+// walks of shared ancestry.
+func ancestorRecs(rec *hg_revlog.Rec) map[int]*hg_revlog.Rec {
+	seen := map[int]*hg_revlog.Rec{}
+	stack := []*hg_revlog.Rec{rec}
+	for len(stack) > 0 {
+		rec, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if _, ok := seen[rec.FileRev()]; ok {
+			continue
+		}
+		seen[rec.FileRev()] = rec
+		stack = append(stack, parentRecs(rec)...)
+	}
+	return seen
+}
+
+// A logWalker visits the records reachable from a head, newest (i.e.,
+// highest revision number) first, like `hg log -r 'reverse(::head)'`.
+// Because a commit's parents always have lower revision numbers, it
+// walks the changelog backward from the head, keeping only the set of
+// reachable revisions that it hasn't reached yet, so it never reads
+// more of the changelog than it needs to. It ends once the last such
+// revision (the oldest root in the head's history) is visited, not at
+// the first root it reaches, so histories that merged several roots
+// are visited in full.
+type logWalker struct {
+	rec     *hg_revlog.Rec // the next record to examine
+	pending map[int]bool   // reachable revisions not yet visited
+	exclude map[int]*hg_revlog.Rec
+
+	// err is the *CorruptRepositoryError for the panic that hgo
+	// raised reading the changelog (as it may on a truncated one),
+	// if any, which ended the walk.
+	err error
+}
+
+// newLogWalker returns a logWalker for the records reachable from
+// head. Records in exclude, which must include its records' ancestors
+// (as the sets returned by ancestorRecs do), are skipped.
+func newLogWalker(head *hg_revlog.Rec, exclude map[int]*hg_revlog.Rec) *logWalker {
+	w := &logWalker{rec: head, pending: map[int]bool{}, exclude: exclude}
+	if _, excluded := exclude[head.FileRev()]; !excluded {
+		w.pending[head.FileRev()] = true
+	}
+	return w
+}
+
+// next returns the next record, or nil if all have been visited or
+// the changelog couldn't be read (see w.err).
+func (w *logWalker) next() *hg_revlog.Rec {
+	for len(w.pending) > 0 && w.err == nil {
+		rec := w.rec
+		rev := rec.FileRev()
+		reachable := w.pending[rev]
+		if reachable {
+			delete(w.pending, rev)
+			for _, p := range w.parents(rec) {
+				if _, excluded := w.exclude[p.FileRev()]; !excluded {
+					w.pending[p.FileRev()] = true
+				}
+			}
+		}
+		// Records before rev 0 must not be read, so only step back
+		// while there is more to visit.
+		if len(w.pending) > 0 {
+			w.rec = w.prev(rec)
+		}
+		if w.err != nil {
+			return nil
+		}
+		if reachable {
+			return rec
+		}
+	}
+	return nil
+}
+
+// parents returns parentRecs(rec), storing a panic raised by hgo in
+// w.err.
+func (w *logWalker) parents(rec *hg_revlog.Rec) []*hg_revlog.Rec {
+	rev := rec.FileRev()
+	defer recoverCorrupt(&rev, &w.err)
+	return parentRecs(rec)
+}
+
+// prev returns rec.Prev(), storing a panic raised by hgo in w.err.
+func (w *logWalker) prev(rec *hg_revlog.Rec) *hg_revlog.Rec {
+	rev := rec.FileRev()
+	defer recoverCorrupt(&rev, &w.err)
+	return rec.Prev()
+}
+
+// done reports whether all records have been visited, i.e., whether
+// the last one returned by next was the last.
+func (w *logWalker) done() bool { return len(w.pending) == 0 }
+
+// Ancestors returns the set of commits reachable from the commit,
+// including the commit itself (like `git rev-list <id>`). Each commit
+// is visited only once, so the cost is linear in the size of the
+// history even when it has many merges; both the time taken and the
+// memory used are proportional to the number of ancestors.
+func (r *Repository) Ancestors(id vcs.CommitID) (map[vcs.CommitID]struct{}, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return nil, err
+	}
+	recs := ancestorRecs(rec)
+	ancs := make(map[vcs.CommitID]struct{}, len(recs))
+	for _, rec := range recs {
+		ancs[vcs.CommitID(hex.EncodeToString(rec.Id()))] = struct{}{}
+	}
+	return ancs, nil
+}
+
+// FirstParentLog returns head and its first-parent ancestors (its
+// first parent, that commit's first parent, and so on, down to a root
+// commit), newest first, like `git log --first-parent`. Unlike
+// Commits, which lists every commit reachable from head, it doesn't
+// descend into the second parent of a merge, so the commits that a
+// merge brought in from another line of development are omitted,
+// leaving a linear history of the mainline.
+func (r *Repository) FirstParentLog(head vcs.CommitID) ([]*vcs.Commit, error) {
+	rec, err := r.getRec(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*vcs.Commit
+	for {
+		c, err := r.makeCommit(rec)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+		ps := parentRecs(rec)
+		if len(ps) == 0 {
+			return commits, nil
+		}
+		rec = ps[0]
+	}
+}
+
+// CommitCount returns the number of commits reachable from head,
+// including head itself (like `git rev-list --count <head>`). The
+// count covers head's full ancestry, including the ancestors of every
+// parent of each merge, not only its first-parent line. Only the
+// changelog index is read, not the changesets, so it is much cheaper
+// than counting the commits returned by Commits.
+func (r *Repository) CommitCount(head vcs.CommitID) (uint, error) {
+	rec, err := r.getRec(head)
+	if err != nil {
+		return 0, err
+	}
+	return uint(len(ancestorRecs(rec))), nil
+}
+
+// commitDepths caches commit depths (see CommitDepth), keyed by
+// changelog revision number.
+type commitDepths struct {
+	mu sync.Mutex
+	m  map[int]int
+}
+
+// CommitDepth returns the length of the longest path of parent links
+// from the commit to a root commit (so a root commit's depth is 0).
+// Unlike CommitIndex, it is a property of the commit graph, not of
+// the order in which commits were added to this repository, so it can
+// be used to lay out the graph in layers. The first call for a commit
+// visits all of its ancestors, which takes time and memory
+// proportional to the size of its history; the depths are cached, so
+// later calls for the commit or its ancestors are cheap.
+func (r *Repository) CommitDepth(id vcs.CommitID) (int, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return 0, err
+	}
+
+	target := rec.FileRev()
+
+	r.depths.mu.Lock()
+	defer r.depths.mu.Unlock()
+	if d, ok := r.depths.m[target]; ok {
+		return d, nil
+	}
+	if r.depths.m == nil {
+		r.depths.m = map[int]int{}
+	}
+
+	// Compute the depths of the uncached ancestors, parents first (a
+	// commit's parents have lower revision numbers).
+	recs := map[int]*hg_revlog.Rec{}
+	stack := []*hg_revlog.Rec{rec}
+	for len(stack) > 0 {
+		rec, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if _, ok := recs[rec.FileRev()]; ok {
+			continue
+		}
+		if _, ok := r.depths.m[rec.FileRev()]; ok {
+			continue
+		}
+		recs[rec.FileRev()] = rec
+		stack = append(stack, parentRecs(rec)...)
+	}
+	revs := make([]int, 0, len(recs))
+	for rev := range recs {
+		revs = append(revs, rev)
+	}
+	sort.Ints(revs)
+	for _, rev := range revs {
+		d := 0
+		for _, p := range parentRecs(recs[rev]) {
+			if pd := r.depths.m[p.FileRev()] + 1; pd > d {
+				d = pd
+			}
+		}
+		r.depths.m[rev] = d
+	}
+	return r.depths.m[target], nil
+}
@@ -0,0 +1,117 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_Ancestors(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// 0 -- 1 -- 3 -- 4
+		//  \       /
+		//   `- 2 -'        5 (unrelated root)
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"root", "a", "b", "merge", "c", "unrelated"},
+			[][]int{nil, {0}, {0}, {1, 2}, {3}, nil},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[int][]int{
+		0: {0},
+		2: {0, 2},
+		4: {0, 1, 2, 3, 4}, // through both parents of the merge
+		5: {5},
+	}
+	for rev, wantRevs := range tests {
+		ancs, err := r.Ancestors(vcs.CommitID(ids[rev]))
+		if err != nil {
+			t.Errorf("rev %d: %s", rev, err)
+			continue
+		}
+		want := map[vcs.CommitID]struct{}{}
+		for _, a := range wantRevs {
+			want[vcs.CommitID(ids[a])] = struct{}{}
+		}
+		if !reflect.DeepEqual(ancs, want) {
+			t.Errorf("rev %d: got ancestors %v, want %v", rev, ancs, want)
+		}
+	}
+
+	if _, err := r.Ancestors("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_CommitDepth(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// 0 -- 1 -- 2 -- 3 -- 5
+		//  \             /
+		//   `---- 4 ----'        6 (unrelated root)
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"root", "a", "b", "c", "side", "merge", "unrelated"},
+			[][]int{nil, {0}, {1}, {2}, {0}, {4, 3}, nil},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	// The merge's depth is the longest path through either parent,
+	// which is less than the number of commits in its history.
+	for rev, want := range []int{0, 1, 2, 3, 1, 4, 0} {
+		if d, err := r.CommitDepth(vcs.CommitID(ids[rev])); err != nil || d != want {
+			t.Errorf("rev %d: got depth %d, %v, want %d", rev, d, err, want)
+		}
+	}
+	if n, err := r.CommitCount(vcs.CommitID(ids[5])); err != nil || n != 6 {
+		t.Errorf("merge: got CommitCount %d, %v, want 6", n, err)
+	}
+
+	if _, err := r.CommitDepth("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_CommitDepth_cache(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit0", "commit1", "commit2", "commit3")
+	})
+	defer os.RemoveAll(dir)
+
+	// Computing a commit's depth caches the depths of its ancestors,
+	// but not of its descendants.
+	if d, err := r.CommitDepth(vcs.CommitID(ids[2])); err != nil || d != 2 {
+		t.Fatalf("got depth %d, %v, want 2", d, err)
+	}
+	if len(r.depths.m) != 3 {
+		t.Errorf("got %d cached depths, want 3", len(r.depths.m))
+	}
+	for _, rev := range []int{0, 1, 2} {
+		if _, ok := r.depths.m[rev]; !ok {
+			t.Errorf("rev %d: depth isn't cached", rev)
+		}
+	}
+
+	// Later calls use the cache.
+	r.depths.m[1] = 100
+	if d, err := r.CommitDepth(vcs.CommitID(ids[1])); err != nil || d != 100 {
+		t.Errorf("got depth %d, %v, want the cached depth 100", d, err)
+	}
+
+	// Refresh clears the cache, because revision numbers may have been
+	// reassigned.
+	if err := r.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if r.depths.m != nil {
+		t.Errorf("got %d cached depths after Refresh, want none", len(r.depths.m))
+	}
+	if d, err := r.CommitDepth(vcs.CommitID(ids[3])); err != nil || d != 3 {
+		t.Errorf("after Refresh: got depth %d, %v, want 3", d, err)
+	}
+}
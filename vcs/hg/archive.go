@@ -0,0 +1,165 @@
+package hg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// Archive writes an archive of the files at the commit to w in
+// opt.Format (a tarball by default), like `hg archive`, without
+// checking the commit out.
+// Files are written in manifest order, each with the commit's date
+// as its modification time. A file's mode is derived from its
+// manifest entry as by Lstat: executable files have mode 0755 and
+// other files 0644, and symlinks are archived
+// as symlinks to their targets. Directories aren't archived as
+// entries of their own.
+func (r *Repository) Archive(at vcs.CommitID, w io.Writer, opt *vcs.ArchiveOptions) error {
+	if opt == nil {
+		opt = &vcs.ArchiveOptions{}
+	}
+	if opt.Progress != nil {
+		pw := &progressWriter{w: w, fn: opt.Progress}
+		defer pw.finish()
+		w = pw
+	}
+
+	var aw archiveWriter
+	switch format := opt.Format; format {
+	case "", vcs.ArchiveTar:
+		aw = tarArchiveWriter{tar.NewWriter(w)}
+	case vcs.ArchiveZip:
+		aw = zipArchiveWriter{zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("hg: unsupported archive format %q", format)
+	}
+
+	fs, err := r.fileSystem(at)
+	if err != nil {
+		return err
+	}
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return err
+	}
+	mtime, err := fs.getModTime()
+	if err != nil {
+		return err
+	}
+
+	for i := range m {
+		ent := &m[i]
+		rec, err := fs.entryRec(ent)
+		if err != nil {
+			return standardizeHgError(err)
+		}
+		data, err := fs.readFile(rec)
+		if err != nil {
+			return err
+		}
+
+		mode := fileInfo(ent, mtime).Mode()
+		if mode&os.ModeSymlink == 0 {
+			if mode&0111 != 0 {
+				mode |= 0755
+			} else {
+				mode |= 0644
+			}
+		}
+		if err := aw.add(ent.FileName, mode, mtime, data); err != nil {
+			return err
+		}
+	}
+	return aw.close()
+}
+
+// An archiveWriter writes the entries of an archive in one of the
+// vcs.ArchiveFormats.
+type archiveWriter interface {
+	// add adds a file (or, if mode has os.ModeSymlink set, a symlink
+	// whose target is data) to the archive.
+	add(name string, mode os.FileMode, mtime time.Time, data []byte) error
+
+	// close finishes writing the archive.
+	close() error
+}
+
+type tarArchiveWriter struct{ tw *tar.Writer }
+
+func (a tarArchiveWriter) add(name string, mode os.FileMode, mtime time.Time, data []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		ModTime:  mtime,
+		Typeflag: tar.TypeReg,
+		Size:     int64(len(data)),
+	}
+	if mode&os.ModeSymlink != 0 {
+		hdr.Typeflag, hdr.Linkname, hdr.Mode, hdr.Size = tar.TypeSymlink, string(data), 0777, 0
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	_, err := a.tw.Write(data)
+	return err
+}
+
+func (a tarArchiveWriter) close() error { return a.tw.Close() }
+
+type zipArchiveWriter struct{ zw *zip.Writer }
+
+func (a zipArchiveWriter) add(name string, mode os.FileMode, mtime time.Time, data []byte) error {
+	hdr := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	hdr.SetModTime(mtime)
+	if mode&os.ModeSymlink != 0 {
+		// Like Info-ZIP, store a symlink as an entry with the symlink
+		// mode whose contents are its target.
+		mode = os.ModeSymlink | 0777
+		hdr.Method = zip.Store
+	}
+	hdr.SetMode(mode)
+	f, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func (a zipArchiveWriter) close() error { return a.zw.Close() }
+
+// A progressWriter reports the number of bytes written to w to fn
+// every vcs.ProgressInterval bytes.
+type progressWriter struct {
+	w            io.Writer
+	fn           vcs.ProgressFunc
+	done         int64 // bytes written so far
+	lastReported int64
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	if pw.done-pw.lastReported >= vcs.ProgressInterval {
+		pw.lastReported = pw.done
+		pw.fn(pw.done)
+	}
+	return n, err
+}
+
+// finish reports the bytes written since the last report, if any.
+func (pw *progressWriter) finish() {
+	if pw.done != pw.lastReported {
+		pw.lastReported = pw.done
+		pw.fn(pw.done)
+	}
+}
@@ -0,0 +1,144 @@
+package hg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_Archive(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		type file struct {
+			name, flags, data string
+		}
+		files := []file{ // in manifest order
+			{"a", "", "hello\n"},
+			{"bin/run", "x", "#!/bin/sh\n"},
+			{"link", "l", "a"},
+		}
+		var manifest bytes.Buffer
+		for _, f := range files {
+			filelog, nodes := buildRevlog([]string{f.data}, [][]int{nil})
+			writeTestFiles(t, dir, map[string]string{".hg/store/data/" + f.name + ".i": string(filelog)})
+			fmt.Fprintf(&manifest, "%s\x00%x%s\n", f.name, nodes[0], f.flags)
+		}
+		manifestlog, manifestNodes := buildRevlog([]string{manifest.String()}, [][]int{nil})
+		text := fmt.Sprintf("%x\na <a@a.com>\n1136214245 0\na\nbin/run\nlink\n\nadd files", manifestNodes[0])
+		changelog, nodes := buildRevlog([]string{text}, [][]int{nil})
+		id = hex.EncodeToString(nodes[0])
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/00manifest.i":  string(manifestlog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", id, 0, id),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	// Each entry is described as "name mode data" (the data of a
+	// symlink being its target).
+	want := []string{
+		"a -rw-r--r-- hello\n",
+		"bin/run -rwxr-xr-x #!/bin/sh\n",
+		"link Lrwxrwxrwx a",
+	}
+
+	var buf bytes.Buffer
+	if err := r.Archive(vcs.CommitID(id), &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			data = []byte(hdr.Linkname)
+		}
+		if want := time.Unix(1136214245, 0); !hdr.ModTime.Equal(want) {
+			t.Errorf("tar: %s: got mtime %v, want %v", hdr.Name, hdr.ModTime, want)
+		}
+		got = append(got, fmt.Sprintf("%s %v %s", hdr.Name, hdr.FileInfo().Mode(), data))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tar: got entries %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	if err := r.Archive(vcs.CommitID(id), &buf, &vcs.ArchiveOptions{Format: vcs.ArchiveZip}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %v %s", f.Name, f.Mode(), data))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("zip: got entries %q, want %q", got, want)
+	}
+
+	if err := r.Archive(vcs.CommitID(id), ioutil.Discard, &vcs.ArchiveOptions{Format: "rar"}); err == nil {
+		t.Error("rar: got no error, want unsupported format")
+	}
+
+	// The archive is smaller than vcs.ProgressInterval, so progress is
+	// only reported once it's complete.
+	buf.Reset()
+	var reported []int64
+	progress := func(n int64) { reported = append(reported, n) }
+	if err := r.Archive(vcs.CommitID(id), &buf, &vcs.ArchiveOptions{Progress: progress}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{int64(buf.Len())}; !reflect.DeepEqual(reported, want) {
+		t.Errorf("progress: got %v, want %v", reported, want)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var reported []int64
+	pw := &progressWriter{w: ioutil.Discard, fn: func(n int64) { reported = append(reported, n) }}
+	chunk := make([]byte, vcs.ProgressInterval/2+1)
+	for i := 0; i < 4; i++ {
+		if _, err := pw.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pw.finish()
+	pw.finish()
+
+	n := int64(len(chunk))
+	if want := []int64{2 * n, 4 * n}; !reflect.DeepEqual(reported, want) {
+		t.Errorf("got %v, want %v", reported, want)
+	}
+}
@@ -0,0 +1,73 @@
+package hg
+
+import (
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/hgcmd"
+)
+
+// A Backend is an implementation of hg repository access.
+type Backend int
+
+const (
+	// BackendAuto uses the native backend, falling back to the
+	// command-line backend if the repository can't be opened natively
+	// (e.g., because it uses a repository format that the native
+	// reader doesn't support).
+	BackendAuto Backend = iota
+
+	// BackendNative reads the repository directly, without running
+	// hg. Operations that it doesn't implement natively still run hg.
+	BackendNative
+
+	// BackendCommandLine runs the hg command-line tool for all
+	// operations.
+	BackendCommandLine
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendAuto:
+		return "auto"
+	case BackendNative:
+		return "native"
+	case BackendCommandLine:
+		return "command-line"
+	default:
+		return fmt.Sprintf("Backend(%d)", int(b))
+	}
+}
+
+// openNative opens a repository with the native backend. It is a
+// variable so that tests can simulate failures.
+var openNative = func(dir string) (vcs.Repository, error) { return Open(dir) }
+
+// OpenBackend opens the hg repository rooted at dir using the given
+// backend. With BackendAuto, if the native backend fails to open the
+// repository and the command-line backend succeeds, the command-line
+// repository is returned; if both fail, the native backend's error is
+// returned.
+func OpenBackend(dir string, backend Backend) (vcs.Repository, error) {
+	switch backend {
+	case BackendAuto:
+		r, err := openNative(dir)
+		if err == nil {
+			return r, nil
+		}
+		if Logger != nil {
+			Logger.Printf("hg: opening %s natively failed, falling back to the hg command: %s", dir, err)
+		}
+		cr, cerr := hgcmd.Open(dir)
+		if cerr != nil {
+			return nil, err
+		}
+		return cr, nil
+	case BackendNative:
+		return openNative(dir)
+	case BackendCommandLine:
+		return hgcmd.Open(dir)
+	default:
+		return nil, fmt.Errorf("unknown hg backend %v", backend)
+	}
+}
@@ -0,0 +1,44 @@
+package hg
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/hgcmd"
+)
+
+func TestOpenBackend_fallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, ".hg"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	errNative := errors.New("unsupported repository format")
+	origOpenNative := openNative
+	openNative = func(string) (vcs.Repository, error) { return nil, errNative }
+	defer func() { openNative = origOpenNative }()
+
+	r, err := OpenBackend(dir, BackendAuto)
+	if err != nil {
+		t.Fatalf("BackendAuto: %s", err)
+	}
+	if _, ok := r.(*hgcmd.Repository); !ok {
+		t.Errorf("BackendAuto: got %T, want *hgcmd.Repository", r)
+	}
+
+	if _, err := OpenBackend(dir, BackendNative); err != errNative {
+		t.Errorf("BackendNative: got error %v, want %v", err, errNative)
+	}
+
+	if _, err := OpenBackend(filepath.Join(dir, "nonexistent"), BackendAuto); err != errNative {
+		t.Errorf("BackendAuto with no repository: got error %v, want the native error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package hg
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// IsBare reports whether the repository has no working copy checked
+// out. Mercurial has no first-class notion of bare repositories like
+// git's; the equivalent is a repository whose working directory is at
+// the null revision, as left by `hg clone --noupdate` or `hg update
+// null` (and by `hg init`, before the first commit). It is detected by
+// reading the working directory's parent from .hg/dirstate: the
+// repository is bare if there is no dirstate or its first parent is
+// the null revision.
+//
+// None of the Repository's methods need a working copy (they all read
+// the store under .hg), so they work the same on bare repositories;
+// IsBare is for callers whose own behavior depends on one.
+func (r *Repository) IsBare() bool {
+	f, err := os.Open(filepath.Join(r.Dir, ".hg", "dirstate"))
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	// The dirstate begins with the 20-byte node IDs of the working
+	// directory's two parents.
+	p1 := make([]byte, 20)
+	if _, err := io.ReadFull(f, p1); err != nil {
+		return true
+	}
+	return bytes.Equal(p1, make([]byte, 20))
+}
@@ -0,0 +1,35 @@
+package hg
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepository_IsBare(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1")
+	})
+	defer os.RemoveAll(dir)
+	if !r.IsBare() {
+		t.Error("without dirstate: got IsBare false, want true")
+	}
+
+	writeDirstate := func(p1 []byte) {
+		if err := ioutil.WriteFile(filepath.Join(dir, ".hg", "dirstate"), append(p1, make([]byte, 20)...), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDirstate(make([]byte, 20))
+	if !r.IsBare() {
+		t.Error("at null revision: got IsBare false, want true")
+	}
+	id, _ := hex.DecodeString(ids[0])
+	writeDirstate(id)
+	if r.IsBare() {
+		t.Error("at commit: got IsBare true, want false")
+	}
+}
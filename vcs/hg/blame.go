@@ -0,0 +1,171 @@
+package hg
+
+import (
+	"path/filepath"
+	"sort"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// BlameFile returns the hunks of the file at path in
+// opt.NewestCommit (or in the tip, if it isn't set), each attributed
+// to the commit that introduced its lines. It is computed natively by
+// walking the file's revlog (see annotate), so renames aren't
+// followed: lines that predate a rename are attributed to the commit
+// that renamed the file. If opt.OldestCommit is set, file revisions
+// introduced before it aren't walked, and their lines are attributed
+// to the oldest revision that is. If opt.StartLine or opt.EndLine is
+// set, only hunks of the lines in that (1-indexed, inclusive) range
+// are returned.
+func (r *Repository) BlameFile(path string, opt *vcs.BlameOptions) ([]*vcs.Hunk, error) {
+	if opt == nil {
+		opt = &vcs.BlameOptions{}
+	}
+	newest := opt.NewestCommit
+	if newest == "" {
+		id, err := r.ResolveRevision("tip")
+		if err != nil {
+			return nil, err
+		}
+		newest = id
+	}
+	fs, err := r.fileSystem(newest)
+	if err != nil {
+		return nil, err
+	}
+	rec, _, err := fs.getEntry(filepath.Clean(internal.Rel(path)))
+	if err != nil {
+		return nil, standardizeHgError(err)
+	}
+	oldestRev := -1
+	if opt.OldestCommit != "" {
+		orec, err := r.getRec(opt.OldestCommit)
+		if err != nil {
+			return nil, err
+		}
+		oldestRev = orec.FileRev()
+	}
+
+	lines, owners, err := annotate(fs, rec, oldestRev)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := map[int]*vcs.Commit{}
+	var hunks []*vcs.Hunk
+	var end int // byte offset of the end of the current line
+	for i, line := range lines {
+		lineNo, start := i+1, end
+		end += len(line)
+		if (opt.StartLine > 0 && lineNo < opt.StartLine) || (opt.EndLine > 0 && lineNo > opt.EndLine) {
+			continue
+		}
+
+		c, ok := commits[owners[i]]
+		if !ok {
+			crec, err := hg_revlog.FileRevSpec(owners[i]).Lookup(fs.cl)
+			if err != nil {
+				return nil, err
+			}
+			if c, err = r.makeCommit(crec); err != nil {
+				return nil, err
+			}
+			commits[owners[i]] = c
+		}
+
+		if n := len(hunks); n > 0 && hunks[n-1].EndLine == lineNo && hunks[n-1].CommitID == c.ID {
+			hunks[n-1].EndLine++
+			hunks[n-1].EndByte = end
+			continue
+		}
+		hunks = append(hunks, &vcs.Hunk{
+			StartLine: lineNo,
+			EndLine:   lineNo + 1,
+			StartByte: start,
+			EndByte:   end,
+			CommitID:  c.ID,
+			Author:    c.Author,
+		})
+	}
+	return hunks, nil
+}
+
+// annotate returns the lines of the file revision rec and, for each
+// line, the changelog revision of the commit that introduced it (the
+// linkrev of the file revision it first appeared in). It walks rec's
+// ancestors in the file's revlog oldest first, carrying each line's
+// owner over from the parent revisions that it is unchanged from
+// (preferring the first parent). File revisions introduced before the
+// changelog revision oldestRev (if it isn't -1) are skipped.
+//
+// Each file revision's annotation is kept only until all of its
+// children have been annotated, so memory use is proportional to the
+// width of the file's history, not its length.
+func annotate(fs *hgFSNative, rec *hg_revlog.Rec, oldestRev int) ([]string, []int, error) {
+	revs := ancestorRecs(rec)
+	if oldestRev >= 0 {
+		for rev, frec := range revs {
+			if int(frec.Linkrev) < oldestRev && rev != rec.FileRev() {
+				delete(revs, rev)
+			}
+		}
+	}
+	order := make([]int, 0, len(revs))
+	children := map[int]int{}
+	for rev, frec := range revs {
+		order = append(order, rev)
+		for _, p := range parentRecs(frec) {
+			if _, ok := revs[p.FileRev()]; ok {
+				children[p.FileRev()]++
+			}
+		}
+	}
+	sort.Ints(order)
+
+	type annotation struct {
+		lines  []string
+		owners []int
+	}
+	anns := map[int]*annotation{}
+	for _, rev := range order {
+		frec := revs[rev]
+		data, err := fs.readFile(frec)
+		if err != nil {
+			return nil, nil, err
+		}
+		a := &annotation{lines: internal.SplitLines(string(data))}
+		a.owners = make([]int, len(a.lines))
+		for i := range a.owners {
+			a.owners[i] = int(frec.Linkrev)
+		}
+
+		// Apply the first parent last, so that it takes precedence.
+		ps := parentRecs(frec)
+		for i := len(ps) - 1; i >= 0; i-- {
+			pa, ok := anns[ps[i].FileRev()]
+			if !ok {
+				continue
+			}
+			for j, k := range internal.LineMatches(pa.lines, a.lines) {
+				if k >= 0 {
+					a.owners[j] = pa.owners[k]
+				}
+			}
+		}
+		anns[rev] = a
+
+		for _, p := range ps {
+			if _, ok := anns[p.FileRev()]; !ok {
+				continue
+			}
+			if children[p.FileRev()]--; children[p.FileRev()] == 0 {
+				delete(anns, p.FileRev())
+			}
+		}
+	}
+
+	a := anns[rec.FileRev()]
+	return a.lines, a.owners, nil
+}
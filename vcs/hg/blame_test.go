@@ -0,0 +1,98 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_BlameFile(t *testing.T) {
+	// A hunk as [start line, end line, start byte, end byte, commit
+	// revision]; the end line is exclusive, like in vcs.Hunk.
+	type hunk [5]int
+
+	tests := map[string]struct {
+		contents []string
+		parents  [][]int
+		oldest   int // the revision of opt.OldestCommit, or -1
+		opt      vcs.BlameOptions
+		want     []hunk
+	}{
+		"linear": {
+			contents: []string{"a\nb\n", "a\nB\nc\n"},
+			parents:  [][]int{nil, {0}},
+			oldest:   -1,
+			want:     []hunk{{1, 2, 0, 2, 0}, {2, 4, 2, 6, 1}},
+		},
+		// Commits 1 and 2 change the first and last lines on separate
+		// branches, and commit 3 merges them, keeping both changes.
+		"merge": {
+			contents: []string{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n"},
+			parents:  [][]int{nil, {0}, {0}, {1, 2}},
+			oldest:   -1,
+			want:     []hunk{{1, 2, 0, 2, 1}, {2, 3, 2, 4, 0}, {3, 4, 4, 6, 2}},
+		},
+		// Commit 0 isn't walked, so its line is attributed to commit
+		// 1.
+		"oldest commit": {
+			contents: []string{"a\n", "a\nb\n", "a\nb\nc\n"},
+			parents:  [][]int{nil, {0}, {1}},
+			oldest:   1,
+			want:     []hunk{{1, 3, 0, 4, 1}, {3, 4, 4, 6, 2}},
+		},
+		"line range": {
+			contents: []string{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n"},
+			parents:  [][]int{nil, {0}, {0}, {1, 2}},
+			oldest:   -1,
+			opt:      vcs.BlameOptions{StartLine: 2, EndLine: 2},
+			want:     []hunk{{2, 3, 2, 4, 0}},
+		},
+		// Line endings are part of the lines, so they count toward
+		// the byte offsets.
+		"CRLF": {
+			contents: []string{"a\r\nb\r\n", "a\r\nB\r\n"},
+			parents:  [][]int{nil, {0}},
+			oldest:   -1,
+			want:     []hunk{{1, 2, 0, 3, 0}, {2, 3, 3, 6, 1}},
+		},
+	}
+	for label, test := range tests {
+		func() {
+			dir, err := ioutil.TempDir("", "go-vcs-hg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			ids := writeTestRepoHistory(t, dir, "f", test.contents, test.parents)
+			r, err := Open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opt := test.opt
+			if test.oldest >= 0 {
+				opt.OldestCommit = vcs.CommitID(ids[test.oldest])
+			}
+
+			hunks, err := r.BlameFile("f", &opt)
+			if err != nil {
+				t.Errorf("%s: %s", label, err)
+				return
+			}
+			revs := map[vcs.CommitID]int{}
+			for rev, id := range ids {
+				revs[vcs.CommitID(id)] = rev
+			}
+			var got []hunk
+			for _, h := range hunks {
+				got = append(got, hunk{h.StartLine, h.EndLine, h.StartByte, h.EndByte, revs[h.CommitID]})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: got hunks %v, want %v", label, got, test.want)
+			}
+		}()
+	}
+}
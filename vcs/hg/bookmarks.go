@@ -0,0 +1,96 @@
+package hg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// A Bookmark is an hg bookmark: a movable name for a commit that,
+// like a git branch, moves forward when a commit is made on top of it.
+type Bookmark struct {
+	Name     string
+	CommitID vcs.CommitID
+}
+
+// readBookmarks reads the bookmarks recorded in the .hg/bookmarks
+// file of the repository at dir, whose lines are a node ID and a
+// bookmark name separated by a space. Like hg, it skips malformed
+// lines. A repository with no bookmarks file has no bookmarks.
+func readBookmarks(dir string) (map[string]vcs.CommitID, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".hg", "bookmarks"))
+	if os.IsNotExist(err) {
+		return map[string]vcs.CommitID{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	m := map[string]vcs.CommitID{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		i := strings.IndexByte(line, ' ')
+		if i != 40 || i+1 == len(line) {
+			continue
+		}
+		if _, err := hex.DecodeString(line[:i]); err != nil {
+			continue
+		}
+		m[line[i+1:]] = vcs.CommitID(strings.ToLower(line[:i]))
+	}
+	return m, s.Err()
+}
+
+// ResolveBookmark returns the commit that the named bookmark points
+// to. Like the branch heads, bookmarks are read when the repository
+// is opened (or refreshed), so a bookmark moved without adding a
+// commit (e.g., with `hg bookmark -f`) is seen only after Refresh. If
+// no such bookmark exists, vcs.ErrBookmarkNotFound is returned.
+func (r *Repository) ResolveBookmark(name string) (vcs.CommitID, error) {
+	if err := r.refreshIfStale(); err != nil {
+		return "", err
+	}
+	st := r.state()
+	if st.bookmarksErr != nil {
+		return "", st.bookmarksErr
+	}
+	if id, ok := st.bookmarks[name]; ok {
+		return id, nil
+	}
+	return "", vcs.ErrBookmarkNotFound
+}
+
+// Bookmarks returns the repository's bookmarks, sorted by name.
+func (r *Repository) Bookmarks() ([]*Bookmark, error) {
+	if err := r.refreshIfStale(); err != nil {
+		return nil, err
+	}
+	st := r.state()
+	if st.bookmarksErr != nil {
+		return nil, st.bookmarksErr
+	}
+	bs := make([]*Bookmark, 0, len(st.bookmarks))
+	for name, id := range st.bookmarks {
+		bs = append(bs, &Bookmark{Name: name, CommitID: id})
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Name < bs[j].Name })
+	return bs, nil
+}
+
+// bookmarkTarget returns the commit that the named bookmark points
+// to, unless a tag of the same name (which takes precedence in
+// ResolveRevision) exists.
+func (st *repoState) bookmarkTarget(name string) (vcs.CommitID, bool) {
+	if _, ok := st.allTags.IdByName[name]; ok {
+		return "", false
+	}
+	id, ok := st.bookmarks[name]
+	return id, ok
+}
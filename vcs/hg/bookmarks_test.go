@@ -0,0 +1,109 @@
+package hg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestReadBookmarks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A repository without a bookmarks file has no bookmarks.
+	if err := os.Mkdir(filepath.Join(dir, ".hg"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := readBookmarks(dir); err != nil {
+		t.Fatal(err)
+	} else if len(m) != 0 {
+		t.Errorf("got %v, want no bookmarks", m)
+	}
+
+	id := fmt.Sprintf("%040x", 1)
+	writeTestFiles(t, dir, map[string]string{
+		".hg/bookmarks": id + " feature\n" +
+			fmt.Sprintf("%040X", 2) + " with space\r\n" +
+			"malformed\n" +
+			"abc short\n" + // not a full node ID
+			id + " \n",
+	})
+	m, err := readBookmarks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]vcs.CommitID{
+		"feature":    vcs.CommitID(id),
+		"with space": vcs.CommitID(fmt.Sprintf("%040x", 2)),
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v, want %v", m, want)
+	}
+}
+
+func TestRepository_Bookmarks(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2", "commit3")
+		// The "default" bookmark is shadowed by the branch of the same
+		// name.
+		writeTestFiles(t, dir, map[string]string{
+			".hg/bookmarks": ids[1] + " feature\n" + ids[0] + " default\n",
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	bs, err := r.Bookmarks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBookmarks := []*Bookmark{
+		{Name: "default", CommitID: vcs.CommitID(ids[0])},
+		{Name: "feature", CommitID: vcs.CommitID(ids[1])},
+	}
+	if !reflect.DeepEqual(bs, wantBookmarks) {
+		t.Errorf("got bookmarks %+v, want %+v", bs, wantBookmarks)
+	}
+
+	if id, err := r.ResolveBookmark("feature"); err != nil {
+		t.Fatal(err)
+	} else if id != vcs.CommitID(ids[1]) {
+		t.Errorf("ResolveBookmark: got %s, want %s", id, ids[1])
+	}
+	if _, err := r.ResolveBookmark("doesntexist"); err != vcs.ErrBookmarkNotFound {
+		t.Errorf("ResolveBookmark doesntexist: got error %v, want %v", err, vcs.ErrBookmarkNotFound)
+	}
+
+	tests := map[string]struct {
+		id   string
+		kind vcs.RefKind
+	}{
+		"feature":   {ids[1], vcs.RefKindBookmark},
+		"feature~1": {ids[0], vcs.RefKindCommit},
+		"default":   {ids[2], vcs.RefKindBranch},
+	}
+	for spec, test := range tests {
+		id, kind, _, err := r.ResolveRevisionDetailed(spec)
+		if err != nil {
+			t.Errorf("%s: %s", spec, err)
+			continue
+		}
+		if id != vcs.CommitID(test.id) || kind != test.kind {
+			t.Errorf("%s: got %s (%s), want %s (%s)", spec, id, kind, test.id, test.kind)
+		}
+	}
+
+	if commit, err := r.GetCommitFromSpec("feature"); err != nil {
+		t.Fatal(err)
+	} else if commit.ID != vcs.CommitID(ids[1]) {
+		t.Errorf("GetCommitFromSpec: got %s, want %s", commit.ID, ids[1])
+	}
+}
@@ -0,0 +1,178 @@
+package hg
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// A branchHead is a head of a named branch: a commit on the branch
+// that has no children on the same branch.
+type branchHead struct {
+	rec    *hg_revlog.Rec
+	closed bool // whether the head was committed with --close-branch
+}
+
+// allBranchHeads returns the heads of each named branch, newest
+// first. Unlike the branchHeads (which is read from hg's branch cache
+// and has a single head per branch), it includes every head of every
+// branch. It is computed by walking the entire changelog the first
+// time it is needed, which reads every changeset, so its cost is
+// proportional to the size of the history; the result is cached in
+// st until the repository is refreshed, and it must not be modified.
+func (st *repoState) allBranchHeads() (map[string][]branchHead, error) {
+	st.allHeadsOnce.Do(func() {
+		st.allHeads, st.allHeadsErr = computeBranchHeads(st.cl)
+	})
+	return st.allHeads, st.allHeadsErr
+}
+
+// computeBranchHeads returns the heads of each named branch in the
+// changelog cl (see allBranchHeads).
+func computeBranchHeads(cl *hg_revlog.Index) (map[string][]branchHead, error) {
+	tip := cl.Tip()
+	if tip == nil || tip.FileRev() < 0 {
+		return map[string][]branchHead{}, nil
+	}
+
+	branchOf := make([]string, tip.FileRev()+1)
+	heads := map[string]map[int]branchHead{}
+	for rev := 0; rev <= tip.FileRev(); rev++ {
+		rec, err := hg_revlog.FileRevSpec(rev).Lookup(cl)
+		if err != nil {
+			return nil, err
+		}
+		cs, err := readChangeset(rec)
+		if err != nil {
+			return nil, err
+		}
+
+		branch := cs.branch()
+		branchOf[rev] = branch
+		if heads[branch] == nil {
+			heads[branch] = map[int]branchHead{}
+		}
+		heads[branch][rev] = branchHead{rec: rec, closed: cs.Extra["close"] != ""}
+		for _, p := range parentRecs(rec) {
+			if branchOf[p.FileRev()] == branch {
+				delete(heads[branch], p.FileRev())
+			}
+		}
+	}
+
+	m := make(map[string][]branchHead, len(heads))
+	for branch, hs := range heads {
+		revs := make([]int, 0, len(hs))
+		for rev := range hs {
+			revs = append(revs, rev)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(revs)))
+		for _, rev := range revs {
+			m[branch] = append(m[branch], hs[rev])
+		}
+	}
+	return m, nil
+}
+
+// BranchHeads returns the open heads of the named branch, newest
+// first. A branch with more than one open head needs a merge. Heads
+// closed with `hg commit --close-branch` are omitted, so a branch
+// whose heads are all closed has no heads. If no such branch exists,
+// ErrBranchNotFound is returned.
+func (r *Repository) BranchHeads(name string) ([]vcs.CommitID, error) {
+	all, err := r.state().allBranchHeads()
+	if err != nil {
+		return nil, err
+	}
+	heads, ok := all[name]
+	if !ok {
+		return nil, vcs.ErrBranchNotFound
+	}
+
+	var ids []vcs.CommitID
+	for _, h := range heads {
+		if !h.closed {
+			ids = append(ids, vcs.CommitID(hex.EncodeToString(h.rec.Id())))
+		}
+	}
+	return ids, nil
+}
+
+// headClosed reports whether the commit was committed with
+// --close-branch.
+func (r *Repository) headClosed(id vcs.CommitID) (bool, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return false, err
+	}
+	cs, err := readChangeset(rec)
+	if err != nil {
+		return false, err
+	}
+	return cs.Extra["close"] != "", nil
+}
+
+// allClosed reports whether every head in heads is closed, which
+// makes their branch closed.
+func allClosed(heads []branchHead) bool {
+	for _, h := range heads {
+		if !h.closed {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultBranch returns the name of the repository's default branch:
+// the branch that the empty revision spec resolves to. hg has no
+// setting for it, so it is chosen heuristically:
+//
+//   - the branch set by default-branch in the [go-vcs] section of the
+//     repository's .hg/hgrc, if that branch exists;
+//   - otherwise "default", if that branch exists (or the repository
+//     has no branches);
+//   - otherwise the branch whose cached head is the newest commit,
+//     preferring branches whose head isn't closed.
+func (r *Repository) DefaultBranch() (string, error) {
+	if err := r.refreshIfStale(); err != nil {
+		return "", err
+	}
+	return r.defaultBranch(r.state())
+}
+
+func (r *Repository) defaultBranch(st *repoState) (string, error) {
+	if st.branchHeadsErr != nil {
+		return "", st.branchHeadsErr
+	}
+	heads := st.branchHeads.IdByName
+	name, err := readConfig(filepath.Join(r.Dir, ".hg", "hgrc"), "go-vcs", "default-branch")
+	if err != nil {
+		return "", err
+	}
+	if _, ok := heads[name]; ok {
+		return name, nil
+	}
+	if _, ok := heads["default"]; ok || len(heads) == 0 {
+		return "default", nil
+	}
+
+	var newest string
+	newestRev, newestClosed := -1, true
+	for branch, id := range heads {
+		rec, err := hg_revlog.NodeIdRevSpec(id).Lookup(st.cl)
+		if err != nil {
+			return "", err
+		}
+		closed, err := r.headClosed(vcs.CommitID(id))
+		if err != nil {
+			return "", err
+		}
+		if (newestClosed && !closed) || (closed == newestClosed && rec.FileRev() > newestRev) {
+			newest, newestRev, newestClosed = branch, rec.FileRev(), closed
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,92 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// branchCommits are the commits of a repository with several heads
+// on the default branch (1 and 2 are open, and 3 is closed) and a
+// branch, feature, whose only head (5) is closed.
+var branchCommits = []testCommit{
+	{message: "root"},
+	{parents: []int{0}, message: "a"},
+	{parents: []int{0}, message: "b"},
+	{parents: []int{0}, extra: "close:1", message: "closed"},
+	{parents: []int{0}, extra: "branch:feature", message: "feature"},
+	{parents: []int{4}, extra: "branch:feature\x00close:1", message: "close feature"},
+}
+
+func TestRepository_BranchHeads(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepoCommits(t, dir, branchCommits)
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string][]int{
+		"default": {2, 1}, // newest first, without the closed head
+		"feature": nil,
+	}
+	for name, want := range tests {
+		heads, err := r.BranchHeads(name)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		var wantIDs []vcs.CommitID
+		for _, rev := range want {
+			wantIDs = append(wantIDs, vcs.CommitID(ids[rev]))
+		}
+		if !reflect.DeepEqual(heads, wantIDs) {
+			t.Errorf("%s: got heads %v, want %v", name, heads, wantIDs)
+		}
+	}
+	if _, err := r.BranchHeads("doesntexist"); err != vcs.ErrBranchNotFound {
+		t.Errorf("nonexistent branch: got error %v, want %v", err, vcs.ErrBranchNotFound)
+	}
+
+	// The heads are computed once and cached until the repository is
+	// refreshed.
+	if r.state().allHeads == nil {
+		t.Error("heads of all branches weren't cached")
+	}
+	commits := append(append([]testCommit(nil), branchCommits...), testCommit{parents: []int{1, 2}, message: "merge"})
+	ids = writeTestRepoCommits(t, dir, commits)
+	if heads, err := r.BranchHeads("default"); err != nil || len(heads) != 2 {
+		t.Errorf("before Refresh: got heads %v, %v, want the 2 cached heads", heads, err)
+	}
+	if err := r.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	heads, err := r.BranchHeads("default")
+	if want := []vcs.CommitID{vcs.CommitID(ids[6])}; err != nil || !reflect.DeepEqual(heads, want) {
+		t.Errorf("after Refresh: got heads %v, %v, want %v", heads, err, want)
+	}
+}
+
+func TestRepository_Branches_closed(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepoCommits(t, dir, branchCommits)
+	})
+	defer os.RemoveAll(dir)
+
+	branches, err := r.Branches(vcs.BranchesOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The branch cache's head of default (3) is closed, but default
+	// isn't, because its other heads are open. All of feature's heads
+	// are closed.
+	want := []*vcs.Branch{
+		{Name: "default", Head: vcs.CommitID(ids[3])},
+		{Name: "feature", Head: vcs.CommitID(ids[5]), Closed: true},
+	}
+	if !reflect.DeepEqual(branches, want) {
+		t.Errorf("got branches %v, want %v", branches, want)
+	}
+}
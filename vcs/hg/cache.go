@@ -0,0 +1,220 @@
+package hg
+
+import (
+	"container/list"
+	"sync"
+
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// lruCache is a size-bounded cache that evicts the least recently
+// used entries. It is safe for concurrent use.
+type lruCache struct {
+	mu    sync.Mutex
+	max   int // maximum number of entries to keep (0 disables caching)
+	ll    *list.List
+	items map[interface{}]*list.Element
+
+	// maxBytes, if positive, is the maximum total size of the entries
+	// to keep (as given to addSized), and bytes is their total size.
+	maxBytes, bytes int
+}
+
+type lruEntry struct {
+	key, value interface{}
+	size       int
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{max: max, ll: list.New(), items: map[interface{}]*list.Element{}}
+}
+
+func (c *lruCache) get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*lruEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *lruCache) add(key, value interface{}) { c.addSized(key, value, 0) }
+
+// addSized adds an entry whose size (counted against c.maxBytes) is
+// size.
+func (c *lruCache) addSized(key, value interface{}, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		ent := e.Value.(*lruEntry)
+		c.bytes += size - ent.size
+		ent.value, ent.size = value, size
+		c.ll.MoveToFront(e)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, size: size})
+		c.bytes += size
+	}
+	c.evict()
+}
+
+// removeIf removes the entries for which f returns true.
+func (c *lruCache) removeIf(f func(key, value interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if ent := e.Value.(*lruEntry); f(ent.key, ent.value) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// setMax sets the maximum number of entries, evicting entries as
+// needed.
+func (c *lruCache) setMax(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+	c.evict()
+}
+
+func (c *lruCache) evict() {
+	for c.ll.Len() > c.max || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lruCache) remove(e *list.Element) {
+	ent := e.Value.(*lruEntry)
+	c.ll.Remove(e)
+	delete(c.items, ent.key)
+	c.bytes -= ent.size
+}
+
+// defaultManifestCacheSize is the number of manifests that a
+// repository's FileSystems keep in their shared cache by default.
+const defaultManifestCacheSize = 16
+
+// manifestCache is a cache of built manifests, keyed by the node ID
+// of their changeset (not its revision number, which a strip followed
+// by a Refresh can give to another changeset). It is shared by all
+// FileSystems of a repository, so that FileSystems at the same (or a
+// previously visited) commit reuse the manifest instead of rebuilding
+// it. The cached manifests must not be modified.
+type manifestCache struct{ lru *lruCache }
+
+func newManifestCache(max int) *manifestCache {
+	return &manifestCache{newLRUCache(max)}
+}
+
+// get returns the cached manifest for the changeset whose node ID is
+// node, if any.
+func (c *manifestCache) get(node []byte) (hg_store.Manifest, bool) {
+	m, ok := c.lru.get(string(node))
+	if !ok {
+		return nil, false
+	}
+	return m.(hg_store.Manifest), true
+}
+
+// add adds the manifest m for the changeset whose node ID is node to
+// the cache, evicting the least recently used manifests if the cache
+// is full.
+func (c *manifestCache) add(node []byte, m hg_store.Manifest) { c.lru.add(string(node), m) }
+
+// setMax sets the maximum number of cached manifests, evicting
+// manifests as needed.
+func (c *manifestCache) setMax(max int) { c.lru.setMax(max) }
+
+// SetManifestCacheSize sets the number of built manifests that the
+// repository's FileSystems share in a cache (by default, 16). When
+// several FileSystems are used to compare files across commits, or
+// when the repository is accessed repeatedly at the same commits, the
+// cached manifests are reused instead of being rebuilt from the
+// manifest revlog. A size of 0 disables the cache.
+func (r *Repository) SetManifestCacheSize(n int) {
+	r.manifests.setMax(n)
+}
+
+// defaultBlobCacheBytes is the maximum total size of the file contents
+// that each FileSystem keeps in its blob cache.
+const defaultBlobCacheBytes = 4 << 20 // 4 MB
+
+// blobCache is a cache of file contents, keyed by the node ID of the
+// file revision (which determines its contents), bounded by the total
+// size of the contents. Each FileSystem has its own, so that (e.g.)
+// reading a file after ReadLink or Stat read it (or reading it a
+// second time) doesn't decode the file revision again. The cached
+// contents must not be modified.
+type blobCache struct{ lru *lruCache }
+
+func newBlobCache(maxBytes int) *blobCache {
+	c := &blobCache{newLRUCache(int(^uint(0) >> 1))}
+	c.lru.maxBytes = maxBytes
+	return c
+}
+
+// get returns the cached contents of the file revision with the
+// given node ID, if any.
+func (c *blobCache) get(node string) ([]byte, bool) {
+	data, ok := c.lru.get(node)
+	if !ok {
+		return nil, false
+	}
+	return data.([]byte), true
+}
+
+// add adds the contents of the file revision with the given node ID
+// to the cache, evicting the least recently used contents if the cache
+// is full. Contents larger than the whole cache aren't added.
+func (c *blobCache) add(node string, data []byte) {
+	if len(data) > c.lru.maxBytes {
+		return
+	}
+	c.lru.addSized(node, data, len(data))
+}
+
+// resolveCache memoizes the results of ResolveRevisionDetailed, keyed
+// by revision spec.
+type resolveCache struct{ lru *lruCache }
+
+type resolution struct {
+	id   vcs.CommitID
+	kind vcs.RefKind
+	name string
+
+	// immutable is whether the spec always resolves to the same
+	// commit (i.e., it is a full commit ID), so the resolution
+	// remains valid after a refresh.
+	immutable bool
+}
+
+func (c *resolveCache) get(spec string) (resolution, bool) {
+	res, ok := c.lru.get(spec)
+	if !ok {
+		return resolution{}, false
+	}
+	return res.(resolution), true
+}
+
+func (c *resolveCache) add(spec string, res resolution) { c.lru.add(spec, res) }
+
+// invalidate removes the resolutions that may have changed, i.e., all
+// but those of full commit IDs.
+func (c *resolveCache) invalidate() {
+	c.lru.removeIf(func(_, res interface{}) bool { return !res.(resolution).immutable })
+}
+
+// SetResolveCacheSize enables caching of the results of
+// ResolveRevision (and ResolveRevisionDetailed) for up to n revision
+// specs, which saves repeated lookups of frequently resolved branches
+// and tags. Resolutions of branch names, tags, and other specs whose
+// target can change are discarded when the repository is refreshed
+// (see Refresh); resolutions of full commit IDs are kept. A size of 0
+// (the default) disables the cache.
+func (r *Repository) SetResolveCacheSize(n int) {
+	r.resolutions.lru.setMax(n)
+}
@@ -0,0 +1,112 @@
+package hg
+
+import (
+	"os"
+	"testing"
+
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestManifestCache(t *testing.T) {
+	c := newManifestCache(2)
+	m := func(name string) hg_store.Manifest { return hg_store.Manifest{{FileName: name}} }
+	node := func(b byte) []byte { return []byte{b} }
+	c.add(node(1), m("a"))
+	c.add(node(2), m("b"))
+	c.get(node(1)) // 2 is now the least recently used
+	c.add(node(3), m("c"))
+
+	if _, ok := c.get(node(2)); ok {
+		t.Error("node 2: got cached manifest, want evicted")
+	}
+	for b, want := range map[byte]string{1: "a", 3: "c"} {
+		if got, ok := c.get(node(b)); !ok || got[0].FileName != want {
+			t.Errorf("node %d: got %v (cached=%v), want %q", b, got, ok, want)
+		}
+	}
+
+	c.setMax(0)
+	if _, ok := c.get(node(1)); ok {
+		t.Error("after setMax(0): got cached manifest, want none")
+	}
+	c.add(node(4), m("d"))
+	if _, ok := c.get(node(4)); ok {
+		t.Error("after setMax(0): add cached a manifest")
+	}
+}
+
+// TestRepository_Refresh_manifestCache checks that a manifest cached for a
+// commit isn't used for another commit that has the same revision
+// number after history is rewritten (e.g., by a strip) and the
+// repository is refreshed.
+func TestRepository_Refresh_manifestCache(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = writeTestRepoContents(t, dir, map[string]string{"a": "a"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	id = writeTestRepoContents(t, dir, map[string]string{"b": "b"})
+	if err := r.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if fs, err = r.FileSystem(vcs.CommitID(id)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("b"); err != nil {
+		t.Errorf("after refresh: %s", err)
+	}
+	if _, err := fs.Stat("a"); !os.IsNotExist(err) {
+		t.Errorf("after refresh: got Stat(a) error %v, want not exist", err)
+	}
+}
+
+func TestResolveCache_invalidate(t *testing.T) {
+	c := resolveCache{newLRUCache(10)}
+	c.add("default", resolution{id: "a"})
+	c.add("a", resolution{id: "a", immutable: true})
+	c.invalidate()
+
+	if _, ok := c.get("default"); ok {
+		t.Error("default: got cached resolution, want invalidated")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("a: got no cached resolution, want kept")
+	}
+}
+
+func TestBlobCache(t *testing.T) {
+	c := newBlobCache(10)
+	c.add("a", []byte("aaaa"))
+	c.add("b", []byte("bbbb"))
+	c.get("a") // b is now the least recently used
+	c.add("c", []byte("cccc"))
+
+	if _, ok := c.get("b"); ok {
+		t.Error("b: got cached contents, want evicted")
+	}
+	for node, want := range map[string]string{"a": "aaaa", "c": "cccc"} {
+		if got, ok := c.get(node); !ok || string(got) != want {
+			t.Errorf("%s: got %q (cached=%v), want %q", node, got, ok, want)
+		}
+	}
+	if c.lru.bytes != 8 {
+		t.Errorf("got %d bytes cached, want 8", c.lru.bytes)
+	}
+
+	c.add("d", []byte("ddddddddddd"))
+	if _, ok := c.get("d"); ok {
+		t.Error("d: contents larger than the cache were cached")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("a: evicted by contents larger than the cache")
+	}
+}
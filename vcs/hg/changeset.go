@@ -0,0 +1,220 @@
+package hg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+	"sourcegraph.com/sqs/pbtypes"
+)
+
+// A changeset is a changelog entry parsed from its raw revlog
+// text. Unlike hg_changelog.Entry, it retains the "extra" fields
+// (branch name, close markers, conversion metadata, etc.).
+type changeset struct {
+	ManifestNode string
+	User         string
+	Date         time.Time
+	Extra        map[string]string
+	Files        []string
+	Description  string
+}
+
+var errMalformedChangeset = errors.New("malformed changeset")
+
+// readChangeset reads and parses the changelog entry for rec. If the
+// entry can't be read or parsed, the error is a
+// *CorruptRepositoryError.
+func readChangeset(rec *hg_revlog.Rec) (*changeset, error) {
+	data, err := buildChangeset(rec)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := parseChangeset(data)
+	if err != nil {
+		return nil, &CorruptRepositoryError{Rev: rec.FileRev(), Err: err}
+	}
+	return cs, nil
+}
+
+// buildChangeset returns the raw text of the changelog entry for rec.
+// If it can't be read, the error is a *CorruptRepositoryError.
+func buildChangeset(rec *hg_revlog.Rec) (data []byte, err error) {
+	rev := rec.FileRev()
+	defer recoverCorrupt(&rev, &err)
+
+	data, err = hg_revlog.NewFileBuilder().Build(rec)
+	if err != nil {
+		return nil, &CorruptRepositoryError{Rev: rev, Err: err}
+	}
+	return data, nil
+}
+
+// parseChangeset parses the raw text of a changelog entry, which
+// has the form:
+//
+//	<manifest node>\n
+//	<user>\n
+//	<unix time> <tz offset>[ <extra>]\n
+//	<file>\n
+//	...
+//	\n
+//	<description>
+//
+// The extra field is a "\0"-separated list of escaped key:value
+// pairs.
+func parseChangeset(data []byte) (*changeset, error) {
+	var cs changeset
+
+	header, desc := data, []byte(nil)
+	if i := bytes.Index(data, []byte("\n\n")); i != -1 {
+		header, desc = data[:i], data[i+2:]
+	}
+	cs.Description = string(desc)
+
+	lines := strings.Split(string(header), "\n")
+	if len(lines) < 3 {
+		return nil, errMalformedChangeset
+	}
+	cs.ManifestNode = lines[0]
+	cs.User = lines[1]
+	cs.Files = lines[3:]
+
+	f := strings.SplitN(lines[2], " ", 3)
+	if len(f) < 2 {
+		return nil, errMalformedChangeset
+	}
+	date, err := parseDate(f[0], f[1])
+	if err != nil {
+		return nil, err
+	}
+	cs.Date = date
+
+	cs.Extra = map[string]string{}
+	if len(f) == 3 {
+		for _, kv := range strings.Split(f[2], "\x00") {
+			kv = unescapeExtra(kv)
+			if i := strings.Index(kv, ":"); i != -1 {
+				cs.Extra[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+
+	return &cs, nil
+}
+
+// parseDate parses an hg date, which is a unix timestamp and a
+// timezone offset in seconds west of UTC.
+func parseDate(unix, tz string) (time.Time, error) {
+	sec, err := strconv.ParseFloat(unix, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed changeset date %q: %s", unix, err)
+	}
+	off, err := strconv.Atoi(tz)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed changeset timezone %q: %s", tz, err)
+	}
+	return time.Unix(int64(sec), 0).In(time.FixedZone("", -off)), nil
+}
+
+// unescapeExtra reverses the escaping that hg applies to each
+// key:value pair in the changeset extra field.
+func unescapeExtra(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case '0':
+			buf.WriteByte(0)
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String()
+}
+
+// parseSignature parses an hg user string (usually "Name <email>")
+// into a signature. hg doesn't validate user strings, so if user
+// isn't an RFC 5322 address, it falls back to hg's own rule (see
+// `hg help templates`, "person" and "email"): the email is the text
+// between "<" and ">" (if any) and the name is the text before "<".
+// A user without "<" (e.g., "jdoe") is used as the name, with an
+// empty email.
+func parseSignature(user string, date time.Time) vcs.Signature {
+	var name, email string
+	if addr, err := mail.ParseAddress(user); err == nil {
+		name, email = addr.Name, addr.Address
+	} else {
+		name = strings.TrimSpace(user)
+		if i := strings.Index(name, "<"); i >= 0 {
+			name, email = strings.TrimSpace(name[:i]), name[i+1:]
+			if j := strings.Index(email, ">"); j >= 0 {
+				email = email[:j]
+			}
+			email = strings.TrimSpace(email)
+		}
+	}
+	return vcs.Signature{Name: name, Email: email, Date: pbtypes.NewTimestamp(date)}
+}
+
+// committer returns the committer of the changeset. Mercurial only
+// records a single user per changeset, but repositories converted
+// from git (e.g., by hg-git) store a distinct git committer in the
+// "committer" extra field as "Name <email> <unix time> <tz
+// offset>". If that field is absent, the author is returned.
+func (cs *changeset) committer() vcs.Signature {
+	c, ok := cs.Extra["committer"]
+	if !ok {
+		return parseSignature(cs.User, cs.Date)
+	}
+
+	date := cs.Date
+	if f := strings.Fields(c); len(f) >= 3 {
+		if d, err := parseDate(f[len(f)-2], f[len(f)-1]); err == nil {
+			c, date = strings.Join(f[:len(f)-2], " "), d
+		}
+	}
+	return parseSignature(c, date)
+}
+
+// branch returns the name of the branch the changeset was committed
+// on. Changesets on the default branch have no "branch" extra field.
+func (cs *changeset) branch() string {
+	if b := cs.Extra["branch"]; b != "" {
+		return b
+	}
+	return "default"
+}
+
+// CommitTrailers returns the trailers (such as "Co-authored-by" and
+// "Signed-off-by") in the last paragraph of the commit's message,
+// keyed by trailer key. The trailer block is recognized using the same
+// rules as `git interpret-trailers`. If the message has no trailers,
+// an empty map is returned.
+func (r *Repository) CommitTrailers(id vcs.CommitID) (map[string][]string, error) {
+	c, err := r.GetCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	return internal.ParseTrailers(c.Message), nil
+}
@@ -0,0 +1,172 @@
+package hg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sqs/pbtypes"
+)
+
+func TestParseChangeset(t *testing.T) {
+	data := []byte("1e9d3a3e0e1c1a6bd1b5fa4420a1ed7a2ea2a8cb\n" +
+		"a <a@a.com>\n" +
+		"1165411109 0 branch:stable\x00close:1\x00note:a\\nb\n" +
+		"f\n" +
+		"g/h\n" +
+		"\n" +
+		"foo\n\nbar")
+
+	cs, err := parseChangeset(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &changeset{
+		ManifestNode: "1e9d3a3e0e1c1a6bd1b5fa4420a1ed7a2ea2a8cb",
+		User:         "a <a@a.com>",
+		Date:         time.Unix(1165411109, 0).In(time.FixedZone("", 0)),
+		Extra:        map[string]string{"branch": "stable", "close": "1", "note": "a\nb"},
+		Files:        []string{"f", "g/h"},
+		Description:  "foo\n\nbar",
+	}
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("got changeset %+v, want %+v", cs, want)
+	}
+}
+
+func TestChangeset_committer(t *testing.T) {
+	authorDate := time.Unix(1165411109, 0)
+	tests := map[string]struct {
+		extra map[string]string
+		want  vcs.Signature
+	}{
+		"no committer extra": {
+			extra: map[string]string{},
+			want:  vcs.Signature{Name: "a", Email: "a@a.com", Date: pbtypes.NewTimestamp(authorDate)},
+		},
+		"converted from git": {
+			extra: map[string]string{"committer": "c <c@c.com> 1165411110 -3600"},
+			want:  vcs.Signature{Name: "c", Email: "c@c.com", Date: pbtypes.NewTimestamp(time.Unix(1165411110, 0))},
+		},
+		"committer without date": {
+			extra: map[string]string{"committer": "c <c@c.com>"},
+			want:  vcs.Signature{Name: "c", Email: "c@c.com", Date: pbtypes.NewTimestamp(authorDate)},
+		},
+	}
+	for label, test := range tests {
+		cs := &changeset{User: "a <a@a.com>", Date: authorDate, Extra: test.extra}
+		if got := cs.committer(); got != test.want {
+			t.Errorf("%s: got committer %+v, want %+v", label, got, test.want)
+		}
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	date := time.Unix(1165411109, 0)
+	tests := map[string]struct{ name, email string }{
+		"a <a@a.com>":          {"a", "a@a.com"},
+		"a@a.com":              {"", "a@a.com"},
+		"noemail":              {"noemail", ""},
+		"John Doe":             {"John Doe", ""},
+		"Jane <>":              {"Jane", ""},
+		"  Spaced Name  ":      {"Spaced Name", ""},
+		"a b <a at a dot com>": {"a b", "a at a dot com"},
+		"a <a@a.com":           {"a", "a@a.com"},
+	}
+	for user, test := range tests {
+		want := vcs.Signature{Name: test.name, Email: test.email, Date: pbtypes.NewTimestamp(date)}
+		if got := parseSignature(user, date); got != want {
+			t.Errorf("%q: got %+v, want %+v", user, got, want)
+		}
+	}
+}
+
+func TestRepository_GetCommit_branch(t *testing.T) {
+	var nodes [][]byte
+	r, dir := makeTestRepo(t, func(dir string) {
+		texts := []string{
+			fmt.Sprintf("%040x\na <a@a.com>\n1136214245 0\n\non default", 0),
+			fmt.Sprintf("%040x\na <a@a.com>\n1136214246 0 branch:stable\x00close:1\n\non stable", 0),
+		}
+		var changelog []byte
+		changelog, nodes = buildRevlog(texts, [][]int{nil, {0}})
+		tip := hex.EncodeToString(nodes[1])
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s stable\n", tip, 1, tip),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		branch string
+		extra  map[string]string
+	}{
+		{branch: "default", extra: nil},
+		{branch: "stable", extra: map[string]string{"branch": "stable", "close": "1"}},
+	}
+	for i, test := range tests {
+		commit, err := r.GetCommit(vcs.CommitID(hex.EncodeToString(nodes[i])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit.Branch != test.branch {
+			t.Errorf("commit %d: got Branch %q, want %q", i, commit.Branch, test.branch)
+		}
+		if !reflect.DeepEqual(commit.Extra, test.extra) {
+			t.Errorf("commit %d: got Extra %v, want %v", i, commit.Extra, test.extra)
+		}
+	}
+}
+
+func TestRepository_GetCommit_committer(t *testing.T) {
+	var nodes [][]byte
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 is as converted from git by hg-git, which records the
+		// git committer (who committed an hour after authoring, in
+		// another time zone) in the extra field.
+		texts := []string{
+			fmt.Sprintf("%040x\na <a@a.com>\n1136214245 0\n\nnative", 0),
+			fmt.Sprintf("%040x\na <a@a.com>\n1136214246 0 committer:c <c@c.com> 1136217846 -3600\n\nconverted", 0),
+		}
+		var changelog []byte
+		changelog, nodes = buildRevlog(texts, [][]int{nil, {0}})
+		tip := hex.EncodeToString(nodes[1])
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", tip, 1, tip),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		author, committer vcs.Signature
+	}{
+		{
+			author:    vcs.Signature{Name: "a", Email: "a@a.com", Date: pbtypes.NewTimestamp(time.Unix(1136214245, 0))},
+			committer: vcs.Signature{Name: "a", Email: "a@a.com", Date: pbtypes.NewTimestamp(time.Unix(1136214245, 0))},
+		},
+		{
+			author:    vcs.Signature{Name: "a", Email: "a@a.com", Date: pbtypes.NewTimestamp(time.Unix(1136214246, 0))},
+			committer: vcs.Signature{Name: "c", Email: "c@c.com", Date: pbtypes.NewTimestamp(time.Unix(1136217846, 0))},
+		},
+	}
+	for i, test := range tests {
+		commit, err := r.GetCommit(vcs.CommitID(hex.EncodeToString(nodes[i])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit.Author != test.author {
+			t.Errorf("commit %d: got Author %+v, want %+v", i, commit.Author, test.author)
+		}
+		if commit.Committer == nil || *commit.Committer != test.committer {
+			t.Errorf("commit %d: got Committer %+v, want %+v", i, commit.Committer, test.committer)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package hg
+
+import (
+	"errors"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// ErrStopCommits may be returned by the function passed to
+// CommitsFunc to stop the walk without CommitsFunc returning an
+// error.
+var ErrStopCommits = errors.New("stop walking commits")
+
+// CommitsFunc calls fn with each commit in the log starting at head,
+// newest first (the same commits, in the same order, as Commits
+// returns with no other options). Each commit is read just before fn
+// is called with it, so unlike Commits, memory use doesn't grow with
+// the length of the log, and a caller that stops early doesn't pay for
+// the rest of it. If fn returns ErrStopCommits, CommitsFunc stops and
+// returns nil; if fn returns any other error, CommitsFunc stops and
+// returns that error.
+//
+// There is no oldest-first variant: the log can only be walked
+// backward from head, so listing it oldest first requires buffering
+// all of it (as CommitsReversed buffers its revision numbers).
+func (r *Repository) CommitsFunc(head vcs.CommitID, fn func(*vcs.Commit) error) error {
+	rec, err := r.getRec(head)
+	if err != nil {
+		return err
+	}
+	w := newLogWalker(rec, nil)
+	for {
+		c, err := r.nextCommit(w)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return nil
+		}
+		if err := fn(c); err == ErrStopCommits {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// nextCommit returns the commit at w's next record, or nil if there
+// are no more.
+func (r *Repository) nextCommit(w *logWalker) (*vcs.Commit, error) {
+	rec := w.next()
+	if rec == nil {
+		return nil, w.err
+	}
+	return r.makeCommit(rec)
+}
@@ -0,0 +1,58 @@
+package hg
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_CommitsFunc(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2", "commit3")
+	})
+	defer os.RemoveAll(dir)
+	head := vcs.CommitID(ids[2])
+
+	var got []vcs.CommitID
+	if err := r.CommitsFunc(head, func(c *vcs.Commit) error {
+		got = append(got, c.ID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	commits, _, err := r.Commits(vcs.CommitsOptions{Head: head})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []vcs.CommitID
+	for _, c := range commits {
+		want = append(want, c.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v (as returned by Commits)", got, want)
+	}
+
+	// Stopping early.
+	got = nil
+	if err := r.CommitsFunc(head, func(c *vcs.Commit) error {
+		got = append(got, c.ID)
+		if len(got) == 2 {
+			return ErrStopCommits
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []vcs.CommitID{vcs.CommitID(ids[2]), vcs.CommitID(ids[1])}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stopped after 2: got %v, want %v", got, want)
+	}
+
+	errTest := errors.New("test")
+	if err := r.CommitsFunc(head, func(*vcs.Commit) error { return errTest }); err != errTest {
+		t.Errorf("got error %v, want %v", err, errTest)
+	}
+}
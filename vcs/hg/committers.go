@@ -0,0 +1,80 @@
+package hg
+
+import (
+	"sort"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// Committers returns the authors of the commits reachable from
+// opt.Rev (or from tip, if opt.Rev is empty) with the number of
+// commits by each, like `git shortlog -sne`. Authors are parsed as by
+// GetCommit, and are distinct if either their names or their emails
+// differ (so authors recorded without an email are grouped by name).
+// They are ordered by decreasing number of commits, then by name and
+// email; if opt.N is positive, only the first opt.N are returned.
+//
+// Every reachable changeset is read, so its cost is proportional to
+// the size of the history.
+func (r *Repository) Committers(opt vcs.CommittersOptions) ([]*vcs.Committer, error) {
+	rev := opt.Rev
+	if rev == "" {
+		rev = "tip"
+	}
+	id, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := r.getRec(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var authors []vcs.Signature
+	for _, rec := range ancestorRecs(rec) {
+		cs, err := readChangeset(rec)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, parseSignature(cs.User, cs.Date))
+	}
+	committers := countCommitters(authors)
+	if opt.N > 0 && len(committers) > opt.N {
+		committers = committers[:opt.N]
+	}
+	return committers, nil
+}
+
+// countCommitters returns the number of commits by each distinct
+// (name, email) pair in authors, ordered as by Committers.
+func countCommitters(authors []vcs.Signature) []*vcs.Committer {
+	type person struct{ name, email string }
+	counts := map[person]*vcs.Committer{}
+	var committers []*vcs.Committer
+	for _, a := range authors {
+		p := person{a.Name, a.Email}
+		c, ok := counts[p]
+		if !ok {
+			c = &vcs.Committer{Name: a.Name, Email: a.Email}
+			counts[p] = c
+			committers = append(committers, c)
+		}
+		c.Commits++
+	}
+	sort.Sort(committersByCount(committers))
+	return committers
+}
+
+type committersByCount []*vcs.Committer
+
+func (v committersByCount) Len() int      { return len(v) }
+func (v committersByCount) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v committersByCount) Less(i, j int) bool {
+	if v[i].Commits != v[j].Commits {
+		return v[i].Commits > v[j].Commits
+	}
+	if v[i].Name != v[j].Name {
+		return v[i].Name < v[j].Name
+	}
+	return v[i].Email < v[j].Email
+}
@@ -0,0 +1,35 @@
+package hg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestCountCommitters(t *testing.T) {
+	var authors []vcs.Signature
+	for _, user := range []string{
+		"a <a@a.com>",
+		"a <a2@a.com>",
+		"b <b@b.com>",
+		"a <a@a.com>",
+		"noemail",
+		"  noemail  ",
+		"b <b@b.com>",
+		"noemail",
+	} {
+		authors = append(authors, parseSignature(user, time.Time{}))
+	}
+
+	want := []*vcs.Committer{
+		{Name: "noemail", Commits: 3},
+		{Name: "a", Email: "a@a.com", Commits: 2},
+		{Name: "b", Email: "b@b.com", Commits: 2},
+		{Name: "a", Email: "a2@a.com", Commits: 1},
+	}
+	if got := countCommitters(authors); !reflect.DeepEqual(got, want) {
+		t.Errorf("got committers %v, want %v", got, want)
+	}
+}
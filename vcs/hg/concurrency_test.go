@@ -0,0 +1,153 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// TestRepository_concurrent calls GetCommit and FileSystem concurrently on
+// the same repository (and ReadDir concurrently on the same
+// FileSystem), so that running it with -race catches shared state
+// that isn't guarded.
+func TestRepository_concurrent(t *testing.T) {
+	var id vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = vcs.CommitID(writeTestRepoTree(t, dir, []string{"a", "b/c", "b/d/e"}))
+	})
+	defer os.RemoveAll(dir)
+	sharedFS, err := r.FileSystem(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 10*n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			commit, err := r.GetCommit(id)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if commit.ID != id {
+				t.Errorf("GetCommit: got ID %q, want %q", commit.ID, id)
+			}
+
+			fs, err := r.FileSystem(id)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, fs := range []vfs.FileSystem{fs, sharedFS} {
+				for _, path := range []string{".", "b", "b/d"} {
+					if _, err := fs.ReadDir(path); err != nil {
+						errs <- err
+					}
+				}
+				if _, err := fs.Lstat("b"); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestRepository_Refresh_concurrent resolves revisions concurrently while
+// commits are appended to the repository, so that the refreshes that
+// ResolveRevision triggers race with the other calls (which -race
+// catches if the repository's state isn't replaced atomically).
+func TestRepository_Refresh_concurrent(t *testing.T) {
+	msgs := []string{"a", "b", "c", "d", "e", "f"}
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, msgs[0])
+	})
+	defer os.RemoveAll(dir)
+	staging, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(staging)
+
+	known := map[vcs.CommitID]bool{}
+	for _, id := range writeTestRepo(t, staging, msgs...) {
+		known[vcs.CommitID(id)] = true
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 10*n)
+	done := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				id, err := r.ResolveRevision(ids[0])
+				if err != nil {
+					errs <- err
+					return
+				}
+				if id != vcs.CommitID(ids[0]) {
+					t.Errorf("ResolveRevision(%q): got %q", ids[0], id)
+				}
+				for _, spec := range []string{"tip", "default"} {
+					id, err := r.ResolveRevision(spec)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if !known[id] {
+						t.Errorf("ResolveRevision(%q): got unknown commit %q", spec, id)
+					}
+				}
+				if _, err := r.Branches(vcs.BranchesOptions{}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	// Append the commits one at a time, renaming each changelog into
+	// place so that it is never seen partly written.
+	for i := 2; i <= len(msgs); i++ {
+		writeTestRepo(t, staging, msgs[:i]...)
+		for _, name := range []string{"store/00changelog.i", "cache/branchheads"} {
+			if err := os.Rename(filepath.Join(staging, ".hg", name), filepath.Join(dir, ".hg", name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if id, err := r.ResolveRevision("tip"); err != nil {
+		t.Fatal(err)
+	} else if want := vcs.CommitID(writeTestRepo(t, staging, msgs...)[len(msgs)-1]); id != want {
+		t.Errorf("got tip %q after the appends, want %q", id, want)
+	}
+}
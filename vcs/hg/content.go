@@ -0,0 +1,114 @@
+package hg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// defaultContentHashCacheSize is the number of content hashes that a
+// repository keeps in its cache.
+const defaultContentHashCacheSize = 1 << 16
+
+// contentHashes caches the SHA-256 hashes of file contents, keyed by
+// file node ID, evicting the least recently used hashes once it holds
+// defaultContentHashCacheSize of them. A file node ID always refers
+// to the same content, so entries never need to be invalidated.
+type contentHashes struct{ lru *lruCache }
+
+func (c *contentHashes) get(node string) (string, bool) {
+	sum, ok := c.lru.get(node)
+	if !ok {
+		return "", false
+	}
+	return sum.(string), true
+}
+
+func (c *contentHashes) add(node, sum string) { c.lru.add(node, sum) }
+
+// ContentSHA256 returns the hex-encoded SHA-256 hash of the contents
+// of the file at path in the given commit. Unlike the file's node ID,
+// which hg computes from the file's parent revisions as well as its
+// contents, the hash depends only on the contents, so it can be used
+// to find identical files across unrelated histories and
+// repositories. The most recently used hashes are cached.
+func (r *Repository) ContentSHA256(commit vcs.CommitID, path string) (string, error) {
+	fs, err := r.fileSystem(commit)
+	if err != nil {
+		return "", err
+	}
+	ent, err := fs.manifestEntry(fs.at, filepath.ToSlash(internal.Rel(path)))
+	if err != nil {
+		return "", standardizeHgError(err)
+	}
+	return r.entrySHA256(fs, ent)
+}
+
+// TreeBlobHashes returns the hex-encoded SHA-256 hash of the contents
+// of every file in the given commit (see ContentSHA256), keyed by
+// path, in a single pass over the commit's manifest. Files that share
+// a node ID (e.g., copies whose contents and history are identical)
+// are hashed only once, and hashes already cached by earlier calls
+// are reused. Otherwise, it reads the contents of every file in the
+// tree, which is expensive for large trees unless the cache is warm.
+func (r *Repository) TreeBlobHashes(commit vcs.CommitID) (map[string]string, error) {
+	return r.TreeBlobHashesContext(context.Background(), commit)
+}
+
+// TreeBlobHashesContext is like TreeBlobHashes, but it stops reading
+// files and returns ctx.Err() if ctx is canceled or its deadline is
+// exceeded.
+func (r *Repository) TreeBlobHashesContext(ctx context.Context, commit vcs.CommitID) (map[string]string, error) {
+	fs, err := r.fileSystem(commit)
+	if err != nil {
+		return nil, err
+	}
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(m))
+	for i := range m {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum, err := r.entrySHA256(fs, &m[i])
+		if err != nil {
+			return nil, err
+		}
+		hashes[m[i].FileName] = sum
+	}
+	return hashes, nil
+}
+
+// entrySHA256 returns the hex-encoded SHA-256 hash of the contents of
+// the manifest entry ent, consulting and updating r.contentHashes.
+func (r *Repository) entrySHA256(fs *hgFSNative, ent *hg_store.ManifestEnt) (string, error) {
+	id, err := ent.Id()
+	if err != nil {
+		return "", err
+	}
+	node := hex.EncodeToString(id)
+
+	if sum, ok := r.contentHashes.get(node); ok {
+		return sum, nil
+	}
+
+	rec, err := fs.entryRec(ent)
+	if err != nil {
+		return "", standardizeHgError(err)
+	}
+	data, err := fs.readFile(rec)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+	r.contentHashes.add(node, sum)
+	return sum, nil
+}
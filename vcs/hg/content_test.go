@@ -0,0 +1,97 @@
+package hg
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestContentHashes(t *testing.T) {
+	c := contentHashes{newLRUCache(1)}
+	c.add("a", "1")
+	c.add("b", "2")
+	if _, ok := c.get("a"); ok {
+		t.Error("a: got cached hash, want evicted")
+	}
+	if sum, ok := c.get("b"); !ok || sum != "2" {
+		t.Errorf("b: got %q (cached=%v), want %q", sum, ok, "2")
+	}
+}
+
+func TestRepository_ContentSHA256(t *testing.T) {
+	var id vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = vcs.CommitID(writeTestRepoContents(t, dir, map[string]string{"a": "hello", "b": "hello", "c": ""}))
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]string{
+		"a":  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"/b": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"c":  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+	for i := 0; i < 2; i++ { // the second time, from the cache
+		for path, want := range tests {
+			got, err := r.ContentSHA256(id, path)
+			if err != nil {
+				t.Errorf("%s: %s", path, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s: got %s, want %s", path, got, want)
+			}
+		}
+	}
+
+	if _, err := r.ContentSHA256(id, "doesntexist"); !os.IsNotExist(err) {
+		t.Errorf("doesntexist: got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestRepository_TreeBlobHashes(t *testing.T) {
+	var id vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = vcs.CommitID(writeTestRepoContents(t, dir, map[string]string{"a": "hello", "d/b": "hello", "c": ""}))
+	})
+	defer os.RemoveAll(dir)
+
+	want := map[string]string{
+		"a":   "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"d/b": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"c":   "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+	for i := 0; i < 2; i++ { // the second time, from the cache
+		hashes, err := r.TreeBlobHashes(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hashes, want) {
+			t.Errorf("got hashes %v, want %v", hashes, want)
+		}
+	}
+
+	if _, err := r.TreeBlobHashes("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_TreeBlobHashesContext_canceled(t *testing.T) {
+	const n = 20
+	r, st, id, dir := openSearchRepo(t, n)
+	defer os.RemoveAll(dir)
+
+	// The context is canceled while the first file is being read, so
+	// the other files aren't read.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st.onOpen = cancel
+	if _, err := r.TreeBlobHashesContext(ctx, vcs.CommitID(id)); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if st.opened != 1 {
+		t.Errorf("got %d files read, want 1", st.opened)
+	}
+}
@@ -0,0 +1,31 @@
+package hg
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_CommitsContext_canceled(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2", "commit3")
+	})
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := r.CommitsContext(ctx, vcs.CommitsOptions{Head: vcs.CommitID(ids[2])}); err != context.Canceled {
+		t.Errorf("CommitsContext: got error %v, want %v", err, context.Canceled)
+	}
+	if _, err := r.SampleCommitsContext(ctx, vcs.CommitID(ids[2]), 1); err != context.Canceled {
+		t.Errorf("SampleCommitsContext: got error %v, want %v", err, context.Canceled)
+	}
+
+	// The variants without a context are unaffected.
+	if commits, _, err := r.Commits(vcs.CommitsOptions{Head: vcs.CommitID(ids[2])}); err != nil || len(commits) != 3 {
+		t.Errorf("Commits: got %d commits, %v, want 3 commits", len(commits), err)
+	}
+}
@@ -0,0 +1,30 @@
+package hg
+
+import "fmt"
+
+// A CorruptRepositoryError is returned when a changelog revision
+// can't be read, because the revlog is truncated or otherwise
+// malformed.
+type CorruptRepositoryError struct {
+	Rev int   // changelog revision number of the unreadable revision
+	Err error // underlying error
+}
+
+func (e *CorruptRepositoryError) Error() string {
+	return fmt.Sprintf("corrupt hg repository: changelog revision %d: %s", e.Rev, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *CorruptRepositoryError) Unwrap() error { return e.Err }
+
+// recoverCorrupt recovers from a panic (which hgo may raise when it
+// reads malformed revlog data) and stores it in *err as a
+// *CorruptRepositoryError for changelog revision *rev. It must be
+// called directly by a deferred statement, in a function that does
+// nothing but call into hgo, so that panics caused by bugs in this
+// package aren't reported as corruption.
+func recoverCorrupt(rev *int, err *error) {
+	if e := recover(); e != nil {
+		*err = &CorruptRepositoryError{Rev: *rev, Err: fmt.Errorf("%v", e)}
+	}
+}
@@ -0,0 +1,60 @@
+package hg
+
+import (
+	"errors"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRecoverCorrupt(t *testing.T) {
+	read := func() (err error) {
+		rev := 3
+		defer recoverCorrupt(&rev, &err)
+		rev--
+		panic("index out of range")
+	}
+	err := read()
+	if e, ok := err.(*CorruptRepositoryError); !ok || e.Rev != 2 {
+		t.Errorf("got error %v (%T), want *CorruptRepositoryError for rev 2", err, err)
+	} else if err := e.Unwrap(); err == nil || err.Error() != "index out of range" {
+		t.Errorf("got unwrapped error %v, want the panic value", err)
+	}
+
+	noPanic := func() (err error) {
+		rev := 3
+		defer recoverCorrupt(&rev, &err)
+		return errors.New("x")
+	}
+	if err := noPanic(); err == nil || err.Error() != "x" {
+		t.Errorf("got error %v, want unchanged error", err)
+	}
+}
+
+// testdata/truncated is a repository with two commits whose changelog
+// was truncated partway through the data of the second commit (rev 1).
+const (
+	truncatedRev0 = "77e1da7aad51d5a3a2f8138334f46b9f641f3e86"
+	truncatedRev1 = "7618fbb5c3659bb160090ee941a4252dbe1c722c"
+)
+
+func TestRepository_truncatedChangelog(t *testing.T) {
+	r, err := Open("testdata/truncated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.GetCommit(truncatedRev0); err != nil {
+		t.Errorf("GetCommit(rev 0): %s", err)
+	}
+
+	checkCorrupt := func(label string, err error) {
+		if e, ok := err.(*CorruptRepositoryError); !ok || e.Rev != 1 {
+			t.Errorf("%s: got error %v (%T), want *CorruptRepositoryError for rev 1", label, err, err)
+		}
+	}
+	_, err = r.GetCommit(truncatedRev1)
+	checkCorrupt("GetCommit(rev 1)", err)
+	_, _, err = r.Commits(vcs.CommitsOptions{Head: truncatedRev1})
+	checkCorrupt("Commits(rev 1)", err)
+}
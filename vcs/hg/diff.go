@@ -0,0 +1,375 @@
+package hg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-diff/diff"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// CommitLineChanges returns the number of lines added and removed by
+// the commit, summed over all of the files it changed, compared to its
+// first parent (or to the empty tree, for a root commit). Binary files
+// are not counted.
+func (r *Repository) CommitLineChanges(id vcs.CommitID) (added, removed int, err error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Use hg's first parent (p1), which Commit.Parents doesn't list
+	// first if CanonicalParentOrder is set.
+	base := NullCommitID
+	if ps := parentRecs(rec); len(ps) > 0 {
+		base = vcs.CommitID(hex.EncodeToString(ps[0].Id()))
+	}
+
+	d, err := r.Diff(base, id, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	fdiffs, err := diff.ParseMultiFileDiff([]byte(d.Raw))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, fd := range fdiffs {
+		// Binary files have no hunks.
+		for _, h := range fd.Hunks {
+			for _, line := range bytes.Split(h.Body, []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				switch line[0] {
+				case '+':
+					added++
+				case '-':
+					removed++
+				}
+			}
+		}
+	}
+	return added, removed, nil
+}
+
+// CommitDiffFunc calls fn with the diff of each file changed by the
+// commit (compared to its first parent, or to the empty tree for a
+// root commit), in path order. Each file's diff is computed just
+// before fn is called with it, so memory use doesn't grow with the
+// size of the commit (but the two manifests are read only once). Only
+// opt's OrigPrefix, NewPrefix, ContextLines, WordDiff, and Paths
+// options are used; files that don't match Paths are skipped. If fn
+// returns an error, CommitDiffFunc stops and returns that error.
+func (r *Repository) CommitDiffFunc(id vcs.CommitID, opt *vcs.DiffOptions, fn func(*vcs.FileChange) error) error {
+	if opt == nil {
+		opt = &vcs.DiffOptions{}
+	}
+	context := opt.ContextLines
+	if context <= 0 {
+		context = defaultDiffContext
+	}
+
+	changes, base, err := r.fileChanges(id)
+	if err != nil {
+		return err
+	}
+	baseFS, baseM, err := r.diffSide(base)
+	if err != nil {
+		return err
+	}
+	headFS, headM, err := r.diffSide(id)
+	if err != nil {
+		return err
+	}
+
+	baseEnts, headEnts := baseM.Map(), headM.Map()
+	for _, c := range changes {
+		if !matchesPaths(opt.Paths, c.Path) {
+			continue
+		}
+		a, err := diffFileData(baseFS, baseEnts[c.Path])
+		if err != nil {
+			return err
+		}
+		b, err := diffFileData(headFS, headEnts[c.Path])
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		writeFileDiff(&out, c.Path, opt, baseEnts[c.Path], headEnts[c.Path], a, b, context)
+		raw := out.Bytes()
+		if opt.WordDiff {
+			raw = internal.WordDiff(raw)
+		}
+		c.Diff = &vcs.Diff{Raw: string(raw)}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangedFiles returns the files added, modified, or removed by the
+// commit, sorted by path. Only the commit's and its parent's manifests
+// are read, not the files. A merge commit is compared to its first
+// parent (p1), like `hg status --change`, so the files changed on the
+// merged branch are included; a root commit is compared to the empty
+// tree, so all of its files are added.
+func (r *Repository) ChangedFiles(id vcs.CommitID) ([]*vcs.FileChange, error) {
+	changes, _, err := r.fileChanges(id)
+	return changes, err
+}
+
+// fileChanges returns the files changed by the commit compared to its
+// first parent (or to the empty tree), sorted by path, and the ID of
+// the commit they were compared to.
+func (r *Repository) fileChanges(id vcs.CommitID) ([]*vcs.FileChange, vcs.CommitID, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return nil, "", err
+	}
+	m, err := r.manifest(rec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	base := NullCommitID
+	var parentM hg_store.Manifest
+	if ps := parentRecs(rec); len(ps) > 0 {
+		base = vcs.CommitID(hex.EncodeToString(ps[0].Id()))
+		if parentM, err = r.manifest(ps[0]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ents, parentEnts := m.Map(), parentM.Map()
+	var paths []string
+	for path := range changedPaths(parentM, m) {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	changes := make([]*vcs.FileChange, len(paths))
+	for i, path := range paths {
+		status := vcs.FileModified
+		if parentEnts[path] == nil {
+			status = vcs.FileAdded
+		} else if ents[path] == nil {
+			status = vcs.FileRemoved
+		}
+		changes[i] = &vcs.FileChange{Path: path, Status: status}
+	}
+	return changes, base, nil
+}
+
+// TreeChanged reports whether the commit's tree differs from its
+// first parent's, by comparing their manifest node IDs (so no
+// manifests or files are read). A root commit's tree is always
+// considered changed. A commit can leave the tree unchanged if, for
+// example, it only closes a branch or changes the branch name.
+func (r *Repository) TreeChanged(id vcs.CommitID) (bool, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return false, err
+	}
+	ps := parentRecs(rec)
+	if len(ps) == 0 {
+		return true, nil
+	}
+	cs, err := readChangeset(rec)
+	if err != nil {
+		return false, err
+	}
+	pcs, err := readChangeset(ps[0])
+	if err != nil {
+		return false, err
+	}
+	return cs.ManifestNode != pcs.ManifestNode, nil
+}
+
+// defaultDiffContext is the number of lines of context in diffs when
+// DiffOptions.ContextLines isn't set.
+const defaultDiffContext = 3
+
+// Diff returns the diff from base to head in the git-style format of
+// `hg diff --git`, computed natively by comparing the two commits'
+// manifests and diffing the files that changed. Binary files (those
+// containing a NUL byte) are reported as "Binary files ... differ".
+// The DetectRenames and ExcludeReachableFromBoth options aren't
+// implemented natively, so if either is set, the diff is computed by
+// running `hg diff` instead.
+func (r *Repository) Diff(base, head vcs.CommitID, opt *vcs.DiffOptions) (*vcs.Diff, error) {
+	if opt == nil {
+		opt = &vcs.DiffOptions{}
+	}
+	if opt.DetectRenames || opt.ExcludeReachableFromBoth {
+		return r.Repository.Diff(base, head, opt)
+	}
+	context := opt.ContextLines
+	if context <= 0 {
+		context = defaultDiffContext
+	}
+
+	baseFS, baseM, err := r.diffSide(base)
+	if err != nil {
+		return nil, err
+	}
+	headFS, headM, err := r.diffSide(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for path := range changedPaths(baseM, headM) {
+		if matchesPaths(opt.Paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var out bytes.Buffer
+	baseEnts, headEnts := baseM.Map(), headM.Map()
+	for _, path := range paths {
+		a, err := diffFileData(baseFS, baseEnts[path])
+		if err != nil {
+			return nil, err
+		}
+		b, err := diffFileData(headFS, headEnts[path])
+		if err != nil {
+			return nil, err
+		}
+		writeFileDiff(&out, path, opt, baseEnts[path], headEnts[path], a, b, context)
+	}
+
+	raw := out.Bytes()
+	if opt.WordDiff {
+		raw = internal.WordDiff(raw)
+	}
+	return &vcs.Diff{Raw: string(raw)}, nil
+}
+
+// FileDiff returns the diff of the file at path from base to head (in
+// the same format as the file's part of Diff), for showing a single
+// file's changes. If the file is absent at base, it is diffed as
+// added, and if it is absent at head, as deleted; if it is the same at
+// both (or exists at neither), the returned diff has no hunks. Only
+// opt's OrigPrefix, NewPrefix, and ContextLines options are used.
+func (r *Repository) FileDiff(path string, base, head vcs.CommitID, opt *vcs.DiffOptions) (*diff.FileDiff, error) {
+	if opt == nil {
+		opt = &vcs.DiffOptions{}
+	}
+	path, err := cleanPath("diff", path)
+	if err != nil {
+		return nil, err
+	}
+	context := opt.ContextLines
+	if context <= 0 {
+		context = defaultDiffContext
+	}
+
+	baseFS, baseM, err := r.diffSide(base)
+	if err != nil {
+		return nil, err
+	}
+	headFS, headM, err := r.diffSide(head)
+	if err != nil {
+		return nil, err
+	}
+	baseEnt, headEnt := baseM.Map()[path], headM.Map()[path]
+	if sameEntry(baseEnt, headEnt) {
+		return &diff.FileDiff{OrigName: opt.OrigPrefix + path, NewName: opt.NewPrefix + path}, nil
+	}
+
+	a, err := diffFileData(baseFS, baseEnt)
+	if err != nil {
+		return nil, err
+	}
+	b, err := diffFileData(headFS, headEnt)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	writeFileDiff(&out, path, opt, baseEnt, headEnt, a, b, context)
+	return diff.ParseFileDiff(out.Bytes())
+}
+
+// diffSide returns the FileSystem and manifest of a commit being
+// diffed. Those of NullCommitID are empty.
+func (r *Repository) diffSide(id vcs.CommitID) (*hgFSNative, hg_store.Manifest, error) {
+	fs, err := r.fileSystem(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fs, m, nil
+}
+
+// diffFileData returns the contents of the manifest entry ent, or nil
+// if ent is nil (the file doesn't exist on that side of the diff).
+func diffFileData(fs *hgFSNative, ent *hg_store.ManifestEnt) ([]byte, error) {
+	if ent == nil {
+		return nil, nil
+	}
+	rec, err := fs.entryRec(ent)
+	if err != nil {
+		return nil, err
+	}
+	return fs.readFile(rec)
+}
+
+// writeFileDiff writes the git-style diff of a single file, which is
+// absent on one side of the diff if its entry is nil.
+func writeFileDiff(out *bytes.Buffer, path string, opt *vcs.DiffOptions, baseEnt, headEnt *hg_store.ManifestEnt, a, b []byte, context int) {
+	origName, newName := opt.OrigPrefix+path, opt.NewPrefix+path
+	fmt.Fprintf(out, "diff --git %s %s\n", origName, newName)
+	switch {
+	case baseEnt == nil:
+		fmt.Fprintf(out, "new file mode %s\n", gitFileMode(headEnt))
+		origName = "/dev/null"
+	case headEnt == nil:
+		fmt.Fprintf(out, "deleted file mode %s\n", gitFileMode(baseEnt))
+		newName = "/dev/null"
+	case gitFileMode(baseEnt) != gitFileMode(headEnt):
+		fmt.Fprintf(out, "old mode %s\nnew mode %s\n", gitFileMode(baseEnt), gitFileMode(headEnt))
+	}
+
+	if isBinary(a) || isBinary(b) {
+		if !bytes.Equal(a, b) {
+			fmt.Fprintf(out, "Binary files %s and %s differ\n", origName, newName)
+		}
+		return
+	}
+	if hunks := internal.UnifiedHunks(a, b, context); hunks != nil {
+		fmt.Fprintf(out, "--- %s\n+++ %s\n", origName, newName)
+		out.Write(hunks)
+	}
+}
+
+// gitFileMode returns the git file mode of a manifest entry, as
+// printed in git-style diff headers.
+func gitFileMode(ent *hg_store.ManifestEnt) string {
+	switch {
+	case ent.IsLink():
+		return "120000"
+	case ent.IsExecutable():
+		return "100755"
+	default:
+		return "100644"
+	}
+}
+
+// isBinary reports whether data looks like the contents of a binary
+// file (i.e., it has a NUL byte in its first 8000 bytes, as git
+// checks).
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
@@ -0,0 +1,372 @@
+package hg
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_ChangedFiles(t *testing.T) {
+	var nodes [][]byte
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 modifies a, removes b, and adds c.
+		manifests := []string{
+			fmt.Sprintf("a\x00%040x\nb\x00%040x\n", 1, 2),
+			fmt.Sprintf("a\x00%040x\nc\x00%040x\n", 3, 4),
+		}
+		manifestlog, manifestNodes := buildRevlog(manifests, [][]int{nil, {0}})
+		texts := []string{
+			fmt.Sprintf("%x\na <a@a.com>\n1136214245 0\na\nb\n\nadd a and b", manifestNodes[0]),
+			fmt.Sprintf("%x\na <a@a.com>\n1136214246 0\na\nb\nc\n\nchange a, b, and c", manifestNodes[1]),
+		}
+		var changelog []byte
+		changelog, nodes = buildRevlog(texts, [][]int{nil, {0}})
+		tip := hex.EncodeToString(nodes[1])
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/00manifest.i":  string(manifestlog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", tip, 1, tip),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := [][]*vcs.FileChange{
+		{
+			{Path: "a", Status: vcs.FileAdded},
+			{Path: "b", Status: vcs.FileAdded},
+		},
+		{
+			{Path: "a", Status: vcs.FileModified},
+			{Path: "b", Status: vcs.FileRemoved},
+			{Path: "c", Status: vcs.FileAdded},
+		},
+	}
+	for i, want := range tests {
+		got, err := r.ChangedFiles(vcs.CommitID(hex.EncodeToString(nodes[i])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("commit %d: got %v, want %v", i, got, want)
+		}
+	}
+
+	if _, err := r.ChangedFiles("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_Diff(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 modifies a and the binary file bin, adds d, makes e
+		// executable, and leaves c unchanged.
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{files: map[string]string{"a": "1\n2\n3\n4\n5\n6\n7\n", "bin": "\x00a", "c": "c\n", "e": "e\n"}},
+			{parents: []int{0}, files: map[string]string{"a": "1\n2\n3\nX\n5\n6\n7\n", "bin": "\x00b", "c": "c\n", "d": "d\n", "e\x00x": "e\n"}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	const (
+		diffA   = "diff --git a a\n--- a\n+++ a\n@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+X\n 5\n 6\n 7\n"
+		diffBin = "diff --git bin bin\nBinary files bin and bin differ\n"
+		diffD   = "diff --git d d\nnew file mode 100644\n--- /dev/null\n+++ d\n@@ -0,0 +1 @@\n+d\n"
+		diffE   = "diff --git e e\nold mode 100644\nnew mode 100755\n"
+	)
+	tests := map[string]struct {
+		opt  *vcs.DiffOptions
+		want string
+	}{
+		"all":   {want: diffA + diffBin + diffD + diffE},
+		"paths": {opt: &vcs.DiffOptions{Paths: []string{"bin", "d/"}}, want: diffBin + diffD},
+		"context lines": {
+			opt:  &vcs.DiffOptions{Paths: []string{"a"}, ContextLines: 1},
+			want: "diff --git a a\n--- a\n+++ a\n@@ -3,3 +3,3 @@\n 3\n-4\n+X\n 5\n",
+		},
+		"prefixes": {
+			opt:  &vcs.DiffOptions{Paths: []string{"bin", "d"}, OrigPrefix: "a/", NewPrefix: "b/"},
+			want: "diff --git a/bin b/bin\nBinary files a/bin and b/bin differ\ndiff --git a/d b/d\nnew file mode 100644\n--- /dev/null\n+++ b/d\n@@ -0,0 +1 @@\n+d\n",
+		},
+	}
+	for label, test := range tests {
+		d, err := r.Diff(vcs.CommitID(ids[0]), vcs.CommitID(ids[1]), test.opt)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if d.Raw != test.want {
+			t.Errorf("%s: got diff\n%s\nwant\n%s", label, d.Raw, test.want)
+		}
+	}
+
+	// Diffing a root commit against the null revision adds all of its
+	// files.
+	d, err := r.Diff(NullCommitID, vcs.CommitID(ids[0]), &vcs.DiffOptions{Paths: []string{"c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "diff --git c c\nnew file mode 100644\n--- /dev/null\n+++ c\n@@ -0,0 +1 @@\n+c\n"; d.Raw != want {
+		t.Errorf("root commit: got diff %q, want %q", d.Raw, want)
+	}
+
+	if _, err := r.Diff("0123456789abcdef0123456789abcdef01234567", vcs.CommitID(ids[1]), nil); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent base: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_FileDiff(t *testing.T) {
+	var base, head vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 modifies a, adds b, removes c, and leaves d unchanged.
+		files := map[string][]string{
+			"a": {"1\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\nX\n5\n6\n7\n"},
+			"b": {"new\n"},
+			"c": {"old\n"},
+			"d": {"same\n"},
+		}
+		nodes := map[string][][]byte{}
+		for name, texts := range files {
+			parents := [][]int{nil, {0}}[:len(texts)]
+			filelog, fileNodes := buildRevlog(texts, parents)
+			writeTestFiles(t, dir, map[string]string{".hg/store/data/" + name + ".i": string(filelog)})
+			nodes[name] = fileNodes
+		}
+		manifests := []string{
+			fmt.Sprintf("a\x00%x\nc\x00%x\nd\x00%x\n", nodes["a"][0], nodes["c"][0], nodes["d"][0]),
+			fmt.Sprintf("a\x00%x\nb\x00%x\nd\x00%x\n", nodes["a"][1], nodes["b"][0], nodes["d"][0]),
+		}
+		manifestlog, manifestNodes := buildRevlog(manifests, [][]int{nil, {0}})
+		texts := []string{
+			fmt.Sprintf("%x\na <a@a.com>\n1136214245 0\na\nc\nd\n\ncommit1", manifestNodes[0]),
+			fmt.Sprintf("%x\na <a@a.com>\n1136214246 0\na\nb\nc\n\ncommit2", manifestNodes[1]),
+		}
+		changelog, commitNodes := buildRevlog(texts, [][]int{nil, {0}})
+		base, head = vcs.CommitID(hex.EncodeToString(commitNodes[0])), vcs.CommitID(hex.EncodeToString(commitNodes[1]))
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/00manifest.i":  string(manifestlog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", head, 1, head),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		opt      *vcs.DiffOptions
+		origName string
+		newName  string
+		body     string // of the only hunk (or "" for no hunks)
+	}{
+		"a": {opt: &vcs.DiffOptions{OrigPrefix: "a/", NewPrefix: "b/"}, origName: "a/a", newName: "b/a", body: " 1\n 2\n 3\n-4\n+X\n 5\n 6\n 7\n"},
+		"b": {origName: "/dev/null", newName: "b", body: "+new\n"},
+		"c": {origName: "c", newName: "/dev/null", body: "-old\n"},
+		"d": {origName: "d", newName: "d"},
+	}
+	for path, test := range tests {
+		fd, err := r.FileDiff(path, base, head, test.opt)
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if fd.OrigName != test.origName || fd.NewName != test.newName {
+			t.Errorf("%s: got names %q and %q, want %q and %q", path, fd.OrigName, fd.NewName, test.origName, test.newName)
+		}
+		var body string
+		if len(fd.Hunks) > 1 {
+			t.Errorf("%s: got %d hunks, want at most 1", path, len(fd.Hunks))
+		} else if len(fd.Hunks) == 1 {
+			body = string(fd.Hunks[0].Body)
+		}
+		if body != test.body {
+			t.Errorf("%s: got hunk body %q, want %q", path, body, test.body)
+		}
+	}
+
+	// With less context, the hunk is smaller.
+	fd, err := r.FileDiff("a", base, head, &vcs.DiffOptions{ContextLines: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fd.Hunks) != 1 || string(fd.Hunks[0].Body) != " 3\n-4\n+X\n 5\n" {
+		t.Errorf("ContextLines 1: got hunks %v, want 1 with a line of context", fd.Hunks)
+	}
+}
+
+func TestRepository_CommitDiffFunc(t *testing.T) {
+	var head vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids := writeTestRepoCommits(t, dir, []testCommit{
+			{files: map[string]string{"a": "1\n2\n3\n4\n5\n6\n7\n"}, message: "commit1"},
+			{parents: []int{0}, files: map[string]string{"a": "1\n2\n3\nX\n5\n6\n7\n", "b/c": "c\n"}, message: "commit2"},
+		})
+		head = vcs.CommitID(ids[1])
+	})
+	defer os.RemoveAll(dir)
+
+	const (
+		diffA  = "diff --git a a\n--- a\n+++ a\n@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+X\n 5\n 6\n 7\n"
+		diffBC = "diff --git b/c b/c\nnew file mode 100644\n--- /dev/null\n+++ b/c\n@@ -0,0 +1 @@\n+c\n"
+	)
+	tests := map[string]struct {
+		opt  *vcs.DiffOptions
+		want map[string]string // path -> diff
+	}{
+		"nil options": {
+			opt:  nil,
+			want: map[string]string{"a": diffA, "b/c": diffBC},
+		},
+		"ContextLines": {
+			opt:  &vcs.DiffOptions{ContextLines: 1},
+			want: map[string]string{"a": "diff --git a a\n--- a\n+++ a\n@@ -3,3 +3,3 @@\n 3\n-4\n+X\n 5\n", "b/c": diffBC},
+		},
+		"WordDiff": {
+			opt:  &vcs.DiffOptions{WordDiff: true, ContextLines: 1},
+			want: map[string]string{"a": "diff --git a a\n--- a\n+++ a\n@@ -3,3 +3,3 @@\n3\n[-4-]{+X+}\n5\n", "b/c": "diff --git b/c b/c\nnew file mode 100644\n--- /dev/null\n+++ b/c\n@@ -0,0 +1 @@\n{+c+}\n"},
+		},
+		"Paths": {
+			opt:  &vcs.DiffOptions{Paths: []string{"b"}},
+			want: map[string]string{"b/c": diffBC},
+		},
+		"prefixes": {
+			opt:  &vcs.DiffOptions{OrigPrefix: "a/", NewPrefix: "b/", Paths: []string{"a"}},
+			want: map[string]string{"a": "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+X\n 5\n 6\n 7\n"},
+		},
+	}
+	for label, test := range tests {
+		got := map[string]string{}
+		var paths []string
+		if err := r.CommitDiffFunc(head, test.opt, func(c *vcs.FileChange) error {
+			if c.Diff == nil {
+				t.Errorf("%s: %s: no diff", label, c.Path)
+				return nil
+			}
+			paths = append(paths, c.Path)
+			got[c.Path] = c.Diff.Raw
+			return nil
+		}); err != nil {
+			t.Errorf("%s: CommitDiffFunc: %s", label, err)
+			continue
+		}
+		if !sort.StringsAreSorted(paths) {
+			t.Errorf("%s: got paths %v, want them in order", label, paths)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got diffs %q, want %q", label, got, test.want)
+		}
+	}
+
+	errStop := errors.New("stop")
+	var n int
+	if err := r.CommitDiffFunc(head, nil, func(*vcs.FileChange) error {
+		n++
+		return errStop
+	}); err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if n != 1 {
+		t.Errorf("got %d calls after fn returned an error, want 1", n)
+	}
+}
+
+// TestRepository_CommitLineChanges_merge checks that a merge's line changes
+// are counted against hg's first parent (p1), even if p1 isn't listed
+// first in Commit.Parents (because CanonicalParentOrder sorts them).
+func TestRepository_CommitLineChanges_merge(t *testing.T) {
+	var wantAdded int
+	var merge vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		filelog, fileNodes := buildRevlog([]string{"1\n", "1\n2\n", "1\n2\n3\n"}, [][]int{nil, {0}, {1, 0}})
+		writeTestFiles(t, dir, map[string]string{".hg/store/data/a.i": string(filelog)})
+		var manifests []string
+		for _, node := range fileNodes {
+			manifests = append(manifests, fmt.Sprintf("a\x00%x\n", node))
+		}
+		manifestlog, manifestNodes := buildRevlog(manifests, [][]int{nil, {0}, {1, 0}})
+		var texts []string
+		for i, node := range manifestNodes {
+			texts = append(texts, fmt.Sprintf("%x\na <a@a.com>\n%d 0\na\n\ncommit%d", node, 1136214245+i, i))
+		}
+
+		// Make p1 the parent whose ID sorts last, so that it isn't first
+		// in Commit.Parents. Commit 1 adds a line, so the merge adds one
+		// line compared to commit 1 and two compared to commit 0.
+		_, nodes := buildRevlog(texts[:2], [][]int{nil, {0}})
+		mergeParents := []int{1, 0}
+		wantAdded = 1
+		if hex.EncodeToString(nodes[0]) > hex.EncodeToString(nodes[1]) {
+			mergeParents, wantAdded = []int{0, 1}, 2
+		}
+		changelog, nodes := buildRevlog(texts, [][]int{nil, {0}, mergeParents})
+		merge = vcs.CommitID(hex.EncodeToString(nodes[2]))
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/00manifest.i":  string(manifestlog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", merge, 2, merge),
+		})
+	})
+	defer os.RemoveAll(dir)
+	r.CanonicalParentOrder = true
+
+	added, removed, err := r.CommitLineChanges(merge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != wantAdded || removed != 0 {
+		t.Errorf("got %d added and %d removed, want %d added and 0 removed", added, removed, wantAdded)
+	}
+}
+
+func TestRepository_TreeChanged(t *testing.T) {
+	var nodes [][]byte
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 changes the tree, and commits 2 (which closes the
+		// branch) and 3 (which starts a new branch off of commit 0)
+		// reuse their parents' manifests.
+		manifests := []string{
+			fmt.Sprintf("a\x00%040x\n", 1),
+			fmt.Sprintf("a\x00%040x\n", 2),
+		}
+		manifestlog, manifestNodes := buildRevlog(manifests, [][]int{nil, {0}})
+		texts := []string{
+			fmt.Sprintf("%x\na <a@a.com>\n1136214245 0\na\n\nadd a", manifestNodes[0]),
+			fmt.Sprintf("%x\na <a@a.com>\n1136214246 0\na\n\nchange a", manifestNodes[1]),
+			fmt.Sprintf("%x\na <a@a.com>\n1136214247 0 close:1\n\nclose", manifestNodes[1]),
+			fmt.Sprintf("%x\na <a@a.com>\n1136214248 0 branch:b\n\nnew branch", manifestNodes[0]),
+		}
+		var changelog []byte
+		changelog, nodes = buildRevlog(texts, [][]int{nil, {0}, {1}, {0}})
+		tip := hex.EncodeToString(nodes[3])
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/00manifest.i":  string(manifestlog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s b\n", tip, 3, tip),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	// A root commit's tree is always changed.
+	for rev, want := range []bool{true, true, false, false} {
+		changed, err := r.TreeChanged(vcs.CommitID(hex.EncodeToString(nodes[rev])))
+		if err != nil {
+			t.Errorf("rev %d: %s", rev, err)
+			continue
+		}
+		if changed != want {
+			t.Errorf("rev %d: got TreeChanged %v, want %v", rev, changed, want)
+		}
+	}
+
+	if _, err := r.TreeChanged("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
@@ -0,0 +1,59 @@
+package hg
+
+import (
+	"path"
+
+	hg_store "github.com/beyang/hgo/store"
+)
+
+// A dirIndex maps each directory in a manifest (by its path, with
+// "." for the root) to its immediate children, so that a directory
+// can be listed without scanning the whole manifest. Because hg
+// doesn't track directories, they are inferred from the paths of the
+// files beneath them.
+type dirIndex map[string][]dirChild
+
+// A dirChild is an immediate child of a directory in a dirIndex:
+// either a file (if ent is set) or a subdirectory.
+type dirChild struct {
+	ent    *hg_store.ManifestEnt
+	subdir string
+}
+
+// newDirIndex indexes the directories of manifest m. Each directory's
+// children are in the order in which they first appear in the
+// manifest.
+func newDirIndex(m hg_store.Manifest) dirIndex {
+	idx := dirIndex{".": nil}
+	listed := map[string]struct{}{} // directories already listed in their parent
+	for i := range m {
+		ent := &m[i]
+		dir := path.Dir(ent.FileName)
+		idx[dir] = append(idx[dir], dirChild{ent: ent})
+		for dir != "." {
+			if _, ok := listed[dir]; ok {
+				break
+			}
+			listed[dir] = struct{}{}
+			parent := path.Dir(dir)
+			idx[parent] = append(idx[parent], dirChild{subdir: path.Base(dir)})
+			dir = parent
+		}
+	}
+	return idx
+}
+
+// dirIndex returns the directory index of the manifest at the
+// FileSystem's commit, which is built at most once.
+func (fs *hgFSNative) dirIndex() (dirIndex, error) {
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.dirs == nil {
+		fs.dirs = newDirIndex(m)
+	}
+	return fs.dirs, nil
+}
@@ -0,0 +1,45 @@
+package hg
+
+import (
+	"reflect"
+	"testing"
+
+	hg_store "github.com/beyang/hgo/store"
+)
+
+func TestNewDirIndex(t *testing.T) {
+	m := hg_store.Manifest{
+		{FileName: "a/b/c"},
+		{FileName: "a/b/d"},
+		{FileName: "a/e"},
+		{FileName: "f"},
+		{FileName: "g/h"},
+	}
+	idx := newDirIndex(m)
+
+	names := func(dir string) []string {
+		var names []string
+		for _, c := range idx[dir] {
+			if c.ent != nil {
+				names = append(names, c.ent.FileName)
+			} else {
+				names = append(names, c.subdir+"/")
+			}
+		}
+		return names
+	}
+	want := map[string][]string{
+		".":   {"a/", "f", "g/"},
+		"a":   {"b/", "a/e"},
+		"a/b": {"a/b/c", "a/b/d"},
+		"g":   {"g/h"},
+	}
+	if len(idx) != len(want) {
+		t.Errorf("got %d directories, want %d", len(idx), len(want))
+	}
+	for dir, wantNames := range want {
+		if got := names(dir); !reflect.DeepEqual(got, wantNames) {
+			t.Errorf("%s: got %v, want %v", dir, got, wantNames)
+		}
+	}
+}
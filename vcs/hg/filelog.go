@@ -0,0 +1,73 @@
+package hg
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+)
+
+// pathRevs returns the changelog revisions of the commits reachable
+// from head (but not in exclude) that changed the file or directory
+// at p, newest first. Renames aren't followed, so a renamed file's
+// history stops at the commit that renamed it.
+//
+// For a file, the file's revlog is read and its revisions are mapped
+// back to the commits that introduced them (their linkrevs), so the
+// changelog isn't walked. Like `hg log` without --removed, this
+// excludes the commits that removed the file, which have no revision
+// in its revlog. For a directory (which has no revlog), the changed
+// files of each of head's ancestors are checked, so commits that
+// removed files under it are included, and the walk stops with
+// ctx.Err() if ctx is done.
+func (r *Repository) pathRevs(ctx context.Context, head *hg_revlog.Rec, exclude map[int]*hg_revlog.Rec, p string) ([]int, error) {
+	ancestors := ancestorRecs(head)
+	for rev := range exclude {
+		delete(ancestors, rev)
+	}
+
+	var revs []int
+	flog, err := r.st.OpenRevlog(p)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		tip := flog.Tip()
+		seen := map[int]struct{}{}
+		for i := 0; tip != nil && i <= tip.FileRev(); i++ {
+			rec, err := hg_revlog.FileRevSpec(i).Lookup(flog)
+			if err != nil {
+				return nil, err
+			}
+			linkrev := int(rec.Linkrev)
+			if _, ok := ancestors[linkrev]; !ok {
+				continue
+			}
+			if _, ok := seen[linkrev]; !ok {
+				seen[linkrev] = struct{}{}
+				revs = append(revs, linkrev)
+			}
+		}
+	} else {
+		prefix := p + "/"
+		for rev, rec := range ancestors {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			cs, err := readChangeset(rec)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range cs.Files {
+				if f == p || strings.HasPrefix(f, prefix) {
+					revs = append(revs, rev)
+					break
+				}
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(revs)))
+	return revs, nil
+}
@@ -0,0 +1,73 @@
+package hg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_Commits_path(t *testing.T) {
+	var ids []vcs.CommitID
+	var tip vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 0 adds a and d/x, commit 1 modifies a, commit 2 adds
+		// d/y, and commit 3 removes a. Only a's revlog is written (its
+		// revisions are linked to commits 0 and 1), so d/x is looked up
+		// like a directory; the log doesn't read the manifests.
+		filelog, _ := buildRevlog([]string{"1\n", "2\n"}, [][]int{nil, {0}})
+		files := [][]string{{"a", "d/x"}, {"a"}, {"d/y"}, {"a"}}
+		texts := make([]string, len(files))
+		parents := make([][]int, len(files))
+		for rev, fs := range files {
+			texts[rev] = fmt.Sprintf("%040x\na <a@a.com>\n%d 0\n%s\n\ncommit%d", 0, 1136214245+rev, strings.Join(fs, "\n"), rev)
+			if rev > 0 {
+				parents[rev] = []int{rev - 1}
+			}
+		}
+		changelog, nodes := buildRevlog(texts, parents)
+		ids = make([]vcs.CommitID, len(nodes))
+		for i, node := range nodes {
+			ids[i] = vcs.CommitID(hex.EncodeToString(node))
+		}
+		tip = ids[len(ids)-1]
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/data/a.i":      string(filelog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", tip, len(ids)-1, tip),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		head vcs.CommitID
+		path string
+		want []vcs.CommitID
+	}{
+		// The commit that removed a isn't included.
+		{head: tip, path: "a", want: []vcs.CommitID{ids[1], ids[0]}},
+		{head: ids[0], path: "a", want: []vcs.CommitID{ids[0]}},
+		{head: tip, path: "d", want: []vcs.CommitID{ids[2], ids[0]}},
+		{head: tip, path: "d/x", want: []vcs.CommitID{ids[0]}},
+		{head: tip, path: "nonexistent", want: nil},
+	}
+	for _, test := range tests {
+		commits, total, err := r.Commits(vcs.CommitsOptions{Head: test.head, Path: test.path})
+		if err != nil {
+			t.Errorf("%s at %s: %s", test.path, test.head, err)
+			continue
+		}
+		var got []vcs.CommitID
+		for _, c := range commits {
+			got = append(got, c.ID)
+		}
+		if !reflect.DeepEqual(got, test.want) || total != uint(len(test.want)) {
+			t.Errorf("%s at %s: got %v (total %d), want %v", test.path, test.head, got, total, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package hg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// DiffAgainstFS compares the tree of the commit to the files in
+// other (e.g., an external checkout or generated build output) and
+// returns the files that differ, sorted by path. A file is added if
+// it is only in other, removed if it is only in the commit, and
+// modified if its contents differ. The commit's files are read from
+// its manifest, so only files that are in both trees are read. Any
+// .hg directories in other are skipped.
+//
+// Symlinks aren't followed: other's files are examined with Lstat, and
+// a symlink is modified if it has become a regular file (or vice
+// versa) or its target has changed. Comparing the targets of symlinks
+// requires other to be a vcs.SymlinkReader; if it isn't, and a path is
+// a symlink in both trees, an error is returned.
+//
+// Of opt's fields, only Paths is used: if it is set, only files at or
+// beneath those paths are compared, and only the directories of other
+// that may contain them are read. The returned changes have no Diff.
+func (r *Repository) DiffAgainstFS(commit vcs.CommitID, other vfs.FileSystem, opt *vcs.DiffOptions) ([]*vcs.FileChange, error) {
+	fs, err := r.fileSystem(commit)
+	if err != nil {
+		return nil, err
+	}
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if opt != nil {
+		paths = opt.Paths
+	}
+
+	otherFiles := map[string]bool{}
+	err = walkFiles(other, "/", paths, func(name string) {
+		if matchesPaths(paths, name) {
+			otherFiles[name] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*vcs.FileChange
+	for i := range m {
+		ent := &m[i]
+		if !matchesPaths(paths, ent.FileName) {
+			continue
+		}
+		if !otherFiles[ent.FileName] {
+			changes = append(changes, &vcs.FileChange{Path: ent.FileName, Status: vcs.FileRemoved})
+			continue
+		}
+		delete(otherFiles, ent.FileName)
+
+		rec, err := fs.entryRec(ent)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.readFile(rec)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := other.Lstat("/" + ent.FileName)
+		if err != nil {
+			return nil, err
+		}
+		if isLink := fi.Mode()&os.ModeSymlink != 0; isLink != ent.IsLink() {
+			changes = append(changes, &vcs.FileChange{Path: ent.FileName, Status: vcs.FileModified})
+			continue
+		}
+		otherData, err := readFileOrLink(other, "/"+ent.FileName, ent.IsLink())
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(data, otherData) {
+			changes = append(changes, &vcs.FileChange{Path: ent.FileName, Status: vcs.FileModified})
+		}
+	}
+	for name := range otherFiles {
+		changes = append(changes, &vcs.FileChange{Path: name, Status: vcs.FileAdded})
+	}
+
+	sort.Sort(fileChangesByPath(changes))
+	return changes, nil
+}
+
+// readFileOrLink returns the contents of the file at name in fs or, if
+// isLink is set, the target of the symlink at name (which, like the
+// data of a symlink's manifest entry, is what hg stores for it).
+func readFileOrLink(fs vfs.FileSystem, name string, isLink bool) ([]byte, error) {
+	if !isLink {
+		return vfs.ReadFile(fs, name)
+	}
+	sr, ok := fs.(vcs.SymlinkReader)
+	if !ok {
+		return nil, fmt.Errorf("hg: comparing symlink %s failed: the FileSystem can't read symlink targets", name)
+	}
+	target, err := sr.ReadLink(name)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(target), nil
+}
+
+type fileChangesByPath []*vcs.FileChange
+
+func (v fileChangesByPath) Len() int           { return len(v) }
+func (v fileChangesByPath) Less(i, j int) bool { return v[i].Path < v[j].Path }
+func (v fileChangesByPath) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// walkFiles calls fn with the path (relative to the root of fs) of
+// each file at or beneath dir in fs, skipping .hg directories and, if
+// paths is set, directories that can't contain any files at or
+// beneath paths. Symlinks (even to directories) are files.
+func walkFiles(fs vfs.FileSystem, dir string, paths []string, fn func(name string)) error {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		name := path.Join(dir, fi.Name())
+		if fi.IsDir() {
+			if fi.Name() == ".hg" || !mayContainPaths(paths, strings.TrimPrefix(name, "/")) {
+				continue
+			}
+			if err := walkFiles(fs, name, paths, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		fn(strings.TrimPrefix(name, "/"))
+	}
+	return nil
+}
+
+// matchesPaths reports whether name is at or beneath any of paths. If
+// paths is empty, all names match.
+func matchesPaths(paths []string, name string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = path.Clean(internal.Rel(p))
+		if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mayContainPaths reports whether the directory dir may contain files
+// at or beneath any of paths: that is, whether dir is at or beneath
+// one of them or is an ancestor of one. If paths is empty, all
+// directories may.
+func mayContainPaths(paths []string, dir string) bool {
+	if matchesPaths(paths, dir) {
+		return true
+	}
+	for _, p := range paths {
+		if strings.HasPrefix(path.Clean(internal.Rel(p)), dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestMatchesPaths(t *testing.T) {
+	tests := []struct {
+		paths []string
+		name  string
+		want  bool
+	}{
+		{nil, "a/b", true},
+		{[]string{"/"}, "a/b", true},
+		{[]string{"a"}, "a/b", true},
+		{[]string{"/a/"}, "a/b", true},
+		{[]string{"a/b"}, "a/b", true},
+		{[]string{"a/b"}, "a/bc", false},
+		{[]string{"b", "c"}, "a/b", false},
+	}
+	for _, test := range tests {
+		if got := matchesPaths(test.paths, test.name); got != test.want {
+			t.Errorf("matchesPaths(%q, %q): got %v, want %v", test.paths, test.name, got, test.want)
+		}
+	}
+}
+
+func TestMayContainPaths(t *testing.T) {
+	tests := []struct {
+		paths []string
+		dir   string
+		want  bool
+	}{
+		{nil, "a", true},
+		{[]string{"a"}, "a", true},
+		{[]string{"a"}, "a/b", true},
+		{[]string{"a/b/c"}, "a", true},
+		{[]string{"/a/b/"}, "a/b", true},
+		{[]string{"a/b"}, "a/c", false},
+		{[]string{"ab/c"}, "a", false},
+	}
+	for _, test := range tests {
+		if got := mayContainPaths(test.paths, test.dir); got != test.want {
+			t.Errorf("mayContainPaths(%q, %q): got %v, want %v", test.paths, test.dir, got, test.want)
+		}
+	}
+}
+
+// A readDirRecorder records the directories read from a FileSystem
+// (which must be a vcs.SymlinkReader).
+type readDirRecorder struct {
+	vfs.FileSystem
+	dirs []string
+}
+
+func (fs *readDirRecorder) ReadDir(path string) ([]os.FileInfo, error) {
+	fs.dirs = append(fs.dirs, path)
+	return fs.FileSystem.ReadDir(path)
+}
+
+func (fs *readDirRecorder) ReadLink(name string) (string, error) {
+	return fs.FileSystem.(vcs.SymlinkReader).ReadLink(name)
+}
+
+func TestRepository_DiffAgainstFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The other tree is read from a commit in another repository, so
+	// that its symlinks can be read.
+	id := writeTestRepoContents(t, filepath.Join(dir, "base"), map[string]string{
+		"a":          "a\n",
+		"b":          "b\n",
+		"c":          "c\n",
+		"d/x":        "x\n",
+		"e/y":        "y\n",
+		"link\x00l":  "a",
+		"link2\x00l": "a",
+		"tolink":     "a",
+	})
+	otherID := writeTestRepoContents(t, filepath.Join(dir, "other"), map[string]string{
+		"a":           "a\n",
+		"b":           "B\n",
+		"d/x":         "x\n",
+		"e/y":         "y\n",
+		"link\x00l":   "a",
+		"link2\x00l":  "b",
+		"new":         "new\n",
+		"tolink\x00l": "a",
+	})
+	r, err := Open(filepath.Join(dir, "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRepo, err := Open(filepath.Join(dir, "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFS, err := otherRepo.FileSystem(vcs.CommitID(otherID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		paths []string
+		want  []vcs.FileChange
+		dirs  []string // the directories of the other tree that are read
+	}{
+		{
+			want: []vcs.FileChange{
+				{Path: "b", Status: vcs.FileModified},
+				{Path: "c", Status: vcs.FileRemoved},
+				{Path: "link2", Status: vcs.FileModified},
+				{Path: "new", Status: vcs.FileAdded},
+				{Path: "tolink", Status: vcs.FileModified},
+			},
+			dirs: []string{"/", "/d", "/e"},
+		},
+		{paths: []string{"b", "d/x"}, want: []vcs.FileChange{{Path: "b", Status: vcs.FileModified}}, dirs: []string{"/", "/d"}},
+		{paths: []string{"e"}, dirs: []string{"/", "/e"}},
+	}
+	for _, test := range tests {
+		other := &readDirRecorder{FileSystem: otherFS}
+		changes, err := r.DiffAgainstFS(vcs.CommitID(id), other, &vcs.DiffOptions{Paths: test.paths})
+		if err != nil {
+			t.Errorf("%q: %s", test.paths, err)
+			continue
+		}
+		var got []vcs.FileChange
+		for _, c := range changes {
+			got = append(got, *c)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got changes %+v, want %+v", test.paths, got, test.want)
+		}
+		if !reflect.DeepEqual(other.dirs, test.dirs) {
+			t.Errorf("%q: got directories %q read, want %q", test.paths, other.dirs, test.dirs)
+		}
+	}
+}
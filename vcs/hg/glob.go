@@ -0,0 +1,28 @@
+package hg
+
+import (
+	"sort"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// Glob implements vcs.Globber. The file names in the manifest are
+// matched directly, so it is much cheaper than walking the tree with
+// ReadDir. Paths are always matched case-sensitively.
+func (fs *hgFSNative) Glob(pattern string) ([]string, error) {
+	if _, err := internal.MatchGlob(pattern, ""); err != nil {
+		return nil, err
+	}
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := range m {
+		if ok, _ := internal.MatchGlob(pattern, m[i].FileName); ok {
+			names = append(names, m[i].FileName)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
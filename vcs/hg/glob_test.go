@@ -0,0 +1,46 @@
+package hg
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_FileSystem_Glob(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = writeTestRepoTree(t, dir, []string{"a.go", "a.txt", "b/c.go", "b/d/e.go", "b/d/f.txt"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := fs.(vcs.Globber)
+
+	tests := map[string][]string{
+		"*.go":        {"a.go"},
+		"**/*.go":     {"a.go", "b/c.go", "b/d/e.go"},
+		"**/**/*.txt": {"a.txt", "b/d/f.txt"},
+		"b/**":        {"b/c.go", "b/d/e.go", "b/d/f.txt"},
+		"b/d":         nil,
+		"*.java":      nil,
+	}
+	for pattern, want := range tests {
+		got, err := g.Glob(pattern)
+		if err != nil {
+			t.Errorf("%q: %s", pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %v, want %v", pattern, got, want)
+		}
+	}
+
+	if _, err := g.Glob("["); err != path.ErrBadPattern {
+		t.Errorf("bad pattern: got error %v, want %v", err, path.ErrBadPattern)
+	}
+}
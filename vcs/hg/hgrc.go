@@ -0,0 +1,63 @@
+package hg
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// readConfig returns the value of key in section of the hg config
+// file at path (such as a repository's .hg/hgrc), or "" if the file
+// doesn't exist or doesn't set it.
+func readConfig(path, section, key string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return configValue(data, section, key), nil
+}
+
+// configValue returns the value of key in section of the hg config
+// file data, or "" if it isn't set. Like hg, it ignores comment lines
+// (starting with "#" or ";"), joins the continuation lines of a
+// value (which start with whitespace) with newlines, and uses the
+// last value if a key is set more than once. The %include and %unset
+// directives aren't supported and are ignored.
+func configValue(data []byte, section, key string) string {
+	var (
+		cur   string // the current section
+		value string
+		last  bool // whether the previous line set key
+	)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		switch {
+		case line == "":
+			last = false
+		case line[0] == ' ' || line[0] == '\t':
+			if last {
+				value += "\n" + strings.TrimSpace(line)
+			}
+		case line[0] == '#' || line[0] == ';' || line[0] == '%':
+			last = false
+		case line[0] == '[':
+			if i := strings.IndexByte(line, ']'); i > 0 {
+				cur = strings.TrimSpace(line[1:i])
+			}
+			last = false
+		default:
+			last = false
+			i := strings.IndexByte(line, '=')
+			if i < 0 || cur != section || strings.TrimSpace(line[:i]) != key {
+				continue
+			}
+			value, last = strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package hg
+
+import "testing"
+
+func TestConfigValue(t *testing.T) {
+	const data = `# comment
+[paths]
+default = https://example.com/repo
+
+[go-vcs]
+; another comment
+default-branch = main
+other = a
+  b
+   c
+
+[go-vcs-2]
+default-branch = other
+`
+	tests := []struct {
+		section, key string
+		want         string
+	}{
+		{"go-vcs", "default-branch", "main"},
+		{"go-vcs", "other", "a\nb\nc"},
+		{"go-vcs", "missing", ""},
+		{"paths", "default", "https://example.com/repo"},
+		{"paths", "default-branch", ""},
+		{"go-vcs-2", "default-branch", "other"},
+		{"missing", "default-branch", ""},
+	}
+	for _, test := range tests {
+		if got := configValue([]byte(data), test.section, test.key); got != test.want {
+			t.Errorf("%s.%s: got %q, want %q", test.section, test.key, got, test.want)
+		}
+	}
+
+	// The last value wins.
+	if got := configValue([]byte("[a]\nb = 1\n[a]\nb = 2\n"), "a", "b"); got != "2" {
+		t.Errorf("got %q, want %q", got, "2")
+	}
+}
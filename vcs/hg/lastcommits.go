@@ -0,0 +1,129 @@
+package hg
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// maxDirLastCommitsWalk is the maximum number of commits that
+// DirLastCommits reads while walking the history before it falls
+// back to looking up the remaining entries file by file. It is a
+// variable so that tests can lower it.
+var maxDirLastCommitsWalk = 1000
+
+// DirLastCommits returns the newest commit that touched each entry of
+// the directory at dir in the given commit (like the tree view of a
+// code host), keyed by entry name. A subdirectory's last commit is
+// the newest commit that touched any file beneath it.
+//
+// It walks the commit's history newest first, assigning each entry
+// the first commit whose list of changed files includes the entry (or
+// a file beneath it), and stops once every entry is assigned. The
+// walk reads at most maxDirLastCommitsWalk commits; any entries still
+// unassigned are then assigned the newest commit that introduced one
+// of the entry's current file revisions (its linkrev), which ignores
+// later commits that only deleted files beneath the entry.
+func (r *Repository) DirLastCommits(commit vcs.CommitID, dir string) (map[string]*vcs.Commit, error) {
+	rec, err := r.getRec(commit)
+	if err != nil {
+		return nil, err
+	}
+	m, err := r.manifest(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefix string
+	if dir = path.Clean(internal.Rel(dir)); dir != "." {
+		prefix = dir + "/"
+	}
+	entryName := func(file string) string {
+		if !strings.HasPrefix(file, prefix) {
+			return ""
+		}
+		return strings.SplitN(strings.TrimPrefix(file, prefix), "/", 2)[0]
+	}
+
+	// entries maps each entry name to the files at or beneath it.
+	entries := map[string][]*hg_store.ManifestEnt{}
+	for i := range m {
+		if name := entryName(m[i].FileName); name != "" {
+			entries[name] = append(entries[name], &m[i])
+		}
+	}
+	if len(entries) == 0 && dir != "." {
+		return nil, &os.PathError{Op: "DirLastCommits", Path: dir, Err: os.ErrNotExist}
+	}
+
+	commits := map[int]*vcs.Commit{}
+	commitAt := func(rec *hg_revlog.Rec) (*vcs.Commit, error) {
+		if c, ok := commits[rec.FileRev()]; ok {
+			return c, nil
+		}
+		c, err := r.makeCommit(rec)
+		if err != nil {
+			return nil, err
+		}
+		commits[rec.FileRev()] = c
+		return c, nil
+	}
+
+	last := make(map[string]*vcs.Commit, len(entries))
+	w := newLogWalker(rec, nil)
+	for i, rec := 0, w.next(); rec != nil && i < maxDirLastCommitsWalk && len(last) < len(entries); i, rec = i+1, w.next() {
+		cs, err := readChangeset(rec)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range cs.Files {
+			name := entryName(f)
+			if _, ok := entries[name]; !ok || last[name] != nil {
+				continue
+			}
+			if last[name], err = commitAt(rec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	if len(last) == len(entries) {
+		return last, nil
+	}
+
+	// Fall back to the linkrevs of the unassigned entries' files.
+	fs, err := r.fileSystem(commit)
+	if err != nil {
+		return nil, err
+	}
+	for name, ents := range entries {
+		if last[name] != nil {
+			continue
+		}
+		newest := -1
+		for _, ent := range ents {
+			frec, err := fs.entryRec(ent)
+			if err != nil {
+				return nil, err
+			}
+			if rev := int(frec.Linkrev); rev > newest {
+				newest = rev
+			}
+		}
+		crec, err := hg_revlog.FileRevSpec(newest).Lookup(fs.cl)
+		if err != nil {
+			return nil, err
+		}
+		if last[name], err = commitAt(crec); err != nil {
+			return nil, err
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,75 @@
+package hg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_DirLastCommits(t *testing.T) {
+	var ids []vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 0 adds b, d/x, and d/y, commit 1 modifies b and removes
+		// d/y, and commit 2 modifies b. The revlog of d/y isn't written,
+		// since it isn't in the manifest of commit 2.
+		blog, bNodes := buildRevlog([]string{"1\n", "2\n", "3\n"}, [][]int{nil, {0}, {1}})
+		xlog, xNodes := buildRevlog([]string{"x\n"}, [][]int{nil})
+		manifests := []string{
+			fmt.Sprintf("b\x00%x\nd/x\x00%x\nd/y\x00%040x\n", bNodes[0], xNodes[0], 1),
+			fmt.Sprintf("b\x00%x\nd/x\x00%x\n", bNodes[1], xNodes[0]),
+			fmt.Sprintf("b\x00%x\nd/x\x00%x\n", bNodes[2], xNodes[0]),
+		}
+		parents := [][]int{nil, {0}, {1}}
+		manifestlog, manifestNodes := buildRevlog(manifests, parents)
+		files := []string{"b\nd/x\nd/y", "b\nd/y", "b"}
+		texts := make([]string, len(files))
+		for rev, fs := range files {
+			texts[rev] = fmt.Sprintf("%x\na <a@a.com>\n%d 0\n%s\n\ncommit%d", manifestNodes[rev], 1136214245+rev, fs, rev)
+		}
+		changelog, nodes := buildRevlog(texts, parents)
+		ids = make([]vcs.CommitID, len(nodes))
+		for i, node := range nodes {
+			ids[i] = vcs.CommitID(hex.EncodeToString(node))
+		}
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/store/00manifest.i":  string(manifestlog),
+			".hg/store/data/b.i":      string(blog),
+			".hg/store/data/d/x.i":    string(xlog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", ids[2], 2, ids[2]),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		maxWalk int
+		want    map[string]vcs.CommitID
+	}{
+		// The walk finds the commit that removed d/y.
+		"walk": {maxWalk: 1000, want: map[string]vcs.CommitID{"b": ids[2], "d": ids[1]}},
+		// The walk stops after commit 2, so d falls back to the linkrev
+		// of d/x, which ignores the removal of d/y.
+		"linkrev fallback": {maxWalk: 1, want: map[string]vcs.CommitID{"b": ids[2], "d": ids[0]}},
+	}
+	defer func(max int) { maxDirLastCommitsWalk = max }(maxDirLastCommitsWalk)
+	for label, test := range tests {
+		maxDirLastCommitsWalk = test.maxWalk
+		last, err := r.DirLastCommits(ids[2], ".")
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		got := make(map[string]vcs.CommitID, len(last))
+		for name, c := range last {
+			got[name] = c.ID
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package hg
+
+import (
+	"encoding/hex"
+	"os"
+	"time"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/util"
+)
+
+// setLastCommits sets the ModTime of each file in fis (the entries of
+// the directory dir) to the date of the commit that introduced the
+// file's current revision (its linkrev), and its Sys to a
+// vcs.LastCommitInfo holding that commit's ID. Subdirectories are
+// left unchanged. The commits are read once each, but each file's
+// revlog must still be opened to find its linkrev.
+func (fs *hgFSNative) setLastCommits(dir string, fis []os.FileInfo) error {
+	ents, err := fs.manifestEnts()
+	if err != nil {
+		return err
+	}
+
+	type lastCommit struct {
+		id   vcs.CommitID
+		date time.Time
+	}
+	commits := map[int]lastCommit{}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		name := fi.Name()
+		if dir != "." {
+			name = dir + "/" + name
+		}
+		ent, ok := ents[name]
+		if !ok {
+			continue
+		}
+		frec, err := fs.entryRec(ent)
+		if err != nil {
+			return standardizeHgError(err)
+		}
+
+		rev := int(frec.Linkrev)
+		c, ok := commits[rev]
+		if !ok {
+			crec, err := hg_revlog.FileRevSpec(rev).Lookup(fs.cl)
+			if err != nil {
+				return err
+			}
+			cs, err := readChangeset(crec)
+			if err != nil {
+				return err
+			}
+			c = lastCommit{id: vcs.CommitID(hex.EncodeToString(crec.Id())), date: cs.Date}
+			commits[rev] = c
+		}
+
+		ufi := fi.(*util.FileInfo)
+		ufi.ModTime_ = c.date
+		ufi.Sys_ = vcs.LastCommitInfo{CommitID: c.id}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package hg
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_ReadDirLastCommits(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 0 adds a, b, and d/x, commit 1 modifies a, and commit 2
+		// adds c.
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{files: map[string]string{"a": "1", "b": "b", "d/x": "x"}},
+			{parents: []int{0}, files: map[string]string{"a": "2", "b": "b", "d/x": "x"}},
+			{parents: []int{1}, files: map[string]string{"a": "2", "b": "b", "c": "c", "d/x": "x"}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	date := func(rev int) time.Time { return time.Unix(int64(1136214245+rev), 0) }
+	tests := map[string]struct {
+		lastCommits bool
+		dir         string
+		want        map[string]int // the commit each entry's ModTime and Sys come from
+	}{
+		// Subdirectories keep the FileSystem's commit's date, and no Sys.
+		"last commits":    {lastCommits: true, dir: ".", want: map[string]int{"a": 1, "b": 0, "c": 2, "d": -1}},
+		"subdirectory":    {lastCommits: true, dir: "d", want: map[string]int{"x": 0}},
+		"no last commits": {dir: ".", want: map[string]int{"a": -1, "b": -1, "c": -1, "d": -1}},
+	}
+	for label, test := range tests {
+		r.ReadDirLastCommits = test.lastCommits
+		fs, err := r.FileSystem(vcs.CommitID(ids[2]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fis, err := fs.ReadDir(test.dir)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if len(fis) != len(test.want) {
+			t.Errorf("%s: got %d entries, want %d", label, len(fis), len(test.want))
+		}
+		for _, fi := range fis {
+			rev, ok := test.want[fi.Name()]
+			if !ok {
+				t.Errorf("%s: unexpected entry %s", label, fi.Name())
+				continue
+			}
+			wantDate, wantSys := date(2), interface{}(nil)
+			if rev != -1 {
+				wantDate, wantSys = date(rev), vcs.LastCommitInfo{CommitID: vcs.CommitID(ids[rev])}
+			}
+			if !fi.ModTime().Equal(wantDate) {
+				t.Errorf("%s: %s: got ModTime %v, want %v", label, fi.Name(), fi.ModTime(), wantDate)
+			}
+			if fi.Sys() != wantSys {
+				t.Errorf("%s: %s: got Sys %v, want %v", label, fi.Name(), fi.Sys(), wantSys)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_Commits_roots(t *testing.T) {
+	tests := map[string]struct {
+		messages []string
+		parents  [][]int
+		head     int
+		want     []int // revisions, in the order they're listed
+	}{
+		"single commit": {
+			messages: []string{"root"},
+			parents:  [][]int{nil},
+			want:     []int{0},
+		},
+		"linear": {
+			messages: []string{"root", "child"},
+			parents:  [][]int{nil, {0}},
+			head:     1,
+			want:     []int{1, 0},
+		},
+		// Rev 2 merges two unrelated roots, and rev 3 is on top of
+		// only one of them.
+		"merged roots": {
+			messages: []string{"root1", "root2", "merge", "child of root2"},
+			parents:  [][]int{nil, nil, {0, 1}, {1}},
+			head:     2,
+			want:     []int{2, 1, 0},
+		},
+		"other root": {
+			messages: []string{"root1", "root2", "merge", "child of root2"},
+			parents:  [][]int{nil, nil, {0, 1}, {1}},
+			head:     3,
+			want:     []int{3, 1},
+		},
+	}
+	for label, test := range tests {
+		dir, err := ioutil.TempDir("", "go-vcs-hg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		ids := writeTestRepoGraph(t, dir, test.messages, test.parents)
+		r, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		head := vcs.CommitID(ids[test.head])
+		var want []vcs.CommitID
+		for _, rev := range test.want {
+			want = append(want, vcs.CommitID(ids[rev]))
+		}
+		commitIDs := func(commits []*vcs.Commit) []vcs.CommitID {
+			var ids []vcs.CommitID
+			for _, c := range commits {
+				ids = append(ids, c.ID)
+			}
+			return ids
+		}
+
+		commits, total, err := r.Commits(vcs.CommitsOptions{Head: head})
+		if err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		if got := commitIDs(commits); !reflect.DeepEqual(got, want) || total != uint(len(want)) {
+			t.Errorf("%s: Commits: got %v (total %d), want %v", label, got, total, want)
+		}
+		for i, c := range commits {
+			if i < len(test.want) && len(test.parents[test.want[i]]) == 0 && c.Parents != nil {
+				t.Errorf("%s: root commit %s: got Parents %v, want none", label, c.ID, c.Parents)
+			}
+		}
+
+		sampled, err := r.SampleCommits(head, 100)
+		if err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		wantSampled := []vcs.CommitID{want[0]}
+		if len(want) > 1 {
+			wantSampled = append(wantSampled, want[len(want)-1])
+		}
+		if got := commitIDs(sampled); !reflect.DeepEqual(got, wantSampled) {
+			t.Errorf("%s: SampleCommits: got %v, want %v", label, got, wantSampled)
+		}
+
+		var walked []vcs.CommitID
+		if err := r.CommitsFunc(head, func(c *vcs.Commit) error {
+			walked = append(walked, c.ID)
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		if !reflect.DeepEqual(walked, want) {
+			t.Errorf("%s: CommitsFunc: got %v, want %v", label, walked, want)
+		}
+	}
+}
+
+func TestRepository_CommitsReversed(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2", "commit3", "commit4")
+	})
+	defer os.RemoveAll(dir)
+	head := vcs.CommitID(ids[3])
+
+	tests := map[string]struct {
+		opt       vcs.CommitsOptions
+		want      []int
+		wantTotal uint
+	}{
+		"all":       {opt: vcs.CommitsOptions{Head: head}, want: []int{0, 1, 2, 3}, wantTotal: 4},
+		"page":      {opt: vcs.CommitsOptions{Head: head, Skip: 1, N: 2}, want: []int{1, 2}, wantTotal: 4},
+		"no total":  {opt: vcs.CommitsOptions{Head: head, N: 1, NoTotal: true}, want: []int{0}},
+		"with base": {opt: vcs.CommitsOptions{Head: head, Base: vcs.CommitID(ids[1])}, want: []int{2, 3}, wantTotal: 2},
+	}
+	for label, test := range tests {
+		commits, total, err := r.CommitsReversed(test.opt)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		var got []int
+		for _, c := range commits {
+			got = append(got, indexOfID(ids, c.ID))
+		}
+		if !reflect.DeepEqual(got, test.want) || total != test.wantTotal {
+			t.Errorf("%s: got revs %v (total %d), want %v (total %d)", label, got, total, test.want, test.wantTotal)
+		}
+	}
+}
+
+func TestRepository_FirstParentLog(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// 0 - 1 - 3 - 5
+		//  \     /   /
+		//   - 2 --- 4
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"commit0", "commit1", "commit2", "merge2", "commit4", "merge4"},
+			[][]int{nil, {0}, {0}, {1, 2}, {2}, {3, 4}},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[int][]int{
+		5: {5, 3, 1, 0},
+		4: {4, 2, 0},
+		3: {3, 1, 0},
+		0: {0},
+	}
+	for head, want := range tests {
+		commits, err := r.FirstParentLog(vcs.CommitID(ids[head]))
+		if err != nil {
+			t.Errorf("head %d: %s", head, err)
+			continue
+		}
+		var got []int
+		for _, c := range commits {
+			got = append(got, indexOfID(ids, c.ID))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("head %d: got revs %v, want %v", head, got, want)
+		}
+	}
+}
+
+// indexOfID returns the index of id in ids, or -1.
+func indexOfID(ids []string, id vcs.CommitID) int {
+	for i, s := range ids {
+		if vcs.CommitID(s) == id {
+			return i
+		}
+	}
+	return -1
+}
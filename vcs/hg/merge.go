@@ -0,0 +1,154 @@
+package hg
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// ErrNoMergeBase is returned when two commits have no common
+// ancestor (e.g., they are in unrelated histories).
+var ErrNoMergeBase = errors.New("commits have no common ancestor")
+
+// mergeBaseRec returns the greatest common ancestor of a and b: the
+// common ancestor with the highest revision number. (Because a
+// revision's ancestors always have lower revision numbers, it is not
+// an ancestor of any other common ancestor.)
+func mergeBaseRec(a, b *hg_revlog.Rec) (*hg_revlog.Rec, error) {
+	ancA := ancestorRecs(a)
+	var base *hg_revlog.Rec
+	for rev, rec := range ancestorRecs(b) {
+		if _, ok := ancA[rev]; ok && (base == nil || rev > base.FileRev()) {
+			base = rec
+		}
+	}
+	if base == nil {
+		return nil, ErrNoMergeBase
+	}
+	return base, nil
+}
+
+// MergeBase returns the merge base of a and b (their greatest common
+// ancestor; see mergeBaseRec), computed natively by walking both
+// commits' ancestry. If a and b have no common ancestor (e.g., they are
+// in unrelated histories), ErrNoMergeBase is returned.
+func (r *Repository) MergeBase(a, b vcs.CommitID) (vcs.CommitID, error) {
+	recA, err := r.getRec(a)
+	if err != nil {
+		return "", err
+	}
+	recB, err := r.getRec(b)
+	if err != nil {
+		return "", err
+	}
+	base, err := mergeBaseRec(recA, recB)
+	if err != nil {
+		return "", err
+	}
+	return vcs.CommitID(hex.EncodeToString(base.Id())), nil
+}
+
+// MergePreview returns the paths of the files that would be candidates
+// for conflicts if a and b were merged, sorted by path. These are the
+// files that were changed (added, modified, or removed) on both sides
+// since the merge base of a and b, excluding files that were changed
+// identically on both sides. It is a read-only analysis of the
+// manifests; it doesn't try to merge file contents, so some of the
+// candidates might merge cleanly.
+func (r *Repository) MergePreview(a, b vcs.CommitID) ([]string, error) {
+	recA, err := r.getRec(a)
+	if err != nil {
+		return nil, err
+	}
+	recB, err := r.getRec(b)
+	if err != nil {
+		return nil, err
+	}
+	baseRec, err := mergeBaseRec(recA, recB)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := r.manifest(baseRec)
+	if err != nil {
+		return nil, err
+	}
+	mA, err := r.manifest(recA)
+	if err != nil {
+		return nil, err
+	}
+	mB, err := r.manifest(recB)
+	if err != nil {
+		return nil, err
+	}
+
+	changedB := changedPaths(base, mB)
+	entsA, entsB := mA.Map(), mB.Map()
+	var paths []string
+	for path := range changedPaths(base, mA) {
+		if changedB[path] && !sameEntry(entsA[path], entsB[path]) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// changedPaths returns the set of paths that were added, modified, or
+// removed between the manifests from and to.
+func changedPaths(from, to hg_store.Manifest) map[string]bool {
+	changed := map[string]bool{}
+	toEnts := to.Map()
+	for _, e := range from {
+		if !sameEntry(&e, toEnts[e.FileName]) {
+			changed[e.FileName] = true
+		}
+	}
+	fromEnts := from.Map()
+	for _, e := range to {
+		if fromEnts[e.FileName] == nil {
+			changed[e.FileName] = true
+		}
+	}
+	return changed
+}
+
+// sameEntry reports whether a and b refer to the same file revision
+// with the same flags. A nil entry (an absent file) is only the same
+// as another nil entry.
+func sameEntry(a, b *hg_store.ManifestEnt) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	idA, errA := a.Id()
+	idB, errB := b.Id()
+	if errA != nil || errB != nil {
+		return false
+	}
+	return idA.Eq(idB) && a.IsExecutable() == b.IsExecutable() && a.IsLink() == b.IsLink()
+}
+
+// MergeCommitDiffs returns the diff of the commit against each of its
+// parents, keyed by parent commit ID. For a merge commit, comparing
+// the diffs shows how the merge combined (and possibly changed
+// independently of) each side. A non-merge commit has a single entry
+// for its only parent, and a root commit has no entries.
+func (r *Repository) MergeCommitDiffs(id vcs.CommitID) (map[vcs.CommitID]*vcs.Diff, error) {
+	c, err := r.GetCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make(map[vcs.CommitID]*vcs.Diff, len(c.Parents))
+	for _, p := range c.Parents {
+		d, err := r.Diff(p, c.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		diffs[p] = d
+	}
+	return diffs, nil
+}
@@ -0,0 +1,208 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_MergeBase(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// 0 -- 1 -- 3
+		//  \       /
+		//   `-- 2 '     4 (unrelated root)
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"root", "left", "right", "merge", "unrelated"},
+			[][]int{nil, {0}, {0}, {1, 2}, nil},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		a, b    int
+		want    int
+		wantErr error
+	}{
+		"linear":    {a: 1, b: 0, want: 0},
+		"same":      {a: 1, b: 1, want: 1},
+		"fork":      {a: 1, b: 2, want: 0},
+		"merge p1":  {a: 3, b: 1, want: 1},
+		"merge p2":  {a: 2, b: 3, want: 2},
+		"unrelated": {a: 3, b: 4, wantErr: ErrNoMergeBase},
+	}
+	for rev, want := range []uint{1, 2, 2, 4, 1} {
+		if n, err := r.CommitCount(vcs.CommitID(ids[rev])); err != nil || n != want {
+			t.Errorf("CommitCount(rev %d): got %d, %v, want %d", rev, n, err, want)
+		}
+	}
+
+	for label, test := range tests {
+		base, err := r.MergeBase(vcs.CommitID(ids[test.a]), vcs.CommitID(ids[test.b]))
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+			continue
+		}
+		if test.wantErr == nil && base != vcs.CommitID(ids[test.want]) {
+			t.Errorf("%s: got merge base %s, want %s", label, base, ids[test.want])
+		}
+	}
+}
+
+func TestRepository_Parents(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"root", "left", "right", "merge"},
+			[][]int{nil, {0}, {0}, {2, 1}},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	for rev, want := range [][]int{nil, {0}, {0}, {2, 1}} {
+		parents, err := r.Parents(vcs.CommitID(ids[rev]))
+		if err != nil {
+			t.Errorf("rev %d: %s", rev, err)
+			continue
+		}
+		var wantIDs []vcs.CommitID
+		for _, p := range want {
+			wantIDs = append(wantIDs, vcs.CommitID(ids[p]))
+		}
+		if !reflect.DeepEqual(parents, wantIDs) {
+			t.Errorf("rev %d: got parents %v, want %v", rev, parents, wantIDs)
+		}
+		c, err := r.GetCommit(vcs.CommitID(ids[rev]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parents, c.Parents) {
+			t.Errorf("rev %d: got parents %v, but GetCommit's parents are %v", rev, parents, c.Parents)
+		}
+	}
+}
+
+func TestRepository_CommitsBetween(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// 0 -- 1 ------- 5 -- 7 (head)
+		//  \            /
+		//   2 -- 3 ----'
+		//    \     \
+		//     4     6 (base)
+		//
+		// 4 is on an unrelated branch, so it isn't included even though
+		// it is between head and base in revision order.
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"root", "a", "b", "c", "unrelated", "merge", "base", "d"},
+			[][]int{nil, {0}, {0}, {2}, {2}, {1, 3}, {3}, {5}},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	commits, err := r.CommitsBetween(vcs.CommitID(ids[6]), vcs.CommitID(ids[7]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []vcs.CommitID
+	for _, c := range commits {
+		got = append(got, c.ID)
+	}
+	want := []vcs.CommitID{vcs.CommitID(ids[7]), vcs.CommitID(ids[5]), vcs.CommitID(ids[1])}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got commits %v, want %v", got, want)
+	}
+}
+
+func TestRepository_MergePreview(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commits 1 and 2 both branch off of commit 0, and commit 3 is
+		// an unrelated root.
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{files: map[string]string{"same": "0", "both": "0", "one": "0", "del": "0", "mode": "0"}},
+			{parents: []int{0}, files: map[string]string{"same": "1", "both": "a", "one": "1", "mode\x00x": "0", "new": "a"}},
+			{parents: []int{0}, files: map[string]string{"same": "1", "both": "b", "one": "0", "del": "1", "mode": "0", "new": "b"}},
+			{files: map[string]string{"same": "0"}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		a, b    int
+		want    []string
+		wantErr error
+	}{
+		// same was changed identically on both sides, and one and mode
+		// were only changed on one side, so they aren't candidates. del
+		// was removed on one side and modified on the other.
+		"fork":       {a: 1, b: 2, want: []string{"both", "del", "new"}},
+		"fork (b a)": {a: 2, b: 1, want: []string{"both", "del", "new"}},
+		"ancestor":   {a: 1, b: 0, want: nil},
+		"same":       {a: 1, b: 1, want: nil},
+		"unrelated":  {a: 1, b: 3, wantErr: ErrNoMergeBase},
+	}
+	for label, test := range tests {
+		paths, err := r.MergePreview(vcs.CommitID(ids[test.a]), vcs.CommitID(ids[test.b]))
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("%s: got paths %q, want %q", label, paths, test.want)
+		}
+	}
+}
+
+func TestRepository_MergeCommitDiffs(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 modifies a, commit 2 adds b, and commit 3 merges them.
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{files: map[string]string{"a": "0\n"}},
+			{parents: []int{0}, files: map[string]string{"a": "1\n"}},
+			{parents: []int{0}, files: map[string]string{"a": "0\n", "b": "b\n"}},
+			{parents: []int{1, 2}, files: map[string]string{"a": "1\n", "b": "b\n"}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	const (
+		diffA = "diff --git a a\n--- a\n+++ a\n@@ -1 +1 @@\n-0\n+1\n"
+		diffB = "diff --git b b\nnew file mode 100644\n--- /dev/null\n+++ b\n@@ -0,0 +1 @@\n+b\n"
+	)
+	tests := map[string]struct {
+		rev  int
+		want map[int]string // diff against each parent
+	}{
+		"merge":     {rev: 3, want: map[int]string{1: diffB, 2: diffA}},
+		"non-merge": {rev: 1, want: map[int]string{0: diffA}},
+		"root":      {rev: 0, want: map[int]string{}},
+	}
+	for label, test := range tests {
+		diffs, err := r.MergeCommitDiffs(vcs.CommitID(ids[test.rev]))
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		got := make(map[int]string, len(diffs))
+		for p, d := range diffs {
+			rev := -1
+			for i, id := range ids {
+				if vcs.CommitID(id) == p {
+					rev = i
+				}
+			}
+			got[rev] = d.Raw
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got diffs %q, want %q", label, got, test.want)
+		}
+	}
+
+	if _, err := r.MergeCommitDiffs("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
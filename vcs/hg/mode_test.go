@@ -0,0 +1,79 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_FileSystem_Mode(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// The files' revlogs aren't written, so Mode must not read them.
+		id = writeTestRepoTree(t, dir, []string{"a", "b/run.sh\x00x", "link\x00l"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := fs.(vcs.ModeReader)
+
+	tests := map[string]os.FileMode{
+		"a":        0,
+		"/a":       0,
+		"b/run.sh": 0111,
+		"link":     os.ModeSymlink,
+		"b":        os.ModeDir,
+		".":        os.ModeDir,
+	}
+	for name, want := range tests {
+		got, err := m.Mode(name)
+		if err != nil {
+			t.Errorf("%q: %s", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got mode %v, want %v", name, got, want)
+		}
+	}
+
+	if _, err := m.Mode("doesntexist"); !os.IsNotExist(err) {
+		t.Errorf("doesntexist: got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestRepository_FileSystem_ReadDirModes(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// dir1 is only implied by the path of the file in it, since hg
+		// doesn't track directories. The files' revlogs aren't written,
+		// so ReadDir must not read them.
+		id = writeTestRepoTree(t, dir, []string{"file1", "exec1\x00x", "link1\x00l", "dir1/file2"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := fs.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := make(map[string]os.FileMode, len(entries))
+	for _, e := range entries {
+		modes[e.Name()] = e.Mode()
+	}
+	want := map[string]os.FileMode{
+		"file1": 0,
+		"exec1": 0111,
+		"link1": os.ModeSymlink,
+		"dir1":  os.ModeDir,
+	}
+	if !reflect.DeepEqual(modes, want) {
+		t.Errorf("got modes %v, want %v", modes, want)
+	}
+}
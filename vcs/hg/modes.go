@@ -0,0 +1,51 @@
+package hg
+
+import (
+	"os"
+	"time"
+
+	hg_changelog "github.com/beyang/hgo/changelog"
+	hg_revlog "github.com/beyang/hgo/revlog"
+)
+
+// rawManifest returns the raw manifest data of the changelog record
+// rec.
+func rawManifest(st *store, rec *hg_revlog.Rec, fb *hg_revlog.FileBuilder) ([]byte, error) {
+	c, err := hg_changelog.BuildEntry(rec, fb)
+	if err != nil {
+		return nil, err
+	}
+	mrec, err := manifestRec(st, c)
+	if err != nil {
+		return nil, err
+	}
+	return st.build(fb, mrec)
+}
+
+// Mode implements vcs.ModeReader. It reads only the manifest, not the
+// file's revlog, so it is much cheaper than Lstat for listing many
+// files' modes.
+func (fs *hgFSNative) Mode(name string) (os.FileMode, error) {
+	name, err := cleanPath("mode", name)
+	if err != nil {
+		return 0, err
+	}
+	if fs.caseInsensitive {
+		if name, err = fs.matchPathFold(name); err != nil {
+			return 0, err
+		}
+	}
+
+	ent, err := fs.manifestEntry(fs.at, name)
+	if err == ErrFileNotInManifest {
+		fi, err := fs.dirStat(name)
+		if err != nil {
+			return 0, err
+		}
+		return fi.Mode(), nil
+	}
+	if err != nil {
+		return 0, standardizeHgError(err)
+	}
+	return fileInfo(ent, time.Time{}).Mode(), nil
+}
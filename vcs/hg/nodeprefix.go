@@ -0,0 +1,86 @@
+package hg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+)
+
+// ErrAmbiguousRevision is returned when resolving a node ID prefix
+// that matches more than one commit.
+var ErrAmbiguousRevision = errors.New("ambiguous revision: node ID prefix matches multiple commits")
+
+// isNodePrefix reports whether s could be an abbreviated (shorter than
+// 40 hex digits) node ID.
+func isNodePrefix(s string) bool {
+	if len(s) == 0 || len(s) >= 40 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// A nodePrefixRevSpec is a RevisionSpec for the unique changelog
+// record whose node ID (in hex) starts with the prefix. Every record
+// in the changelog is compared, so lookups are proportional to the
+// size of the history. If no record matches, ErrRevNotFound is
+// returned; if more than one does, ErrAmbiguousRevision is.
+type nodePrefixRevSpec string
+
+func (s nodePrefixRevSpec) Lookup(idx *hg_revlog.Index) (*hg_revlog.Rec, error) {
+	prefix := decodeNodePrefix(string(s))
+	tip := idx.Tip()
+	var match *hg_revlog.Rec
+	for rev := 0; tip != nil && rev <= tip.FileRev(); rev++ {
+		rec, err := hg_revlog.FileRevSpec(rev).Lookup(idx)
+		if err != nil {
+			return nil, err
+		}
+		if !prefix.matches(rec.Id()) {
+			continue
+		}
+		if match != nil {
+			return nil, ErrAmbiguousRevision
+		}
+		match = rec
+	}
+	if match == nil {
+		return nil, hg_revlog.ErrRevNotFound
+	}
+	return match, nil
+}
+
+// A nodePrefix is a decoded node ID prefix, so that node IDs can be
+// compared to it without encoding them in hex: full holds the bytes
+// of its pairs of hex digits and, if it has an odd number of digits,
+// half is the value of the last one (and otherwise -1).
+type nodePrefix struct {
+	full []byte
+	half int
+}
+
+// decodeNodePrefix decodes s, which must satisfy isNodePrefix.
+func decodeNodePrefix(s string) nodePrefix {
+	n := len(s) &^ 1
+	full, _ := hex.DecodeString(s[:n])
+	p := nodePrefix{full: full, half: -1}
+	if n < len(s) {
+		b, _ := hex.DecodeString("0" + s[n:])
+		p.half = int(b[0])
+	}
+	return p
+}
+
+// matches reports whether the node ID id starts with p.
+func (p nodePrefix) matches(id []byte) bool {
+	if !bytes.HasPrefix(id, p.full) {
+		return false
+	}
+	return p.half < 0 || len(id) > len(p.full) && int(id[len(p.full)]>>4) == p.half
+}
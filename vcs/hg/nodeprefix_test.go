@@ -0,0 +1,103 @@
+package hg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestIsNodePrefix(t *testing.T) {
+	tests := map[string]bool{
+		"":                      false,
+		"a1b2c3":                true,
+		"A1B2C3":                true,
+		"123":                   true,
+		"tip":                   false,
+		"a1b2c3g":               false,
+		strings.Repeat("a", 39): true,
+		strings.Repeat("a", 40): false,
+	}
+	for s, want := range tests {
+		if got := isNodePrefix(s); got != want {
+			t.Errorf("%q: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestNodePrefixMatches(t *testing.T) {
+	id := []byte{0xa1, 0xb2, 0xc3}
+	tests := map[string]bool{
+		"a":       true,
+		"A1":      true,
+		"a1b":     true,
+		"a1b2c3":  true,
+		"b":       false,
+		"a2":      false,
+		"a1c":     false,
+		"a1b2c4":  false,
+		"a1b2c3d": false,
+	}
+	for s, want := range tests {
+		if got := decodeNodePrefix(s).matches(id); got != want {
+			t.Errorf("%q: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestRepository_ResolveRevision_nodePrefix(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// With more commits than hex digits, at least two node IDs share
+		// their first digit.
+		messages := make([]string, 17)
+		for i := range messages {
+			messages[i] = fmt.Sprintf("commit%d", i)
+		}
+		ids = writeTestRepo(t, dir, messages...)
+	})
+	defer os.RemoveAll(dir)
+
+	// sharing returns the number of node IDs that start with prefix.
+	sharing := func(prefix string) int {
+		n := 0
+		for _, id := range ids {
+			if strings.HasPrefix(id, prefix) {
+				n++
+			}
+		}
+		return n
+	}
+
+	isRevNum := func(s string) bool {
+		i, err := strconv.Atoi(s)
+		return err == nil && i < len(ids)
+	}
+
+	for _, id := range ids {
+		if got, err := r.ResolveRevision(id); err != nil || got != vcs.CommitID(id) {
+			t.Errorf("full ID %s: got %q, %v", id, got, err)
+		}
+
+		// Numeric prefixes that are also local revision numbers
+		// resolve as revision numbers, so skip them.
+		n := 1
+		for sharing(id[:n]) > 1 || isRevNum(id[:n]) {
+			n++
+		}
+		if got, err := r.ResolveRevision(id[:n]); err != nil || got != vcs.CommitID(id) {
+			t.Errorf("unique prefix %s: got %q, %v, want %q", id[:n], got, err, id)
+		}
+		if got, err := r.ResolveRevision(strings.ToUpper(id[:n])); err != nil || got != vcs.CommitID(id) {
+			t.Errorf("uppercase unique prefix %s: got %q, %v, want %q", id[:n], got, err, id)
+		}
+		if n > 1 && sharing(id[:n-1]) > 1 && !isRevNum(id[:n-1]) {
+			if _, err := r.ResolveRevision(id[:n-1]); err != ErrAmbiguousRevision {
+				t.Errorf("ambiguous prefix %s: got error %v, want %v", id[:n-1], err, ErrAmbiguousRevision)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package hg
+
+import (
+	"errors"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// NullCommitID is the ID of hg's null revision, the (empty) parent of
+// root commits and of a working directory that has nothing checked
+// out. It is what the revision spec "null" resolves to.
+const NullCommitID vcs.CommitID = "0000000000000000000000000000000000000000"
+
+// ErrNullCommit is returned by GetCommit for NullCommitID: the null
+// revision isn't a commit, so it has no author, message, or parents.
+var ErrNullCommit = errors.New("the null revision is not a commit")
+
+// nullRev is the changelog revision number of the null revision.
+const nullRev = hg_revlog.FileRevSpec(-1)
+
+// nullFileSystem returns the FileSystem at the null revision, which
+// has no files, so that (e.g.) a root commit can be diffed against
+// it. Its manifest is set up front, so it never reads the changelog.
+func (r *Repository) nullFileSystem() *hgFSNative {
+	return &hgFSNative{
+		dir:  r.Dir,
+		at:   nullRev,
+		repo: r.u,
+		st:   r.st,
+		cl:   r.state().cl,
+
+		manifests: r.manifests,
+		blobs:     newBlobCache(defaultBlobCacheBytes),
+
+		m: hg_store.Manifest{},
+	}
+}
@@ -0,0 +1,68 @@
+package hg
+
+import (
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_nullRevision(t *testing.T) {
+	r, dir := makeTestRepo(t, func(dir string) {
+		writeTestRepo(t, dir, "commit1")
+	})
+	defer os.RemoveAll(dir)
+
+	if id, err := r.ResolveRevision("null"); err != nil || id != NullCommitID {
+		t.Errorf("ResolveRevision(null): got %q, %v, want %q", id, err, NullCommitID)
+	}
+	if _, err := r.GetCommit(NullCommitID); err != ErrNullCommit {
+		t.Errorf("GetCommit(NullCommitID): got error %v, want %v", err, ErrNullCommit)
+	}
+
+	fs, err := r.FileSystem(NullCommitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fis, err := fs.ReadDir("."); err != nil || len(fis) != 0 {
+		t.Errorf("ReadDir(.): got %d entries, %v, want none", len(fis), err)
+	}
+	if fi, err := fs.Stat("."); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(.): got %v, %v, want a directory", fi, err)
+	}
+	if _, err := fs.Stat("f"); !os.IsNotExist(err) {
+		t.Errorf("Stat(f): got error %v, want not-exist error", err)
+	}
+	if _, err := fs.Open("f"); !os.IsNotExist(err) {
+		t.Errorf("Open(f): got error %v, want not-exist error", err)
+	}
+}
+
+func TestRepository_FileSystem_emptyCommitRoot(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// A commit with no files, like one that removed every file.
+		id = writeTestRepoTree(t, dir, nil)
+	})
+	defer os.RemoveAll(dir)
+	for _, at := range []vcs.CommitID{vcs.CommitID(id), NullCommitID} {
+		fs, err := r.FileSystem(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{".", "/", "", "./"} {
+			if fi, err := fs.Stat(name); err != nil || !fi.IsDir() {
+				t.Errorf("%s: Stat(%q): got %v, %v, want a directory", at, name, fi, err)
+			}
+			if fi, err := fs.Lstat(name); err != nil || !fi.IsDir() {
+				t.Errorf("%s: Lstat(%q): got %v, %v, want a directory", at, name, fi, err)
+			}
+		}
+		if fis, err := fs.ReadDir("."); err != nil || len(fis) != 0 {
+			t.Errorf("%s: ReadDir(.): got %d entries, %v, want none", at, len(fis), err)
+		}
+		if _, err := fs.Stat("d"); !os.IsNotExist(err) {
+			t.Errorf("%s: Stat(d): got error %v, want not-exist error", at, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/beyang/hgo"
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestOpenNotARepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	writeTestFiles(t, dir, map[string]string{"file": "", "hgfile/.hg": ""})
+
+	for label, dir := range map[string]string{
+		"empty dir":   dir,
+		"file":        file,
+		".hg is file": filepath.Join(dir, "hgfile"),
+		"nonexistent": filepath.Join(dir, "nonexistent"),
+	} {
+		_, err := Open(dir)
+		if e, ok := err.(*OpenError); !ok || e.Err != vcs.ErrNotARepository || e.Dir != dir {
+			t.Errorf("%s: got error %v (%T), want *OpenError for %s wrapping vcs.ErrNotARepository", label, err, err, dir)
+		}
+	}
+}
+
+// A countingStore counts the filelogs opened through it.
+type countingStore struct {
+	Store
+	opened []string
+}
+
+func (s *countingStore) OpenRevlog(fileName string) (*hg_revlog.Index, error) {
+	s.opened = append(s.opened, fileName)
+	return s.Store.OpenRevlog(fileName)
+}
+
+func TestOpenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := writeTestRepoContents(t, dir, map[string]string{"a": "hello\n"})
+	u, err := hgo.OpenRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &countingStore{Store: u.NewStore()}
+	r, err := OpenStore(dir, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := vfs.ReadFile(fs, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello\n" {
+		t.Errorf("got contents %q, want %q", data, "hello\n")
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(st.opened, want) {
+		t.Errorf("got filelogs %q opened through the store, want %q", st.opened, want)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build go1.16
+// +build go1.16
+
+package hg
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// OpenFS opens the hg repository whose .hg directory is at the root of
+// fsys, such as a repository embedded in the binary with embed.FS or
+// built in memory with testing/fstest.MapFS. If fsys has no .hg
+// directory, an *OpenError wrapping vcs.ErrNotARepository is
+// returned.
+//
+// The native hg implementation (hgo) reads revlogs, tags, and branch
+// heads from local files, and can't read them from an fs.FS, so the
+// .hg directory is copied to a new temporary directory (which Close
+// removes) and the repository is opened from there; the working
+// directory's files aren't copied, since they aren't needed to read
+// commits. The copy makes OpenFS take time and disk space
+// proportional to the size of the repository's history. (To read
+// just the revlogs from elsewhere without copying them, see
+// OpenStore.) The Dir of an *OpenError returned by OpenFS is ".",
+// the root of fsys, not the temporary directory.
+func OpenFS(fsys fs.FS) (*Repository, error) {
+	if fi, err := fs.Stat(fsys, ".hg"); err != nil || !fi.IsDir() {
+		return nil, &OpenError{Dir: ".", Err: vcs.ErrNotARepository}
+	}
+
+	dir, err := os.MkdirTemp("", "go-vcs-hg")
+	if err != nil {
+		return nil, err
+	}
+	if err := copyFS(dir, fsys, ".hg"); err != nil {
+		os.RemoveAll(dir)
+		return nil, &OpenError{Dir: ".", Err: err}
+	}
+	r, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		if e, ok := err.(*OpenError); ok {
+			e.Dir = "."
+		}
+		return nil, err
+	}
+	r.tempDir = dir
+	return r, nil
+}
+
+// copyFS copies the tree at root in fsys to the same path under dir.
+func copyFS(dir string, fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0700)
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0600)
+	})
+}
@@ -0,0 +1,72 @@
+//go:build go1.16
+// +build go1.16
+
+package hg
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestOpenFSNotARepository(t *testing.T) {
+	_, err := OpenFS(fstest.MapFS{"file": {Data: []byte("x")}})
+	if !errors.Is(err, vcs.ErrNotARepository) {
+		t.Errorf("got error %v, want one wrapping vcs.ErrNotARepository", err)
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Load a repository written to disk into memory, to open it from
+	// there.
+	ids := writeTestRepo(t, dir, "commit1", "commit2")
+	fsys := fstest.MapFS{}
+	if err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fsys[filepath.ToSlash(rel)] = &fstest.MapFile{Data: data}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.GetCommit(vcs.CommitID(ids[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Message != "commit2" {
+		t.Errorf("got message %q, want %q", commit.Message, "commit2")
+	}
+
+	tempDir := r.tempDir
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("after Close: got error %v from Stat of the temporary copy, want it removed", err)
+	}
+}
@@ -0,0 +1,59 @@
+package hg
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// ErrPathOutsideRepo is returned (in an *os.PathError) by the
+// FileSystem methods when a path refers to a location outside of the
+// repository's root (e.g., "../a" or "a/../../b").
+var ErrPathOutsideRepo = errors.New("path is outside of the repository")
+
+// cleanPath returns name as a manifest path: relative to the root,
+// with "/" separators, and cleaned as by path.Clean (so that, e.g.,
+// "./a/", "/a", and "b/../a" all become "a", and the root is "."). If
+// name escapes the root, an *os.PathError with the operation op and
+// the error ErrPathOutsideRepo is returned.
+func cleanPath(op, name string) (string, error) {
+	p := path.Clean(filepath.ToSlash(internal.Rel(name)))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrPathOutsideRepo}
+	}
+	return p, nil
+}
+
+// Exists implements vcs.ExistsChecker. Files are looked up in the
+// manifest and directories in the directory index built from it, so
+// no file's revlog (or even the commit's changeset) is read.
+func (fs *hgFSNative) Exists(name string) (bool, error) {
+	name, err := cleanPath("exists", name)
+	if err != nil {
+		return false, err
+	}
+	if name == "." {
+		return true, nil
+	}
+	if fs.caseInsensitive {
+		if name, err = fs.matchPathFold(name); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := fs.manifestEntry(fs.at, name); err == nil {
+		return true, nil
+	} else if err != ErrFileNotInManifest {
+		return false, standardizeHgError(err)
+	}
+	idx, err := fs.dirIndex()
+	if err != nil {
+		return false, err
+	}
+	_, ok := idx[name]
+	return ok, nil
+}
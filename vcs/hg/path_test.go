@@ -0,0 +1,157 @@
+package hg
+
+import (
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := map[string]string{
+		"":          ".",
+		".":         ".",
+		"/":         ".",
+		"./":        ".",
+		"a":         "a",
+		"./a":       "a",
+		"/a":        "a",
+		"a/":        "a",
+		"./a/b/":    "a/b",
+		"a//b":      "a/b",
+		"a/../b":    "b",
+		"a/./b/..":  "a",
+		"a/b/../..": ".",
+	}
+	for name, want := range tests {
+		got, err := cleanPath("open", name)
+		if err != nil {
+			t.Errorf("%q: %s", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+
+	for _, name := range []string{"..", "../a", "./..", "a/../..", "a/../../b", "/../a"} {
+		_, err := cleanPath("open", name)
+		if pe, ok := err.(*os.PathError); !ok || pe.Op != "open" || pe.Path != name || pe.Err != ErrPathOutsideRepo {
+			t.Errorf("%q: got error %v, want *os.PathError wrapping ErrPathOutsideRepo", name, err)
+		}
+	}
+}
+
+func TestRepository_FileSystem_cleanPaths(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = writeTestRepoContents(t, dir, map[string]string{"a": "a", "b/c": "c"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"b", "./b", "b/", "./b/", "a/../b"} {
+		fis, err := fs.ReadDir(name)
+		if err != nil {
+			t.Errorf("ReadDir(%q): %s", name, err)
+		} else if len(fis) != 1 || fis[0].Name() != "c" {
+			t.Errorf("ReadDir(%q): got %d entries, want just c", name, len(fis))
+		}
+		if fi, err := fs.Lstat(name); err != nil {
+			t.Errorf("Lstat(%q): %s", name, err)
+		} else if !fi.IsDir() {
+			t.Errorf("Lstat(%q): got mode %v, want a directory", name, fi.Mode())
+		}
+	}
+
+	isOutside := func(err error) bool {
+		pe, ok := err.(*os.PathError)
+		return ok && pe.Err == ErrPathOutsideRepo
+	}
+	for _, name := range []string{"..", "../a", "b/../../a"} {
+		if _, err := fs.Open(name); !isOutside(err) {
+			t.Errorf("Open(%q): got error %v, want ErrPathOutsideRepo", name, err)
+		}
+		if _, err := fs.Stat(name); !isOutside(err) {
+			t.Errorf("Stat(%q): got error %v, want ErrPathOutsideRepo", name, err)
+		}
+		if _, err := fs.Lstat(name); !isOutside(err) {
+			t.Errorf("Lstat(%q): got error %v, want ErrPathOutsideRepo", name, err)
+		}
+		if _, err := fs.ReadDir(name); !isOutside(err) {
+			t.Errorf("ReadDir(%q): got error %v, want ErrPathOutsideRepo", name, err)
+		}
+		if _, err := fs.(vcs.SymlinkReader).ReadLink(name); !isOutside(err) {
+			t.Errorf("ReadLink(%q): got error %v, want ErrPathOutsideRepo", name, err)
+		}
+	}
+
+	files, errs := fs.(*hgFSNative).OpenMulti([]string{"./a", "b/../a", "../a", "d"})
+	if len(files) != 2 || files["./a"] == nil || files["b/../a"] == nil {
+		t.Errorf("OpenMulti: got files %v, want ./a and b/../a", files)
+	}
+	if len(errs) != 2 || !isOutside(errs["../a"]) {
+		t.Errorf("OpenMulti: got errors %v, want ErrPathOutsideRepo for ../a", errs)
+	}
+	if pe, ok := errs["d"].(*os.PathError); !ok || pe.Op != "open" || pe.Path != "d" || pe.Err != os.ErrNotExist {
+		t.Errorf("OpenMulti: got error %v for d, want *os.PathError wrapping os.ErrNotExist", errs["d"])
+	}
+}
+
+func TestRepository_FileSystem_Exists(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// The files' revlogs aren't written, so Exists must not read them.
+		id = writeTestRepoTree(t, dir, []string{"a", "b/c/d", "link\x00l"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := fs.(vcs.ExistsChecker)
+
+	tests := map[string]bool{
+		".":       true,
+		"a":       true,
+		"/a":      true,
+		"b":       true,
+		"b/c":     true,
+		"b/c/d":   true,
+		"link":    true,
+		"b/":      true,
+		"c":       false,
+		"b/d":     false,
+		"a/x":     false,
+		"b/c/d/e": false,
+	}
+	for name, want := range tests {
+		got, err := e.Exists(name)
+		if err != nil {
+			t.Errorf("%q: %s", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got %v, want %v", name, got, want)
+		}
+	}
+
+	if _, err := e.Exists("../a"); err == nil {
+		t.Error("../a: got no error, want ErrPathOutsideRepo")
+	}
+
+	// Case-insensitively, directories are matched as well as files.
+	r.CaseInsensitivePaths = true
+	if fs, err = r.FileSystem(vcs.CommitID(id)); err != nil {
+		t.Fatal(err)
+	}
+	e = fs.(vcs.ExistsChecker)
+	for _, name := range []string{"A", "B", "B/C", "b/C/D"} {
+		if ok, err := e.Exists(name); err != nil || !ok {
+			t.Errorf("%q (case-insensitive): got %v, %v, want true", name, ok, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package hg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+)
+
+// Commit phases, as stored in hg's phaseroots file.
+const (
+	phasePublic = 0
+	phaseDraft  = 1
+	phaseSecret = 2
+)
+
+// readPhaseRoots reads the phase roots (the commits at which a
+// non-public phase begins), mapping the changelog revision number of
+// each root in cl to its phase. Roots that aren't in cl (e.g.,
+// stripped commits) are ignored. If the repository has no phase data,
+// an empty map is returned.
+func (r *Repository) readPhaseRoots(cl *hg_revlog.Index) (map[int]int, error) {
+	data, err := ioutil.ReadFile(r.storeFile("phaseroots"))
+	if os.IsNotExist(err) {
+		return map[int]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	roots := map[int]int{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := bytes.Fields(s.Bytes())
+		if len(fields) != 2 {
+			continue
+		}
+		phase, err := strconv.Atoi(string(fields[0]))
+		if err != nil || phase <= phasePublic {
+			continue
+		}
+		if _, err := hex.DecodeString(string(fields[1])); err != nil {
+			return nil, fmt.Errorf("malformed phaseroots entry %q", s.Text())
+		}
+		rec, err := hg_revlog.NodeIdRevSpec(string(fields[1])).Lookup(cl)
+		if err != nil {
+			continue
+		}
+		if phase > roots[rec.FileRev()] {
+			roots[rec.FileRev()] = phase
+		}
+	}
+	return roots, s.Err()
+}
+
+// phases returns the phase of each commit, indexed by changelog
+// revision number. A commit's phase is the highest of its parents'
+// phases and, if it is a phase root, the root's phase.
+func (r *Repository) phases() ([]int, error) {
+	cl := r.state().cl
+	roots, err := r.readPhaseRoots(cl)
+	if err != nil {
+		return nil, err
+	}
+	tip := cl.Tip()
+	if tip == nil || tip.FileRev() < 0 {
+		return nil, nil
+	}
+
+	phases := make([]int, tip.FileRev()+1)
+	if len(roots) == 0 {
+		return phases, nil
+	}
+	for rev := range phases {
+		rec, err := hg_revlog.FileRevSpec(rev).Lookup(cl)
+		if err != nil {
+			return nil, err
+		}
+		phase := roots[rev]
+		for _, p := range parentRecs(rec) {
+			if phases[p.FileRev()] > phase {
+				phase = phases[p.FileRev()]
+			}
+		}
+		phases[rev] = phase
+	}
+	return phases, nil
+}
+
+// PhaseSummary returns the number of commits in each phase. Public
+// commits have been published (e.g., pushed to a publishing
+// repository); draft commits haven't, and are published by the next
+// push; secret commits are never pushed. A repository without phase
+// data has only public commits.
+func (r *Repository) PhaseSummary() (publicCount, draftCount, secretCount int, err error) {
+	phases, err := r.phases()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, phase := range phases {
+		switch phase {
+		case phasePublic:
+			publicCount++
+		case phaseDraft:
+			draftCount++
+		default:
+			secretCount++
+		}
+	}
+	return publicCount, draftCount, secretCount, nil
+}
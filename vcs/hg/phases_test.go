@@ -0,0 +1,27 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepository_PhaseSummary(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2", "commit3", "commit4")
+	})
+	defer os.RemoveAll(dir)
+	if pub, draft, secret, err := r.PhaseSummary(); err != nil || pub != 4 || draft != 0 || secret != 0 {
+		t.Errorf("no phase data: got %d public, %d draft, %d secret (err %v), want 4 public", pub, draft, secret, err)
+	}
+
+	phaseRoots := "1 " + ids[1] + "\n2 " + ids[3] + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".hg", "store", "phaseroots"), []byte(phaseRoots), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if pub, draft, secret, err := r.PhaseSummary(); err != nil || pub != 1 || draft != 2 || secret != 1 {
+		t.Errorf("got %d public, %d draft, %d secret (err %v), want 1, 2, 1", pub, draft, secret, err)
+	}
+}
@@ -0,0 +1,28 @@
+package hg
+
+import (
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_ResolveBranch_externalCommit(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1")
+	})
+	defer os.RemoveAll(dir)
+	if id, err := r.ResolveBranch("default"); err != nil || id != vcs.CommitID(ids[0]) {
+		t.Fatalf("before external commit: got ResolveBranch %q, %v, want %q", id, err, ids[0])
+	}
+
+	// Simulate another process committing to the repository.
+	ids = writeTestRepo(t, dir, "commit1", "commit2")
+	if id, err := r.ResolveBranch("default"); err != nil || id != vcs.CommitID(ids[1]) {
+		t.Errorf("after external commit: got ResolveBranch %q, %v, want %q", id, err, ids[1])
+	}
+	if _, err := r.GetCommit(vcs.CommitID(ids[1])); err != nil {
+		t.Errorf("after external commit: GetCommit: %s", err)
+	}
+}
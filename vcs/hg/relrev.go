@@ -0,0 +1,101 @@
+package hg
+
+import (
+	"strconv"
+	"strings"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+)
+
+// A relativeStep is one "^N" or "~N" suffix of a relative revision
+// spec: it moves to the parent'th parent (1 for the first parent, 2
+// for the second, and 0 for the commit itself), n times.
+type relativeStep struct {
+	parent, n int
+}
+
+// splitRelativeSpec splits a relative revision spec such as "tip~3"
+// or "a1b2c3^2~1" into its base ("tip" or "a1b2c3") and the steps of
+// its suffixes, which are (like in hg revsets and git):
+//
+//	^   the first parent (the same as ^1)
+//	^N  the Nth parent (^0 is the commit itself)
+//	~   the first parent (the same as ~1)
+//	~N  the Nth first-parent ancestor
+//
+// The base is the shortest prefix of s after which the rest of s is a
+// sequence of such suffixes, so a base may itself contain "^" or "~"
+// if the rest doesn't parse. If s has no suffixes, ok is false.
+func splitRelativeSpec(s string) (base string, steps []relativeStep, ok bool) {
+	for i := 1; i < len(s); i++ {
+		if s[i] != '^' && s[i] != '~' {
+			continue
+		}
+		if steps, ok := parseRelativeSteps(s[i:]); ok {
+			return s[:i], steps, true
+		}
+	}
+	return "", nil, false
+}
+
+// parseRelativeSteps parses a non-empty sequence of "^N" and "~N"
+// suffixes (see splitRelativeSpec).
+func parseRelativeSteps(s string) ([]relativeStep, bool) {
+	var steps []relativeStep
+	for s != "" {
+		op := s[0]
+		if op != '^' && op != '~' {
+			return nil, false
+		}
+		s = s[1:]
+		end := strings.IndexAny(s, "^~")
+		if end < 0 {
+			end = len(s)
+		}
+		num := 1
+		if end > 0 {
+			var err error
+			if num, err = strconv.Atoi(s[:end]); err != nil || s[0] < '0' || s[0] > '9' {
+				return nil, false
+			}
+		}
+		s = s[end:]
+
+		if op == '^' {
+			steps = append(steps, relativeStep{parent: num, n: 1})
+		} else {
+			steps = append(steps, relativeStep{parent: 1, n: num})
+		}
+	}
+	return steps, true
+}
+
+// A relativeRevSpec is a RevisionSpec for the record reached by
+// walking the steps from the record that base refers to. If a step
+// walks past a root commit (or to a parent that a commit doesn't
+// have, such as the second parent of a non-merge), ErrRevNotFound is
+// returned.
+type relativeRevSpec struct {
+	base  hg_revlog.RevisionSpec
+	steps []relativeStep
+}
+
+func (s relativeRevSpec) Lookup(idx *hg_revlog.Index) (*hg_revlog.Rec, error) {
+	rec, err := s.base.Lookup(idx)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range s.steps {
+		if step.parent == 0 {
+			continue
+		}
+		for i := 0; i < step.n; i++ {
+			parents := parentRecs(rec)
+			if step.parent > len(parents) {
+				return nil, hg_revlog.ErrRevNotFound
+			}
+			rec = parents[step.parent-1]
+		}
+	}
+	return rec, nil
+}
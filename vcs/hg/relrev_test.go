@@ -0,0 +1,79 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestSplitRelativeSpec(t *testing.T) {
+	tests := map[string]struct {
+		base  string
+		steps []relativeStep
+		ok    bool
+	}{
+		"tip":        {},
+		"tip~3":      {base: "tip", steps: []relativeStep{{parent: 1, n: 3}}, ok: true},
+		"tip~":       {base: "tip", steps: []relativeStep{{parent: 1, n: 1}}, ok: true},
+		"a1b2^2~1":   {base: "a1b2", steps: []relativeStep{{parent: 2, n: 1}, {parent: 1, n: 1}}, ok: true},
+		"tip^^0":     {base: "tip", steps: []relativeStep{{parent: 1, n: 1}, {parent: 0, n: 1}}, ok: true},
+		"a^b~2":      {base: "a^b", steps: []relativeStep{{parent: 1, n: 2}}, ok: true},
+		"tip~x":      {},
+		"tip~+1":     {},
+		"tip~-1":     {},
+		"~1":         {},
+		"release~rc": {},
+	}
+	for spec, test := range tests {
+		base, steps, ok := splitRelativeSpec(spec)
+		if base != test.base || !reflect.DeepEqual(steps, test.steps) || ok != test.ok {
+			t.Errorf("%q: got (%q, %v, %v), want (%q, %v, %v)", spec, base, steps, ok, test.base, test.steps, test.ok)
+		}
+	}
+}
+
+func TestRepository_ResolveRevision_relative(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// 0 - 1 - 3 - 4
+		//  \     /
+		//   - 2 -
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"commit0", "commit1", "commit2", "merge", "commit4"},
+			[][]int{nil, {0}, {0}, {1, 2}, {3}},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]int{
+		"tip^0":            4,
+		"tip~":             3,
+		"tip~1":            3,
+		"tip^":             3,
+		"tip~2":            1,
+		"tip~3":            0,
+		"tip~1^2":          2,
+		"tip^^2~1":         0,
+		"default~1":        3,
+		"2^":               0,
+		ids[3][:12] + "^2": 2,
+	}
+	for spec, want := range tests {
+		id, err := r.ResolveRevision(spec)
+		if err != nil {
+			t.Errorf("%s: %s", spec, err)
+			continue
+		}
+		if id != vcs.CommitID(ids[want]) {
+			t.Errorf("%s: got %s, want %s (commit %d)", spec, id, ids[want], want)
+		}
+	}
+
+	for _, spec := range []string{"tip~4", "tip~1^3", "tip^2", "0^"} {
+		if _, err := r.ResolveRevision(spec); err != vcs.ErrRevisionNotFound {
+			t.Errorf("%s: got error %v, want %v", spec, err, vcs.ErrRevisionNotFound)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package hg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// RemoteClient is the HTTP client that RemoteResolve uses to query
+// remotes. Its timeout bounds how long RemoteResolve waits for a
+// remote that accepts connections but doesn't respond.
+var RemoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// RemoteError is returned by RemoteResolve when the remote can't be
+// reached or doesn't respond like an hg server.
+type RemoteError struct {
+	URL string
+	Err error
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("hg: remote %s is unreachable: %s", e.URL, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *RemoteError) Unwrap() error { return e.Err }
+
+// RemoteResolve resolves a revision spec against the hg repository
+// served over HTTP at remoteURL (as by `hg serve` or hgweb), without
+// cloning it. A branch name resolves to the branch's newest head, as
+// listed by the wire protocol's branchmap command; any other spec
+// (such as a tag, a bookmark, or a commit ID) is resolved by the
+// remote with the lookup command. If the remote can't be reached, the
+// error is a *RemoteError; if the remote can't resolve spec,
+// vcs.ErrRevisionNotFound is returned.
+//
+// It is meant for cheap checks (e.g., whether a mirror needs to be
+// updated) before deciding whether to fetch.
+func RemoteResolve(remoteURL, spec string) (vcs.CommitID, error) {
+	return RemoteResolveContext(context.Background(), remoteURL, spec)
+}
+
+// RemoteResolveContext is like RemoteResolve, but its requests to the
+// remote are canceled if ctx is canceled or its deadline is exceeded
+// (in which case the error is a *RemoteError wrapping ctx's error).
+func RemoteResolveContext(ctx context.Context, remoteURL, spec string) (vcs.CommitID, error) {
+	branchmap, err := remoteCommand(ctx, remoteURL, "branchmap", nil)
+	if err != nil {
+		return "", err
+	}
+	s := bufio.NewScanner(strings.NewReader(branchmap))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if branch, err := url.QueryUnescape(fields[0]); err == nil && branch == spec {
+			// Heads are listed oldest first.
+			return vcs.CommitID(fields[len(fields)-1]), nil
+		}
+	}
+
+	resp, err := remoteCommand(ctx, remoteURL, "lookup", url.Values{"key": {spec}})
+	if err != nil {
+		return "", err
+	}
+	// The response is "1 <node>" if spec was found, or "0 <error>".
+	f := strings.SplitN(strings.TrimSpace(resp), " ", 2)
+	if len(f) != 2 || f[0] != "1" {
+		return "", vcs.ErrRevisionNotFound
+	}
+	return vcs.CommitID(f[1]), nil
+}
+
+// remoteCommand runs a command of hg's HTTP wire protocol against the
+// remote at remoteURL with RemoteClient and returns its response.
+func remoteCommand(ctx context.Context, remoteURL, cmd string, args url.Values) (string, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", &RemoteError{URL: remoteURL, Err: err}
+	}
+	q := u.Query()
+	q.Set("cmd", cmd)
+	for k, vs := range args {
+		q[k] = vs
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", &RemoteError{URL: remoteURL, Err: err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/mercurial-0.1")
+	resp, err := RemoteClient.Do(req)
+	if err != nil {
+		return "", &RemoteError{URL: remoteURL, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &RemoteError{URL: remoteURL, Err: fmt.Errorf("%s command: HTTP status %s", cmd, resp.Status)}
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", &RemoteError{URL: remoteURL, Err: err}
+	}
+	return string(data), nil
+}
@@ -0,0 +1,71 @@
+package hg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRemoteResolve(t *testing.T) {
+	const (
+		a = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		b = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		c = "cccccccccccccccccccccccccccccccccccccccc"
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cmd") {
+		case "branchmap":
+			fmt.Fprintf(w, "default %s\nmy%%20branch %s %s\n", a, a, b)
+		case "lookup":
+			if r.URL.Query().Get("key") == "v1.0" {
+				fmt.Fprintf(w, "1 %s\n", c)
+			} else {
+				fmt.Fprint(w, "0 unknown revision\n")
+			}
+		default:
+			http.Error(w, "unknown command", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	tests := map[string]struct {
+		want    vcs.CommitID
+		wantErr error
+	}{
+		"default":   {want: a},
+		"my branch": {want: b},
+		"v1.0":      {want: c},
+		"nope":      {wantErr: vcs.ErrRevisionNotFound},
+	}
+	for spec, test := range tests {
+		id, err := RemoteResolve(ts.URL, spec)
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", spec, err, test.wantErr)
+			continue
+		}
+		if id != test.want {
+			t.Errorf("%s: got %q, want %q", spec, id, test.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := RemoteResolveContext(ctx, ts.URL, "default")
+	if e, ok := err.(*RemoteError); !ok {
+		t.Errorf("canceled: got error %v (%T), want *RemoteError", err, err)
+	} else if ue, ok := e.Err.(*url.Error); !ok || ue.Err != context.Canceled {
+		t.Errorf("canceled: got error %v, want one caused by context.Canceled", err)
+	}
+
+	ts.Close()
+	if _, err := RemoteResolve(ts.URL, "default"); err == nil {
+		t.Error("unreachable remote: got no error")
+	} else if _, ok := err.(*RemoteError); !ok {
+		t.Errorf("unreachable remote: got %T error, want *RemoteError", err)
+	}
+}
@@ -2,15 +2,18 @@ package hg
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"net/mail"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/beyang/hgo"
@@ -22,128 +25,547 @@ import (
 	"sourcegraph.com/sourcegraph/go-vcs/vcs/hgcmd"
 	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
 	"sourcegraph.com/sourcegraph/go-vcs/vcs/util"
-	"sourcegraph.com/sqs/pbtypes"
 )
 
+// Logger, if set, is used to log problems that don't cause an
+// operation to fail (for example, failing to read the branch heads
+// when opening a repository).
+var Logger *log.Logger
+
 func init() {
 	// Overwrite the hg opener to return repositories that use the
-	// faster native-Go hg implementation.
+	// faster native-Go hg implementation. (To fall back to the hg
+	// command for repositories that can't be opened natively, use
+	// OpenBackend.)
 	vcs.RegisterOpener("hg", func(dir string) (vcs.Repository, error) {
 		return Open(dir)
 	})
 }
 
+// A Repository is an hg repository read with the native Go hg
+// implementation, falling back to the hg command for operations that
+// it doesn't implement. It and its FileSystems are safe for concurrent
+// use, except that its options must be set before it is first used.
+// Refresh (which ResolveRevision and other methods call themselves if
+// the changelog has changed on disk) replaces the repository's state
+// as a whole, so the repository can be committed to or pulled into
+// while it is in use: each call sees either the old state or the new
+// one, and FileSystems keep reading the commit they were created at.
 type Repository struct {
 	*hgcmd.Repository
+
+	// CaseInsensitivePaths makes the FileSystems subsequently returned
+	// by FileSystem fall back to a case-insensitive match against the
+	// manifest when a file's path doesn't match exactly (e.g., so that
+	// "readme.md" opens "README.md"). If more than one file matches,
+	// ErrAmbiguousPath is returned. Directory paths are always matched
+	// exactly.
+	CaseInsensitivePaths bool
+
+	// ReadDirFollowSymlinks makes the ReadDir method of the FileSystems
+	// subsequently returned by FileSystem report each symlink with the
+	// type of its target (e.g., as a directory for a symlink to a
+	// directory), like Stat. Symlinks whose targets are outside the
+	// repository or don't exist are still reported as symlinks. By
+	// default, ReadDir reports symlinks as symlinks (with
+	// os.ModeSymlink), like Lstat.
+	ReadDirFollowSymlinks bool
+
+	// ReadDirLastCommits makes the ReadDir method of the FileSystems
+	// subsequently returned by FileSystem report, for each file, the
+	// date of the commit that last modified it as its ModTime, and
+	// that commit's ID in a vcs.LastCommitInfo as its Sys. This
+	// requires opening each file's revlog to map the file's revision
+	// back to the commit that introduced it, so it makes listing large
+	// directories much slower. By default, every entry's ModTime is
+	// the date of the FileSystem's commit. Subdirectories are always
+	// reported that way (see DirLastCommits for their last commits).
+	ReadDirLastCommits bool
+
+	// ReadDirSizes makes the ReadDir method of the FileSystems
+	// subsequently returned by FileSystem report the size of each
+	// file. Sizes are read from the files' revlog indexes without
+	// reading their contents, but each file's revlog must still be
+	// opened, so it makes listing large directories slower. By
+	// default, ReadDir reports every size as 0; Stat and Lstat always
+	// report sizes.
+	ReadDirSizes bool
+
+	// CanonicalParentOrder makes the commits returned by the
+	// repository list their parents sorted by commit ID, so that the
+	// order is reproducible (e.g., for tools that content-hash commit
+	// graphs) regardless of which parent hg recorded first. The first
+	// parent is then reported in the commit's FirstParent field. By
+	// default, parents are listed in hg's order (p1, then p2) and
+	// FirstParent is empty.
+	CanonicalParentOrder bool
+
+	// ExcludeTipTag makes Tags omit the synthetic "tip" tag, which hg
+	// adds to point to the newest commit in the repository. By
+	// default, it is included (as it is by `hg tags`). It can still be
+	// resolved with ResolveTag and ResolveRevision either way.
+	ExcludeTipTag bool
+
+	// MaxConcurrentReads, if positive, limits the number of file and
+	// manifest revlogs that the repository and its FileSystems open or
+	// read revisions from concurrently, to keep a busy process within
+	// its file descriptor limit. Opens and reads beyond the limit wait
+	// until others finish. It must be set before the repository is
+	// first used; by default, reads are unlimited. Close doesn't wait
+	// for reads in progress or release those waiting; it's up to the
+	// caller not to use the repository after closing it.
+	MaxConcurrentReads int
+
 	u           *hgo.Repository
-	st          *hg_store.Store
+	st          *store
+	manifests   *manifestCache // shared by the repository's FileSystems
+	resolutions resolveCache
+
+	// loaded holds the *repoState read by load; see state.
+	loaded    atomic.Value
+	refreshMu sync.Mutex // serializes calls to load
+
+	contentHashes contentHashes
+	depths        commitDepths
+
+	tempDir string // removed by Close (see OpenFS)
+}
+
+// repoState is the state of a repository that load reads from disk.
+// It is never modified once stored (except to cache the heads of all
+// branches, which are computed from cl on first use), so that Refresh
+// can replace it while it is being read.
+type repoState struct {
 	cl          *hg_revlog.Index
+	clSize      int64 // size of the changelog index file when cl was read
 	allTags     *hgo.Tags
 	branchHeads *hgo.BranchHeads
+
+	// branchHeadsErr is the error reading the branch heads, if any (in
+	// which case branchHeads is empty).
+	branchHeadsErr error
+
+	// bookmarks maps bookmark names to commit IDs, and bookmarksErr
+	// is the error reading them, if any (in which case bookmarks is
+	// empty).
+	bookmarks    map[string]vcs.CommitID
+	bookmarksErr error
+
+	// allHeads caches the heads of every branch, including those
+	// missing from branchHeads (see allBranchHeads).
+	allHeadsOnce sync.Once
+	allHeads     map[string][]branchHead
+	allHeadsErr  error
+}
+
+// state returns the repository's current state. Methods that use the
+// state more than once should call it once and use the result, so
+// that they see a consistent snapshot even if it is refreshed
+// concurrently.
+func (r *Repository) state() *repoState { return r.loaded.Load().(*repoState) }
+
+// An OpenError is returned by Open when dir can't be opened as an hg
+// repository. If dir has no .hg directory, Err is
+// vcs.ErrNotARepository, so that callers trying several VCSs can tell
+// that dir isn't an hg repository from a failure to read one that is
+// (e.g., because it is corrupt).
+type OpenError struct {
+	Dir string
+	Err error
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("hg: opening repository %s failed: %s", e.Dir, e.Err)
 }
 
+// Unwrap returns e.Err, so that errors.Is(err, vcs.ErrNotARepository)
+// reports whether err was caused by the directory not being an hg
+// repository.
+func (e *OpenError) Unwrap() error { return e.Err }
+
+// Open opens the hg repository rooted at dir. If it fails, the error
+// is an *OpenError.
 func Open(dir string) (*Repository, error) {
+	return OpenStore(dir, nil)
+}
+
+// OpenStore is like Open, but the repository's revlogs (its
+// changelog, manifests, and filelogs) are opened with st instead of
+// being read from dir's .hg/store directory. The rest of the
+// repository's metadata (such as its tags, branch heads, and
+// bookmarks) is still read from dir. If st is nil, OpenStore is the
+// same as Open.
+func OpenStore(dir string, st Store) (*Repository, error) {
+	if fi, err := os.Stat(filepath.Join(dir, ".hg")); err != nil || !fi.IsDir() {
+		return nil, &OpenError{Dir: dir, Err: vcs.ErrNotARepository}
+	}
 	r, err := hgo.OpenRepository(dir)
 	if err != nil {
-		return nil, err
+		return nil, &OpenError{Dir: dir, Err: err}
 	}
 
-	st := r.NewStore()
-	cl, err := st.OpenChangeLog()
+	cr, err := hgcmd.Open(dir)
 	if err != nil {
-		return nil, err
+		return nil, &OpenError{Dir: dir, Err: err}
 	}
 
-	globalTags, allTags := r.Tags()
+	repo := &Repository{
+		Repository:  cr,
+		u:           r,
+		manifests:   newManifestCache(defaultManifestCacheSize),
+		resolutions: resolveCache{newLRUCache(0)},
+
+		contentHashes: contentHashes{newLRUCache(defaultContentHashCacheSize)},
+	}
+	if st == nil {
+		st = r.NewStore()
+	}
+	repo.st = &store{Store: st, maxReads: &repo.MaxConcurrentReads}
+	if err := repo.load(); err != nil {
+		return nil, &OpenError{Dir: dir, Err: err}
+	}
+	return repo, nil
+}
+
+// load reads the changelog, tags, branch heads, and bookmarks, and
+// stores them as the repository's state.
+func (r *Repository) load() error {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+
+	clSize, err := r.changelogSize()
+	if err != nil {
+		return err
+	}
+	cl, err := r.st.OpenChangeLog()
+	if err != nil {
+		return err
+	}
+
+	globalTags, allTags := r.u.Tags()
 	globalTags.Sort()
 	allTags.Sort()
 	allTags.Add("tip", cl.Tip().Id().Node())
 
-	bh, err := r.BranchHeads()
-	if err != nil {
-		return nil, err
+	// Most operations don't need the branch heads, so failing to read
+	// them (e.g., because the branch cache is corrupt) only causes
+	// branch operations to fail.
+	bh, bhErr := r.u.BranchHeads()
+	if bhErr != nil {
+		if Logger != nil {
+			Logger.Printf("hg: reading branch heads of %s failed (branch operations will fail): %s", r.Dir, bhErr)
+		}
+		bh = &hgo.BranchHeads{IdByName: map[string]string{}}
+	}
+	bookmarks, bookmarksErr := readBookmarks(r.Dir)
+	if bookmarksErr != nil {
+		if Logger != nil {
+			Logger.Printf("hg: reading bookmarks of %s failed (bookmark operations will fail): %s", r.Dir, bookmarksErr)
+		}
+		bookmarks = map[string]vcs.CommitID{}
 	}
 
-	cr, err := hgcmd.Open(dir)
+	r.loaded.Store(&repoState{
+		cl:             cl,
+		clSize:         clSize,
+		allTags:        allTags,
+		branchHeads:    bh,
+		branchHeadsErr: bhErr,
+		bookmarks:      bookmarks,
+		bookmarksErr:   bookmarksErr,
+	})
+	return nil
+}
+
+// Refresh rereads the changelog, tags, branch heads, and bookmarks
+// from disk, so that commits made to the repository (e.g., by an
+// external `hg pull`) since it was opened are visible.
+func (r *Repository) Refresh() error {
+	if err := r.load(); err != nil {
+		return err
+	}
+	r.resolutions.invalidate()
+
+	// Revision numbers may have been reassigned if history was
+	// stripped.
+	r.depths.mu.Lock()
+	r.depths.m = nil
+	r.depths.mu.Unlock()
+	return nil
+}
+
+// changelogSize returns the size of the changelog index file. Because
+// the changelog is append-only (except when history is stripped), any
+// change to it changes its size.
+func (r *Repository) changelogSize() (int64, error) {
+	fi, err := os.Stat(filepath.Join(r.Dir, ".hg", "store", "00changelog.i"))
+	if os.IsNotExist(err) {
+		// Old repositories (and empty ones) have no store directory.
+		fi, err = os.Stat(filepath.Join(r.Dir, ".hg", "00changelog.i"))
+	}
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return fi.Size(), nil
+}
 
-	return &Repository{cr, r, st, cl, allTags, bh}, nil
+// refreshIfStale calls Refresh if the changelog has changed on disk
+// since it was read, so that branch heads resolved from the
+// in-memory state aren't stale.
+func (r *Repository) refreshIfStale() error {
+	size, err := r.changelogSize()
+	if err != nil {
+		return err
+	}
+	if size == r.state().clSize {
+		return nil
+	}
+	return r.Refresh()
 }
 
+// Close removes the temporary copy of the repository made by OpenFS,
+// if any. Otherwise, it does nothing.
 func (r *Repository) Close() error {
-	// nothing to do
+	if r.tempDir != "" {
+		return os.RemoveAll(r.tempDir)
+	}
 	return nil
 }
 
+// ResolveRevision returns the commit that spec (a branch, tag,
+// bookmark, node ID, or local revision number) resolves to. A node
+// ID may be abbreviated to any unique prefix; if the prefix matches
+// more than one commit, ErrAmbiguousRevision is returned. The empty
+// spec resolves to the head of the default branch (see
+// DefaultBranch).
+//
+// Any of these may be followed by "^N" and "~N" suffixes to navigate
+// ancestry, like in hg revsets and git: "^N" is the Nth parent ("^"
+// is the first), and "~N" is the Nth first-parent ancestor ("~" is
+// the first), so "tip~3" is the third first-parent ancestor of the
+// tip. Parents are numbered in the order hg records them. If a
+// suffix walks past a root commit, vcs.ErrRevisionNotFound is
+// returned.
 func (r *Repository) ResolveRevision(spec string) (vcs.CommitID, error) {
+	id, _, _, err := r.ResolveRevisionDetailed(spec)
+	return id, err
+}
+
+// ResolveRevisionDetailed resolves spec like ResolveRevision, and also
+// returns the kind of ref that spec matched and its canonical name.
+// Branch, tag, and bookmark names are tried first (in that order); for
+// any other spec (a node ID or prefix, a local revision number, etc.),
+// the kind is vcs.RefKindCommit and the name is the full commit ID.
+func (r *Repository) ResolveRevisionDetailed(spec string) (vcs.CommitID, vcs.RefKind, string, error) {
+	if err := r.refreshIfStale(); err != nil {
+		return "", "", "", err
+	}
+	if res, ok := r.resolutions.get(spec); ok {
+		return res.id, res.kind, res.name, nil
+	}
+	id, kind, name, err := r.resolveRevisionDetailed(spec)
+	if err != nil {
+		return "", "", "", err
+	}
+	r.resolutions.add(spec, resolution{id: id, kind: kind, name: name, immutable: spec == string(id)})
+	return id, kind, name, nil
+}
+
+func (r *Repository) resolveRevisionDetailed(spec string) (vcs.CommitID, vcs.RefKind, string, error) {
 	if id, err := r.ResolveBranch(spec); err == nil {
-		return id, nil
+		return id, vcs.RefKindBranch, spec, nil
 	}
 	if id, err := r.ResolveTag(spec); err == nil {
-		return id, nil
+		return id, vcs.RefKindTag, spec, nil
+	}
+	if id, err := r.ResolveBookmark(spec); err == nil {
+		return id, vcs.RefKindBookmark, spec, nil
+	}
+	if spec == "null" || spec == string(NullCommitID) {
+		return NullCommitID, vcs.RefKindCommit, string(NullCommitID), nil
 	}
 
-	rec, err := r.parseRevisionSpec(spec).Lookup(r.cl)
+	rec, err := r.lookupSpec(spec)
 	if err != nil {
-		if err == hg_revlog.ErrRevNotFound || err == hex.ErrLength {
-			return "", vcs.ErrRevisionNotFound
+		return "", "", "", err
+	}
+	id := hex.EncodeToString(rec.Id())
+	return vcs.CommitID(id), vcs.RefKindCommit, id, nil
+}
+
+// lookupSpec returns the changelog record of the revision that spec
+// (a tag, node ID or prefix, or local revision number) refers to.
+func (r *Repository) lookupSpec(spec string) (*hg_revlog.Rec, error) {
+	st := r.state()
+	rec, err := r.parseRevisionSpec(st, spec).Lookup(st.cl)
+	if _, ok := err.(hex.InvalidByteError); ok || err == hg_revlog.ErrRevNotFound || err == hex.ErrLength {
+		return nil, vcs.ErrRevisionNotFound
+	}
+	return rec, err
+}
+
+// GetCommitFromSpec returns the commit that spec resolves to. It
+// accepts the same specs as ResolveRevision, but it builds the commit
+// from the changelog record that spec resolves to, so it is faster
+// than calling ResolveRevision and then GetCommit. For "null" (or
+// NullCommitID), ErrNullCommit is returned.
+func (r *Repository) GetCommitFromSpec(spec string) (*vcs.Commit, error) {
+	if err := r.refreshIfStale(); err != nil {
+		return nil, err
+	}
+	if spec == "null" || spec == string(NullCommitID) {
+		return nil, ErrNullCommit
+	}
+
+	var rec *hg_revlog.Rec
+	var err error
+	if res, ok := r.resolutions.get(spec); ok {
+		rec, err = r.getRec(res.id)
+	} else if id, berr := r.ResolveBranch(spec); berr == nil {
+		rec, err = r.getRec(id)
+	} else if id, ok := r.state().bookmarkTarget(spec); ok {
+		rec, err = r.getRec(id)
+	} else {
+		// Tags are resolved by parseRevisionSpec.
+		rec, err = r.lookupSpec(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.makeCommit(rec)
+}
+
+// ClassifyRevision resolves spec and reports whether the resolved
+// commit is currently the head of a branch (vcs.RefKindBranch),
+// otherwise whether it is tagged (vcs.RefKindTag), or neither
+// (vcs.RefKindDetached). Unlike the kind returned by
+// ResolveRevisionDetailed, it describes the commit, not the spec: a
+// commit ID that is a branch head is classified as a branch. If the
+// branch heads couldn't be read, the error reading them is returned.
+func (r *Repository) ClassifyRevision(spec string) (vcs.CommitID, vcs.RefKind, error) {
+	id, err := r.ResolveRevision(spec)
+	if err != nil {
+		return "", "", err
+	}
+	st := r.state()
+	if st.branchHeadsErr != nil {
+		return "", "", st.branchHeadsErr
+	}
+	for _, head := range st.branchHeads.IdByName {
+		if vcs.CommitID(head) == id {
+			return id, vcs.RefKindBranch, nil
 		}
-		return "", err
 	}
-	return vcs.CommitID(hex.EncodeToString(rec.Id())), nil
+	if len(r.tagsByID()[string(id)]) > 0 {
+		return id, vcs.RefKindTag, nil
+	}
+	return id, vcs.RefKindDetached, nil
+}
+
+// CanResolve reports whether spec resolves to a revision (by branch,
+// tag, or node ID). It uses the same resolution as ResolveRevision
+// but discards the resolved commit ID.
+func (r *Repository) CanResolve(spec string) bool {
+	_, err := r.ResolveRevision(spec)
+	return err == nil
 }
 
 func (r *Repository) ResolveTag(name string) (vcs.CommitID, error) {
-	if id, ok := r.allTags.IdByName[name]; ok {
+	if id, ok := r.state().allTags.IdByName[name]; ok {
 		return vcs.CommitID(id), nil
 	}
 	return "", vcs.ErrTagNotFound
 }
 
+// ResolveBranch returns the head of the named branch. If commits have
+// been added to the repository since its branch heads were read, they
+// are reread first.
 func (r *Repository) ResolveBranch(name string) (vcs.CommitID, error) {
-	if id, ok := r.branchHeads.IdByName[name]; ok {
+	if err := r.refreshIfStale(); err != nil {
+		return "", err
+	}
+	st := r.state()
+	if st.branchHeadsErr != nil {
+		return "", st.branchHeadsErr
+	}
+	if id, ok := st.branchHeads.IdByName[name]; ok {
 		return vcs.CommitID(id), nil
 	}
 	return "", vcs.ErrBranchNotFound
 }
 
+// Branches returns the repository's named branches, sorted by name,
+// each with the head recorded for it in hg's branch cache. Closed
+// branches (whose heads were all committed with --close-branch) are
+// included, with Closed set; use BranchHeads to find a branch's open
+// heads.
+//
+// The changeset of each branch's cached head is read to check whether
+// it is closed. Only if it is are the branch's other heads checked,
+// which requires walking the whole changelog (once, for all branches,
+// until the repository is refreshed).
 func (r *Repository) Branches(opt vcs.BranchesOptions) ([]*vcs.Branch, error) {
 	if opt.ContainsCommit != "" {
 		return nil, fmt.Errorf("vcs.BranchesOptions.ContainsCommit option not implemented")
 	}
+	st := r.state()
+	if st.branchHeadsErr != nil {
+		return nil, st.branchHeadsErr
+	}
 
-	bs := make([]*vcs.Branch, len(r.branchHeads.IdByName))
-	i := 0
-	for name, id := range r.branchHeads.IdByName {
-		bs[i] = &vcs.Branch{Name: name, Head: vcs.CommitID(id)}
-		i++
+	bs := make([]*vcs.Branch, 0, len(st.branchHeads.IdByName))
+	for name, id := range st.branchHeads.IdByName {
+		b := &vcs.Branch{Name: name, Head: vcs.CommitID(id)}
+		closed, err := r.headClosed(b.Head)
+		if err != nil {
+			return nil, err
+		}
+		if closed {
+			allHeads, err := st.allBranchHeads()
+			if err != nil {
+				return nil, err
+			}
+			b.Closed = allClosed(allHeads[name])
+		}
+		bs = append(bs, b)
 	}
 	sort.Sort(vcs.Branches(bs))
 	return bs, nil
 }
 
+// Tags returns the repository's tags, sorted by name. The synthetic
+// "tip" tag is included unless ExcludeTipTag is set.
 func (r *Repository) Tags() ([]*vcs.Tag, error) {
-	ts := make([]*vcs.Tag, len(r.allTags.IdByName))
-	i := 0
-	for name, id := range r.allTags.IdByName {
-		ts[i] = &vcs.Tag{Name: name, CommitID: vcs.CommitID(id)}
-		i++
+	allTags := r.state().allTags
+	ts := make([]*vcs.Tag, 0, len(allTags.IdByName))
+	for name, id := range allTags.IdByName {
+		if name == "tip" && r.ExcludeTipTag {
+			continue
+		}
+		ts = append(ts, &vcs.Tag{Name: name, CommitID: vcs.CommitID(id)})
 	}
 	sort.Sort(vcs.Tags(ts))
 	return ts, nil
 }
 
 func (r *Repository) getRec(id vcs.CommitID) (*hg_revlog.Rec, error) {
-	rec, err := hg_revlog.NodeIdRevSpec(id).Lookup(r.cl)
-	if err == hg_revlog.ErrRevNotFound {
-		err = vcs.ErrCommitNotFound
+	rec, err := hg_revlog.NodeIdRevSpec(id).Lookup(r.state().cl)
+	if err != nil {
+		return nil, standardizeCommitError(err)
 	}
-	return rec, err
+	return rec, nil
 }
 
+// GetCommit returns the commit with the given ID. For NullCommitID,
+// ErrNullCommit is returned, and if no commit has the ID,
+// vcs.ErrCommitNotFound is.
 func (r *Repository) GetCommit(id vcs.CommitID) (*vcs.Commit, error) {
+	if id == NullCommitID {
+		return nil, ErrNullCommit
+	}
 	rec, err := r.getRec(id)
 	if err != nil {
 		return nil, err
@@ -151,15 +573,60 @@ func (r *Repository) GetCommit(id vcs.CommitID) (*vcs.Commit, error) {
 	return r.makeCommit(rec)
 }
 
+// CommitIndex returns the position of the commit in the changelog,
+// counting from 0 for the first commit. This is the commit's revlog
+// index (its local revision number), not its distance from the root
+// along the parent links, so it is only meaningful within this
+// repository: the same commit may have a different index in another
+// clone.
+func (r *Repository) CommitIndex(id vcs.CommitID) (int, error) {
+	rec, err := r.getRec(id)
+	if err != nil {
+		return 0, err
+	}
+	return rec.FileRev(), nil
+}
+
+// Commits returns a page of the log starting at opt.Head (the commits
+// reachable from it), newest first (i.e., in descending revision
+// order, so that each commit is listed before its parents; see
+// CommitsReversed for the opposite order): opt.Skip commits are
+// skipped and at most opt.N (if nonzero) are returned, along with the
+// total number of commits in the log. Each commit appears once,
+// including every root commit in Head's history. If Skip is past the
+// end of the log, an empty (non-nil) slice is returned. Counting the
+// total requires walking the whole log, so if opt.NoTotal is set, the
+// walk instead stops as soon as Skip+N commits have been visited, and
+// the returned total is 0.
+//
+// If opt.Path is set, only the commits reachable from Head that
+// changed the file or directory at that path are included (see
+// pathRevs); renames aren't followed.
 func (r *Repository) Commits(opt vcs.CommitsOptions) ([]*vcs.Commit, uint, error) {
-	rec, err := r.getRec(opt.Head)
+	return r.CommitsContext(context.Background(), opt)
+}
+
+// CommitsContext is like Commits, but it stops walking the log and
+// returns ctx.Err() if ctx is canceled or its deadline is exceeded.
+func (r *Repository) CommitsContext(ctx context.Context, opt vcs.CommitsOptions) (commits []*vcs.Commit, total uint, err error) {
+	rec, exclude, err := r.logHead(opt)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	var commits []*vcs.Commit
-	total := uint(0)
-	for ; ; rec = rec.Prev() {
+	if p := filepath.ToSlash(filepath.Clean(internal.Rel(opt.Path))); opt.Path != "" && p != "." {
+		revs, err := r.pathRevs(ctx, rec, exclude, p)
+		if err != nil {
+			return nil, 0, err
+		}
+		return r.commitsPage(revs, opt)
+	}
+
+	w := newLogWalker(rec, exclude)
+	for rec := w.next(); rec != nil; rec = w.next() {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
 		if total >= opt.Skip && (opt.N == 0 || uint(len(commits)) < opt.N) {
 			c, err := r.makeCommit(rec)
 			if err != nil {
@@ -169,64 +636,196 @@ func (r *Repository) Commits(opt vcs.CommitsOptions) ([]*vcs.Commit, uint, error
 		}
 		total++
 
-		if rec.IsStartOfBranch() {
-			break
-		}
-		// If we want total, keep going until the end.
-		if !opt.NoTotal {
-			continue
-		}
-		// Otherwise return once N has been satisfied.
-		if opt.N != 0 && uint(len(commits)) >= opt.N {
+		// If we don't want total, return once N has been satisfied.
+		if opt.NoTotal && opt.N != 0 && uint(len(commits)) >= opt.N {
 			break
 		}
 	}
+	if w.err != nil {
+		return nil, 0, w.err
+	}
 	if opt.NoTotal {
 		total = 0
 	}
+	if commits == nil {
+		commits = []*vcs.Commit{}
+	}
 	return commits, total, nil
 }
 
-func (r *Repository) makeCommit(rec *hg_revlog.Rec) (*vcs.Commit, error) {
-	fb := hg_revlog.NewFileBuilder()
-	ce, err := hg_changelog.BuildEntry(rec, fb)
+// CommitsReversed is like Commits, but it lists the log oldest first
+// (in ascending revision order, so that each commit is listed after
+// its parents), as a changelog is written; opt.Skip and opt.N select
+// the page from the oldest end of the log. Because the log is walked
+// backward from opt.Head, the whole log is walked to find its oldest
+// commits, regardless of opt.NoTotal, but only the commits in the
+// page are read.
+func (r *Repository) CommitsReversed(opt vcs.CommitsOptions) ([]*vcs.Commit, uint, error) {
+	revs, err := r.logRevs(opt)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	for i, j := 0, len(revs)-1; i < j; i, j = i+1, j-1 {
+		revs[i], revs[j] = revs[j], revs[i]
 	}
+	return r.commitsPage(revs, opt)
+}
 
-	addr, err := mail.ParseAddress(ce.Committer)
+// logHead returns the changelog record of opt.Head and the records
+// reachable from opt.Base (if set), which are excluded from the log.
+func (r *Repository) logHead(opt vcs.CommitsOptions) (*hg_revlog.Rec, map[int]*hg_revlog.Rec, error) {
+	rec, err := r.getRec(opt.Head)
 	if err != nil {
-		// This occurs when the commit author specifier is
-		// malformed. Fall back to just using the whole committer
-		// string as the name.
-		addr = &mail.Address{
-			Name:    ce.Committer,
-			Address: "",
+		return nil, nil, err
+	}
+	var exclude map[int]*hg_revlog.Rec
+	if opt.Base != "" {
+		baseRec, err := r.getRec(opt.Base)
+		if err != nil {
+			return nil, nil, err
 		}
+		exclude = ancestorRecs(baseRec)
 	}
+	return rec, exclude, nil
+}
 
-	var parents []vcs.CommitID
-	if !rec.IsStartOfBranch() {
-		if p := rec.Parent(); p != nil {
-			parents = append(parents, vcs.CommitID(hex.EncodeToString(rec.Parent().Id())))
+// logRevs returns the changelog revisions of all of the commits in
+// the log that Commits lists for opt (ignoring opt.Skip and opt.N),
+// newest first.
+func (r *Repository) logRevs(opt vcs.CommitsOptions) (revs []int, err error) {
+	rec, exclude, err := r.logHead(opt)
+	if err != nil {
+		return nil, err
+	}
+	if p := filepath.ToSlash(filepath.Clean(internal.Rel(opt.Path))); opt.Path != "" && p != "." {
+		return r.pathRevs(context.Background(), rec, exclude, p)
+	}
+
+	w := newLogWalker(rec, exclude)
+	for rec := w.next(); rec != nil; rec = w.next() {
+		revs = append(revs, rec.FileRev())
+	}
+	return revs, w.err
+}
+
+// commitsPage returns the page of the commits at the given changelog
+// revisions selected by opt.Skip and opt.N, and the total number of
+// revisions (or 0, if opt.NoTotal is set).
+func (r *Repository) commitsPage(revs []int, opt vcs.CommitsOptions) ([]*vcs.Commit, uint, error) {
+	total := uint(len(revs))
+	if opt.Skip >= total {
+		revs = nil
+	} else {
+		revs = revs[opt.Skip:]
+	}
+	if opt.N != 0 && uint(len(revs)) > opt.N {
+		revs = revs[:opt.N]
+	}
+
+	// Revisions are never renumbered except by a strip, so a newer
+	// changelog than the one revs were read from can be used.
+	cl := r.state().cl
+	commits := make([]*vcs.Commit, len(revs))
+	for i, rev := range revs {
+		rec, err := hg_revlog.FileRevSpec(rev).Lookup(cl)
+		if err != nil {
+			return nil, 0, err
+		}
+		if commits[i], err = r.makeCommit(rec); err != nil {
+			return nil, 0, err
+		}
+	}
+	if opt.NoTotal {
+		total = 0
+	}
+	return commits, total, nil
+}
+
+// SampleCommits returns every step'th commit of the log starting at
+// to (in the same order as Commits), for a coarse view of a long
+// history. The first commit (to itself) and the last (the root of the
+// log) are always included. Only the sampled commits are read, so it
+// is much cheaper than listing all commits. If step is less than 1, 1
+// is used.
+func (r *Repository) SampleCommits(to vcs.CommitID, step int) ([]*vcs.Commit, error) {
+	return r.SampleCommitsContext(context.Background(), to, step)
+}
+
+// SampleCommitsContext is like SampleCommits, but it stops walking
+// the log and returns ctx.Err() if ctx is canceled or its deadline is
+// exceeded.
+func (r *Repository) SampleCommitsContext(ctx context.Context, to vcs.CommitID, step int) (commits []*vcs.Commit, err error) {
+	if step < 1 {
+		step = 1
+	}
+	rec, err := r.getRec(to)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newLogWalker(rec, nil)
+	for i, rec := 0, w.next(); rec != nil; i, rec = i+1, w.next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		if rec.Parent2Present() {
-			parents = append(parents, vcs.CommitID(hex.EncodeToString(rec.Parent2().Id())))
+		if i%step == 0 || w.done() {
+			c, err := r.makeCommit(rec)
+			if err != nil {
+				return nil, err
+			}
+			commits = append(commits, c)
 		}
 	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	return commits, nil
+}
+
+func (r *Repository) makeCommit(rec *hg_revlog.Rec) (*vcs.Commit, error) {
+	cs, err := readChangeset(rec)
+	if err != nil {
+		return nil, err
+	}
 
+	parents, first := r.parentIDs(rec)
+	committer := cs.committer()
+	extra := cs.Extra
+	if len(extra) == 0 {
+		extra = nil
+	}
 	return &vcs.Commit{
-		ID:      vcs.CommitID(ce.Id),
-		Author:  vcs.Signature{addr.Name, addr.Address, pbtypes.NewTimestamp(ce.Date)},
-		Message: ce.Comment,
-		Parents: parents,
+		ID:          vcs.CommitID(hex.EncodeToString(rec.Id())),
+		Author:      parseSignature(cs.User, cs.Date),
+		Committer:   &committer,
+		Message:     cs.Description,
+		Parents:     parents,
+		FirstParent: first,
+		Branch:      cs.branch(),
+		Extra:       extra,
 	}, nil
 }
 
+type commitIDs []vcs.CommitID
+
+func (v commitIDs) Len() int           { return len(v) }
+func (v commitIDs) Less(i, j int) bool { return v[i] < v[j] }
+func (v commitIDs) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// FileSystem returns the file tree at the given commit. The
+// FileSystem at NullCommitID is empty.
 func (r *Repository) FileSystem(at vcs.CommitID) (vfs.FileSystem, error) {
-	rec, err := r.getRec(at)
+	return r.fileSystem(at)
+}
+
+func (r *Repository) fileSystem(at vcs.CommitID) (*hgFSNative, error) {
+	if at == NullCommitID {
+		return r.nullFileSystem(), nil
+	}
+	cl := r.state().cl
+	rec, err := hg_revlog.NodeIdRevSpec(at).Lookup(cl)
 	if err != nil {
-		return nil, err
+		return nil, standardizeCommitError(err)
 	}
 
 	return &hgFSNative{
@@ -234,15 +833,86 @@ func (r *Repository) FileSystem(at vcs.CommitID) (vfs.FileSystem, error) {
 		at:   hg_revlog.FileRevSpec(rec.FileRev()),
 		repo: r.u,
 		st:   r.st,
-		cl:   r.cl,
-		fb:   hg_revlog.NewFileBuilder(),
+		cl:   cl,
+
+		manifests:       r.manifests,
+		blobs:           newBlobCache(defaultBlobCacheBytes),
+		caseInsensitive: r.CaseInsensitivePaths,
+		followSymlinks:  r.ReadDirFollowSymlinks,
+		lastCommits:     r.ReadDirLastCommits,
+		sizes:           r.ReadDirSizes,
 	}, nil
 }
 
-func (r *Repository) parseRevisionSpec(s string) hg_revlog.RevisionSpec {
+// manifest returns the manifest at the changelog record rec,
+// consulting the manifest cache shared with the repository's
+// FileSystems.
+func (r *Repository) manifest(rec *hg_revlog.Rec) (hg_store.Manifest, error) {
+	if m, ok := r.manifests.get(rec.Id()); ok {
+		return m, nil
+	}
+	fb := hg_revlog.NewFileBuilder()
+	c, err := hg_changelog.BuildEntry(rec, fb)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readManifest(r.st, c, fb)
+	if err != nil {
+		return nil, err
+	}
+	r.manifests.add(rec.Id(), m)
+	return m, nil
+}
+
+// RootEntries returns the entries of the root directory at the given
+// commit. It is equivalent to calling ReadDir(".") on the commit's
+// FileSystem, but it reads the manifest directly instead of
+// constructing a FileSystem first.
+func (r *Repository) RootEntries(commit vcs.CommitID) ([]os.FileInfo, error) {
+	rec, err := r.getRec(commit)
+	if err != nil {
+		return nil, err
+	}
+	fb := hg_revlog.NewFileBuilder()
+	c, err := hg_changelog.BuildEntry(rec, fb)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := r.manifests.get(rec.Id())
+	if !ok {
+		if m, err = readManifest(r.st, c, fb); err != nil {
+			return nil, err
+		}
+		r.manifests.add(rec.Id(), m)
+	}
+	return dirEntries(newDirIndex(m), ".", c.Date), nil
+}
+
+func (r *Repository) parseRevisionSpec(st *repoState, s string) hg_revlog.RevisionSpec {
 	if s == "" {
+		// The empty spec is the head of the default branch (falling
+		// back to the tip if it can't be determined).
 		s = "tip"
-		// TODO(sqs): determine per-repository default branch name (not always "default"?)
+		if branch, err := r.defaultBranch(st); err == nil {
+			if id, ok := st.branchHeads.IdByName[branch]; ok {
+				s = id
+			}
+		}
+	}
+	if _, ok := st.allTags.IdByName[s]; !ok {
+		if base, steps, ok := splitRelativeSpec(s); ok {
+			// Like in ResolveRevision, branches take precedence over
+			// tags, and tags over bookmarks.
+			var baseSpec hg_revlog.RevisionSpec
+			if id, ok := st.branchHeads.IdByName[base]; ok {
+				baseSpec = hg_revlog.NodeIdRevSpec(id)
+			} else if id, ok := st.bookmarkTarget(base); ok {
+				baseSpec = hg_revlog.NodeIdRevSpec(id)
+			} else {
+				baseSpec = r.parseRevisionSpec(st, base)
+			}
+			return relativeRevSpec{base: baseSpec, steps: steps}
+		}
 	}
 	if s == "tip" {
 		return hg_revlog.TipRevSpec{}
@@ -250,12 +920,19 @@ func (r *Repository) parseRevisionSpec(s string) hg_revlog.RevisionSpec {
 	if s == "null" {
 		return hg_revlog.NullRevSpec{}
 	}
-	if id, ok := r.allTags.IdByName[s]; ok {
+	if id, ok := st.allTags.IdByName[s]; ok {
 		s = id
 	} else if i, err := strconv.Atoi(s); err == nil {
-		return hg_revlog.FileRevSpec(i)
+		// Like hg, treat a number that is too large to be a local
+		// revision number as a node ID prefix.
+		if tip := st.cl.Tip(); !isNodePrefix(s) || tip == nil || i <= tip.FileRev() {
+			return hg_revlog.FileRevSpec(i)
+		}
 	}
 
+	if isNodePrefix(s) {
+		return nodePrefixRevSpec(s)
+	}
 	return hg_revlog.NodeIdRevSpec(s)
 }
 
@@ -263,49 +940,162 @@ type hgFSNative struct {
 	dir  string
 	at   hg_revlog.FileRevSpec
 	repo *hgo.Repository
-	st   *hg_store.Store
+	st   *store
 	cl   *hg_revlog.Index
-	fb   *hg_revlog.FileBuilder
+
+	manifests       *manifestCache
+	blobs           *blobCache
+	caseInsensitive bool // see Repository.CaseInsensitivePaths
+	followSymlinks  bool // see Repository.ReadDirFollowSymlinks
+	lastCommits     bool // see Repository.ReadDirLastCommits
+	sizes           bool // see Repository.ReadDirSizes
+
+	// mu guards m, ents, and dirs, which memoize the manifest at the
+	// FileSystem's commit (which never changes), its map from path to
+	// entry, and its directory index.
+	mu   sync.Mutex
+	m    hg_store.Manifest
+	ents map[string]*hg_store.ManifestEnt
+	dirs dirIndex
 }
 
 func (fs *hgFSNative) manifestEntry(chgId hg_revlog.FileRevSpec, fileName string) (me *hg_store.ManifestEnt, err error) {
-	m, err := fs.getManifest(chgId)
-	if err != nil {
-		return
+	if chgId == fs.at {
+		ents, err := fs.manifestEnts()
+		if err != nil {
+			return nil, err
+		}
+		me = ents[fileName]
+	} else {
+		m, err := fs.getManifest(chgId)
+		if err != nil {
+			return nil, err
+		}
+		me = m.Map()[fileName]
 	}
-	me = m.Map()[fileName]
 	if me == nil {
 		err = ErrFileNotInManifest
 	}
 	return
 }
 
+// getManifest returns the manifest at the changelog revision chgId.
+// The manifest at the FileSystem's own commit is built at most once
+// (and concurrent callers wait for it to be built); others are looked
+// up in (or added to) the cache shared with the repository.
 func (fs *hgFSNative) getManifest(chgId hg_revlog.FileRevSpec) (m hg_store.Manifest, err error) {
+	if chgId == fs.at {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.m == nil {
+			if fs.m, err = fs.buildManifest(chgId); err != nil {
+				return nil, err
+			}
+		}
+		return fs.m, nil
+	}
+	return fs.buildManifest(chgId)
+}
+
+// manifestEnts returns the map from path to entry of the manifest at
+// the FileSystem's commit, which is built at most once.
+func (fs *hgFSNative) manifestEnts() (map[string]*hg_store.ManifestEnt, error) {
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.ents == nil {
+		fs.ents = m.Map()
+	}
+	return fs.ents, nil
+}
+
+// buildManifest returns the manifest at the changelog revision chgId,
+// consulting the cache shared with the repository.
+func (fs *hgFSNative) buildManifest(chgId hg_revlog.FileRevSpec) (m hg_store.Manifest, err error) {
 	rec, err := chgId.Lookup(fs.cl)
 	if err != nil {
 		return
 	}
-	c, err := hg_changelog.BuildEntry(rec, fs.fb)
+	if m, ok := fs.manifests.get(rec.Id()); ok {
+		return m, nil
+	}
+
+	// A FileBuilder can't be shared by concurrent callers, so each
+	// read uses its own.
+	fb := hg_revlog.NewFileBuilder()
+	c, err := hg_changelog.BuildEntry(rec, fb)
 	if err != nil {
 		return
 	}
+	m, err = readManifest(fs.st, c, fb)
+	if err != nil {
+		return nil, err
+	}
+	fs.manifests.add(rec.Id(), m)
+	return m, nil
+}
+
+// readManifest reads the manifest of the changelog entry c.
+func readManifest(st *store, c *hg_changelog.Entry, fb *hg_revlog.FileBuilder) (hg_store.Manifest, error) {
+	rec, err := manifestRec(st, c)
+	if err != nil {
+		return nil, err
+	}
+	return st.buildManifest(fb, rec)
+}
 
-	// st := fs.repo.NewStore()
-	mlog, err := fs.st.OpenManifests()
+// manifestRec returns the manifest revlog record of the changelog
+// entry c.
+func manifestRec(st *store, c *hg_changelog.Entry) (*hg_revlog.Rec, error) {
+	mlog, err := st.OpenManifests()
 	if err != nil {
 		return nil, err
 	}
+	return mlog.LookupRevision(int(c.Linkrev), c.ManifestNode)
+}
 
-	rec2, err := mlog.LookupRevision(int(c.Linkrev), c.ManifestNode)
+// RawManifest returns the manifest of the given commit as Mercurial
+// stores it (after it is reconstructed from the manifest revlog's
+// deltas). The manifest has one line per file, sorted by path:
+//
+//	<path>\0<node><flags>\n
+//
+// where <node> is the 40-character hex node ID of the file's revlog
+// revision and <flags> is empty for a regular file, "x" for an
+// executable file, or "l" for a symlink.
+func (r *Repository) RawManifest(commit vcs.CommitID) ([]byte, error) {
+	rec, err := r.getRec(commit)
 	if err != nil {
 		return nil, err
 	}
+	return rawManifest(r.st, rec, hg_revlog.NewFileBuilder())
+}
 
-	return hg_store.BuildManifest(rec2, fs.fb)
+// entryRec returns the file revlog record for a manifest entry.
+func (fs *hgFSNative) entryRec(ent *hg_store.ManifestEnt) (*hg_revlog.Rec, error) {
+	fileLog, err := fs.st.OpenRevlog(ent.FileName)
+	if err != nil {
+		return nil, err
+	}
+	id, err := ent.Id()
+	if err != nil {
+		return nil, err
+	}
+	return hg_revlog.NodeIdRevSpec(hex.EncodeToString(id)).Lookup(fileLog)
 }
 
 func (fs *hgFSNative) getEntry(path string) (*hg_revlog.Rec, *hg_store.ManifestEnt, error) {
 	path = filepath.ToSlash(path)
+	if fs.caseInsensitive {
+		var err error
+		if path, err = fs.matchPathFold(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	fileLog, err := fs.st.OpenRevlog(path)
 	if err != nil {
 		return nil, nil, err
@@ -380,7 +1170,10 @@ func (fs *hgFSNative) getEntry(path string) (*hg_revlog.Rec, *hg_store.ManifestE
 }
 
 func (fs *hgFSNative) Open(name string) (vfs.ReadSeekCloser, error) {
-	name = internal.Rel(name)
+	name, err := cleanPath("open", name)
+	if err != nil {
+		return nil, err
+	}
 	rec, _, err := fs.getEntry(name)
 	if err != nil {
 		return nil, standardizeHgError(err)
@@ -393,18 +1186,82 @@ func (fs *hgFSNative) Open(name string) (vfs.ReadSeekCloser, error) {
 	return util.NopCloser{bytes.NewReader(data)}, nil
 }
 
+// OpenMulti opens each of the named files, reading the manifest only
+// once for the whole batch. The files that were opened are returned
+// in the first map and the errors for those that couldn't be opened
+// are returned in the second, both keyed by the names as given. Names
+// are cleaned like in Open, and a file that doesn't exist gets an
+// *os.PathError wrapping os.ErrNotExist.
+func (fs *hgFSNative) OpenMulti(names []string) (map[string]vfs.ReadSeekCloser, map[string]error) {
+	files := make(map[string]vfs.ReadSeekCloser, len(names))
+	errs := map[string]error{}
+
+	ents, err := fs.manifestEnts()
+	if err != nil {
+		for _, name := range names {
+			errs[name] = err
+		}
+		return files, errs
+	}
+
+	for _, name := range names {
+		path, err := cleanPath("open", name)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		if fs.caseInsensitive {
+			if path, err = fs.matchPathFold(path); err != nil {
+				errs[name] = err
+				continue
+			}
+		}
+		ent := ents[path]
+		if ent == nil {
+			errs[name] = &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+			continue
+		}
+		rec, err := fs.entryRec(ent)
+		if err != nil {
+			errs[name] = &os.PathError{Op: "open", Path: name, Err: standardizeHgError(err)}
+			continue
+		}
+		data, err := fs.readFile(rec)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		files[name] = util.NopCloser{bytes.NewReader(data)}
+	}
+	return files, errs
+}
+
+// readFile returns the contents of the file revision rec, from the
+// FileSystem's blob cache if they have been read already. The
+// returned data must not be modified.
 func (fs *hgFSNative) readFile(rec *hg_revlog.Rec) ([]byte, error) {
-	fb := hg_revlog.NewFileBuilder()
-	return fb.Build(rec)
+	node := string(rec.Id())
+	if data, ok := fs.blobs.get(node); ok {
+		return data, nil
+	}
+	data, err := fs.st.build(hg_revlog.NewFileBuilder(), rec)
+	if err != nil {
+		return nil, err
+	}
+	fs.blobs.add(node, data)
+	return data, nil
 }
 
 func (fs *hgFSNative) getModTime() (time.Time, error) {
+	if fs.at == nullRev {
+		return time.Time{}, nil
+	}
 	r, err := fs.at.Lookup(fs.cl)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	c, err := hg_changelog.BuildEntry(r, fs.fb)
+	c, err := hg_changelog.BuildEntry(r, hg_revlog.NewFileBuilder())
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -413,12 +1270,23 @@ func (fs *hgFSNative) getModTime() (time.Time, error) {
 }
 
 func (fs *hgFSNative) Lstat(path string) (os.FileInfo, error) {
+	path, err := cleanPath("lstat", path)
+	if err != nil {
+		return nil, err
+	}
 	fi, _, err := fs.lstat(path)
 	return fi, err
 }
 
+// lstat returns the FileInfo for path, which must have been cleaned
+// by cleanPath, and the data of the file if it is a symlink.
 func (fs *hgFSNative) lstat(path string) (*util.FileInfo, []byte, error) {
-	path = filepath.Clean(internal.Rel(path))
+	if path == "." {
+		// The root always exists, even in a commit with no files (or
+		// at the null revision), and it has no revlog to look up.
+		fi, err := fs.dirStat(path)
+		return fi, nil, err
+	}
 
 	rec, ent, err := fs.getEntry(path)
 	if os.IsNotExist(err) {
@@ -431,43 +1299,66 @@ func (fs *hgFSNative) lstat(path string) (*util.FileInfo, []byte, error) {
 		return nil, nil, standardizeHgError(err)
 	}
 
-	fi := fs.fileInfo(ent)
-
-	// read data to determine file size
-	data, err := fs.readFile(rec)
+	mtime, err := fs.getModTime()
 	if err != nil {
 		return nil, nil, err
 	}
-	fi.Size_ = int64(len(data))
+	fi := fileInfo(ent, mtime)
+	fi.Size_ = recSize(rec)
 
+	// Only a symlink's data (its target) is needed, by Stat.
+	var data []byte
+	if ent.IsLink() {
+		if data, err = fs.readFile(rec); err != nil {
+			return nil, nil, err
+		}
+	}
 	return fi, data, nil
 }
 
+// Stat returns the FileInfo of the file at path, following symlinks
+// (whose targets are resolved relative to the symlink's directory)
+// under the name of path. If a symlink's target is outside of the
+// repository or doesn't exist, an error satisfying os.IsNotExist is
+// returned; if path can't be resolved within maxSymlinkDepth
+// symlinks, the error is an *os.PathError wrapping ErrSymlinkLoop.
+//
+// Directories are synthesized from the paths of the files under them
+// (see dirStat). The root (".") is always a directory, even in a
+// commit with no files and at the null revision.
 func (fs *hgFSNative) Stat(path string) (os.FileInfo, error) {
-	path = internal.Rel(path)
-	fi, data, err := fs.lstat(path)
+	path, err := cleanPath("stat", path)
 	if err != nil {
 		return nil, err
 	}
-
-	if fi.Mode()&os.ModeSymlink != 0 {
-		// derefence symlink
-		derefPath := string(data)
-		fi, err := fs.Lstat(derefPath)
+	name := path
+	for i := 0; ; i++ {
+		fi, data, err := fs.lstat(name)
 		if err != nil {
 			return nil, err
 		}
-
-		fi.(*util.FileInfo).Name_ = filepath.Base(path)
-		return fi, nil
+		if fi.Mode()&os.ModeSymlink == 0 {
+			if name != path {
+				fi.Name_ = filepath.Base(path)
+			}
+			return fi, nil
+		}
+		if i == maxSymlinkDepth {
+			return nil, &os.PathError{Op: "stat", Path: path, Err: ErrSymlinkLoop}
+		}
+		var ok bool
+		if name, ok = symlinkTarget(name, string(data)); !ok {
+			return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+		}
 	}
-
-	return fi, nil
 }
 
 // dirStat determines whether a directory exists at path by listing files
 // underneath it. If it has files, then it's a directory. We must do it this way
-// because hg doesn't track directories in the manifest.
+// because hg doesn't track directories in the manifest: every directory
+// other than the root is synthesized from the paths of the files under
+// it, so (as in hg) a directory with no files doesn't exist, while the
+// root always does.
 func (fs *hgFSNative) dirStat(path string) (*util.FileInfo, error) {
 	mtime, err := fs.getModTime()
 	if err != nil {
@@ -482,33 +1373,26 @@ func (fs *hgFSNative) dirStat(path string) (*util.FileInfo, error) {
 		}, nil
 	}
 
-	m, err := fs.getManifest(fs.at)
+	idx, err := fs.dirIndex()
 	if err != nil {
 		return nil, err
 	}
-
-	dirPrefix := filepath.Clean(path) + "/"
-	for _, e := range m {
-		if strings.HasPrefix(e.FileName, dirPrefix) {
-			return &util.FileInfo{
-				Name_:    filepath.Base(path),
-				Mode_:    os.ModeDir,
-				ModTime_: mtime,
-			}, nil
-		}
+	if _, ok := idx[filepath.ToSlash(filepath.Clean(path))]; ok {
+		return &util.FileInfo{
+			Name_:    filepath.Base(path),
+			Mode_:    os.ModeDir,
+			ModTime_: mtime,
+		}, nil
 	}
 
 	return nil, os.ErrNotExist
 }
 
-func (fs *hgFSNative) fileInfo(ent *hg_store.ManifestEnt) *util.FileInfo {
+// fileInfo returns the FileInfo for a manifest entry, with the mode
+// bits derived from the entry's manifest flags ("x" for executable,
+// "l" for symlink).
+func fileInfo(ent *hg_store.ManifestEnt, mtime time.Time) *util.FileInfo {
 	var mode os.FileMode
-
-	mtime, err := fs.getModTime()
-	if err != nil {
-		return nil
-	}
-
 	if ent.IsExecutable() {
 		mode |= 0111 // +x
 	}
@@ -524,40 +1408,69 @@ func (fs *hgFSNative) fileInfo(ent *hg_store.ManifestEnt) *util.FileInfo {
 }
 
 func (fs *hgFSNative) ReadDir(path string) ([]os.FileInfo, error) {
-	path = internal.Rel(path)
+	dir, err := cleanPath("readdir", path)
+	if err != nil {
+		return nil, err
+	}
 	m, err := fs.getManifest(fs.at)
 	if err != nil {
 		return nil, err
 	}
-
-	var fis []os.FileInfo
-	subdirs := make(map[string]struct{})
-
-	var dirPrefix string
-	if path := filepath.Clean(path); path == "." {
-		dirPrefix = ""
-	} else {
-		dirPrefix = path + "/"
+	mtime, err := fs.getModTime()
+	if err != nil {
+		return nil, err
 	}
-	for _, e := range m {
-		if !strings.HasPrefix(e.FileName, dirPrefix) {
-			continue
+	idx, err := fs.dirIndex()
+	if err != nil {
+		return nil, err
+	}
+	fis := dirEntries(idx, dir, mtime)
+
+	if fs.followSymlinks {
+		ents, err := fs.manifestEnts()
+		if err != nil {
+			return nil, err
 		}
-		name := strings.TrimPrefix(e.FileName, dirPrefix)
-		dir := filepath.Dir(name)
-		if dir == "." {
-			fis = append(fis, fs.fileInfo(&e))
-		} else {
-			subdir := strings.SplitN(dir, "/", 2)[0]
-			if _, seen := subdirs[subdir]; !seen {
-				fis = append(fis, &util.FileInfo{Name_: subdir, Mode_: os.ModeDir})
-				subdirs[subdir] = struct{}{}
+		for i, fi := range fis {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			name := fi.Name()
+			if dir != "." {
+				name = dir + "/" + name
+			}
+			if fis[i], err = fs.followSymlink(m, ents, ents[name], mtime); err != nil {
+				return nil, err
 			}
 		}
 	}
+	if fs.sizes {
+		if err := fs.setSizes(dir, fis); err != nil {
+			return nil, err
+		}
+	}
+	if fs.lastCommits {
+		if err := fs.setLastCommits(dir, fis); err != nil {
+			return nil, err
+		}
+	}
 	return fis, nil
 }
 
+// dirEntries returns the entries of the directory at path in the
+// directory index idx.
+func dirEntries(idx dirIndex, path string, mtime time.Time) []os.FileInfo {
+	var fis []os.FileInfo
+	for _, c := range idx[filepath.ToSlash(filepath.Clean(path))] {
+		if c.ent != nil {
+			fis = append(fis, fileInfo(c.ent, mtime))
+		} else {
+			fis = append(fis, &util.FileInfo{Name_: c.subdir, Mode_: os.ModeDir, ModTime_: mtime})
+		}
+	}
+	return fis
+}
+
 func (*hgFSNative) RootType(string) vfs.RootType { return "" }
 
 func (fs *hgFSNative) String() string {
@@ -575,4 +1488,77 @@ func standardizeHgError(err error) error {
 	}
 }
 
+// standardizeCommitError is like standardizeHgError, but for looking
+// up a commit by ID in the changelog: hgo's errors for an ID that
+// isn't there (or that is malformed, so can't be) become
+// vcs.ErrCommitNotFound. Other errors, such as those reading a
+// corrupt changelog, are returned unchanged.
+func standardizeCommitError(err error) error {
+	if _, ok := err.(hex.InvalidByteError); ok {
+		return vcs.ErrCommitNotFound
+	}
+	switch err {
+	case hg_revlog.ErrRevNotFound, hg_revlog.ErrRevisionNotFound, hex.ErrLength:
+		return vcs.ErrCommitNotFound
+	default:
+		return err
+	}
+}
+
 var ErrFileNotInManifest = errors.New("file does not exist in given revision")
+
+// ErrAmbiguousPath is returned by a case-insensitive FileSystem (see
+// Repository.CaseInsensitivePaths) when a path has no exact match and
+// matches more than one file when compared case-insensitively.
+var ErrAmbiguousPath = errors.New("path matches multiple files case-insensitively")
+
+// matchPathFold returns the path of the file or directory at the
+// FileSystem's commit that matches path (see matchPathFold).
+func (fs *hgFSNative) matchPathFold(path string) (string, error) {
+	ents, err := fs.manifestEnts()
+	if err != nil {
+		return "", err
+	}
+	dirs, err := fs.dirIndex()
+	if err != nil {
+		return "", err
+	}
+	return matchPathFold(ents, dirs, path)
+}
+
+// matchPathFold returns the path of the file in ents or directory in
+// dirs that matches path, preferring an exact match (which is looked
+// up directly) and otherwise matching case-insensitively. If nothing
+// matches, path is returned unchanged (so that the caller reports it
+// as nonexistent).
+func matchPathFold(ents map[string]*hg_store.ManifestEnt, dirs dirIndex, path string) (string, error) {
+	if ents[path] != nil {
+		return path, nil
+	}
+	if _, ok := dirs[path]; ok {
+		return path, nil
+	}
+
+	var match string
+	n := 0
+	for name := range ents {
+		if strings.EqualFold(name, path) {
+			match = name
+			n++
+		}
+	}
+	for name := range dirs {
+		if strings.EqualFold(name, path) {
+			match = name
+			n++
+		}
+	}
+	switch n {
+	case 0:
+		return path, nil
+	case 1:
+		return match, nil
+	default:
+		return "", ErrAmbiguousPath
+	}
+}
@@ -0,0 +1,294 @@
+package hg
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	hg_store "github.com/beyang/hgo/store"
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestMatchPathFold(t *testing.T) {
+	m := hg_store.Manifest{
+		{FileName: "README.md"},
+		{FileName: "dir/Makefile"},
+		{FileName: "dir/makefile"},
+		{FileName: "dir/main.go"},
+	}
+	ents := make(map[string]*hg_store.ManifestEnt, len(m))
+	for i := range m {
+		ents[m[i].FileName] = &m[i]
+	}
+	dirs := newDirIndex(m)
+	tests := map[string]struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		"exact":                        {path: "README.md", want: "README.md"},
+		"case differs":                 {path: "readme.MD", want: "README.md"},
+		"case differs in dir":          {path: "DIR/main.go", want: "dir/main.go"},
+		"exact among case-insensitive": {path: "dir/makefile", want: "dir/makefile"},
+		"ambiguous":                    {path: "dir/MAKEFILE", wantErr: ErrAmbiguousPath},
+		"no match":                     {path: "nonexistent", want: "nonexistent"},
+		"dir":                          {path: "dir", want: "dir"},
+		"case differs for dir":         {path: "Dir", want: "dir"},
+	}
+	for label, test := range tests {
+		got, err := matchPathFold(ents, dirs, test.path)
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", label, got, test.want)
+		}
+	}
+}
+
+// BenchmarkReadDir_tree walks a tree of 10,000 files with ReadDir.
+func BenchmarkReadDir_tree(b *testing.B) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 100; j++ {
+			paths = append(paths, fmt.Sprintf("d%d/e%d/f%d", i%10, i, j))
+		}
+	}
+	id := writeTestRepoTree(b, dir, paths)
+	r, err := Open(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Disable the cache shared by the repository's FileSystems, so
+	// that only each FileSystem's own manifest saves it from being
+	// rebuilt by every ReadDir call.
+	r.SetManifestCacheSize(0)
+
+	var walk func(fs vfs.FileSystem, dir string) int
+	walk = func(fs vfs.FileSystem, dir string) int {
+		fis, err := fs.ReadDir(dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n := 0
+		for _, fi := range fis {
+			if fi.IsDir() {
+				n += walk(fs, path.Join(dir, fi.Name()))
+			} else {
+				n++
+			}
+		}
+		return n
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs, err := r.FileSystem(vcs.CommitID(id))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n := walk(fs, "/"); n != len(paths) {
+			b.Fatalf("got %d files, want %d", n, len(paths))
+		}
+	}
+}
+
+func TestRepository_FileSystem_blobCache(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = writeTestRepoContents(t, dir, map[string]string{"a": "hello", "link\x00l": "a"})
+	})
+	defer os.RemoveAll(dir)
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := fs.Stat("link"); err != nil || fi.Size() != 5 {
+		t.Fatalf("Stat(link): got %v, %v, want a 5-byte file", fi, err)
+	}
+	if n := fs.(*hgFSNative).blobs.lru.ll.Len(); n != 1 {
+		t.Errorf("after Stat(link): got %d cached blobs, want 1 (the link's)", n)
+	}
+	for i := 0; i < 2; i++ {
+		for name, want := range map[string]string{"a": "hello", "link": "a"} {
+			data, err := vfs.ReadFile(fs, name)
+			if err != nil || string(data) != want {
+				t.Errorf("ReadFile(%q): got %q, %v, want %q", name, data, err, want)
+			}
+		}
+	}
+	if n := fs.(*hgFSNative).blobs.lru.ll.Len(); n != 2 {
+		t.Errorf("after ReadFile: got %d cached blobs, want 2", n)
+	}
+}
+
+// BenchmarkStatThenOpen stats and then opens the same file with each
+// FileSystem, as a page that shows a file's metadata and contents
+// does. Stat reads the contents of a symlink (to follow it), and the
+// blob cache saves Open from decoding them again; reading a regular
+// file's contents twice is similarly decoded once.
+func BenchmarkStatThenOpen(b *testing.B) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := writeTestRepoContents(b, dir, map[string]string{
+		"file":      strings.Repeat("a", 1<<20),
+		"link\x00l": "file",
+	})
+	r, err := Open(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, name := range []string{"file", "link"} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fs, err := r.FileSystem(vcs.CommitID(id))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := fs.Stat(name); err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 2; j++ {
+					if _, err := vfs.ReadFile(fs, name); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStandardizeCommitError(t *testing.T) {
+	other := errors.New("other")
+	tests := map[error]error{
+		hg_revlog.ErrRevNotFound:      vcs.ErrCommitNotFound,
+		hg_revlog.ErrRevisionNotFound: vcs.ErrCommitNotFound,
+		hex.ErrLength:                 vcs.ErrCommitNotFound,
+		hex.InvalidByteError('x'):     vcs.ErrCommitNotFound,
+		other:                         other,
+	}
+	for err, want := range tests {
+		if got := standardizeCommitError(err); got != want {
+			t.Errorf("%v: got %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestRepository_GetCommit_notFound(t *testing.T) {
+	r, dir := makeTestRepo(t, func(dir string) {
+		writeTestRepo(t, dir, "commit1")
+	})
+	defer os.RemoveAll(dir)
+
+	// A well-formed node ID of a commit that doesn't exist, and
+	// malformed ones.
+	for _, id := range []vcs.CommitID{"0123456789abcdef0123456789abcdef01234567", "0123", "not hex"} {
+		if _, err := r.GetCommit(id); err != vcs.ErrCommitNotFound {
+			t.Errorf("%q: got error %v, want %v", id, err, vcs.ErrCommitNotFound)
+		}
+	}
+}
+
+func TestRepository_CommitIndex(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 3 is on a branch off of commit 0, so its index is
+		// greater than its depth (2).
+		ids = writeTestRepoGraph(t, dir,
+			[]string{"root", "a", "b", "c"},
+			[][]int{nil, {0}, {0}, {2}},
+		)
+	})
+	defer os.RemoveAll(dir)
+
+	for rev, id := range ids {
+		if i, err := r.CommitIndex(vcs.CommitID(id)); err != nil || i != rev {
+			t.Errorf("rev %d: got index %d, %v, want %d", rev, i, err, rev)
+		}
+	}
+	if _, err := r.CommitIndex("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_RootEntries(t *testing.T) {
+	var id vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = vcs.CommitID(writeTestRepoTree(t, dir, []string{"a", "d/x", "d/e/y", "run\x00x", "link\x00l"}))
+	})
+	defer os.RemoveAll(dir)
+
+	fis, err := r.RootEntries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := r.FileSystem(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := fs.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != len(want) {
+		t.Fatalf("got %d entries, want %d (the same as ReadDir)", len(fis), len(want))
+	}
+	for i, fi := range fis {
+		if fi.Name() != want[i].Name() || fi.Mode() != want[i].Mode() || !fi.ModTime().Equal(want[i].ModTime()) {
+			t.Errorf("entry %d: got %s (mode %s, mtime %v), but ReadDir's is %s (mode %s, mtime %v)", i, fi.Name(), fi.Mode(), fi.ModTime(), want[i].Name(), want[i].Mode(), want[i].ModTime())
+		}
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	if want := "a d link run"; strings.Join(names, " ") != want {
+		t.Errorf("got entries %q, want %q", names, want)
+	}
+
+	if _, err := r.RootEntries("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_RawManifest(t *testing.T) {
+	var id vcs.CommitID
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = vcs.CommitID(writeTestRepoTree(t, dir, []string{"b", "a/x", "run\x00x", "link\x00l"}))
+	})
+	defer os.RemoveAll(dir)
+
+	m, err := r.RawManifest(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := fmt.Sprintf("%040x", 1)
+	want := "a/x\x00" + node + "\nb\x00" + node + "\nlink\x00" + node + "l\nrun\x00" + node + "x\n"
+	if string(m) != want {
+		t.Errorf("got manifest %q, want %q", m, want)
+	}
+
+	if _, err := r.RawManifest("0123456789abcdef0123456789abcdef01234567"); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent commit: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
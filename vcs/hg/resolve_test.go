@@ -0,0 +1,203 @@
+package hg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_ResolveRevision_cache(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1")
+	})
+	defer os.RemoveAll(dir)
+	r.SetResolveCacheSize(10)
+
+	for i := 0; i < 2; i++ { // the second time, from the cache
+		if id, err := r.ResolveRevision("default"); err != nil || id != vcs.CommitID(ids[0]) {
+			t.Fatalf("got ResolveRevision(default) %q, %v, want %q", id, err, ids[0])
+		}
+		if id, err := r.ResolveRevision(ids[0]); err != nil || id != vcs.CommitID(ids[0]) {
+			t.Fatalf("got ResolveRevision(%s) %q, %v, want %q", ids[0], id, err, ids[0])
+		}
+	}
+
+	// Branch resolutions must not be served from the cache after the
+	// branch moves.
+	ids = writeTestRepo(t, dir, "commit1", "commit2")
+	if id, err := r.ResolveRevision("default"); err != nil || id != vcs.CommitID(ids[1]) {
+		t.Errorf("after external commit: got ResolveRevision(default) %q, %v, want %q", id, err, ids[1])
+	}
+	if _, ok := r.resolutions.get(ids[0]); !ok {
+		t.Errorf("after external commit: resolution of full commit ID was not kept")
+	}
+}
+
+func TestRepository_GetCommitFromSpec(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2", "commit3")
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]string{
+		"tip":       ids[2],
+		"default":   ids[2],
+		"1":         ids[1],
+		ids[0]:      ids[0],
+		ids[0][:12]: ids[0],
+	}
+	for spec, want := range tests {
+		commit, err := r.GetCommitFromSpec(spec)
+		if err != nil {
+			t.Errorf("%q: %s", spec, err)
+			continue
+		}
+		if commit.ID != vcs.CommitID(want) {
+			t.Errorf("%q: got commit %q, want %q", spec, commit.ID, want)
+		}
+		if resolved, err := r.ResolveRevision(spec); err != nil || resolved != commit.ID {
+			t.Errorf("%q: ResolveRevision got %q, %v, want %q", spec, resolved, err, commit.ID)
+		}
+	}
+
+	if _, err := r.GetCommitFromSpec("null"); err != ErrNullCommit {
+		t.Errorf("null: got error %v, want %v", err, ErrNullCommit)
+	}
+	if _, err := r.GetCommitFromSpec("doesntexist"); err != vcs.ErrRevisionNotFound {
+		t.Errorf("doesntexist: got error %v, want %v", err, vcs.ErrRevisionNotFound)
+	}
+}
+
+func TestRepository_CanResolve(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1", "commit2")
+		writeTestFiles(t, dir, map[string]string{".hg/localtags": ids[0] + " v1\n"})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]bool{
+		"default":     true,
+		"v1":          true,
+		"tip":         true,
+		"0":           true,
+		ids[1]:        true,
+		ids[1][:12]:   true,
+		"doesntexist": false,
+		"2":           false,
+		"0123456789abcdef0123456789abcdef01234567": false,
+	}
+	for spec, want := range tests {
+		if got := r.CanResolve(spec); got != want {
+			t.Errorf("%q: got %v, want %v", spec, got, want)
+		}
+	}
+}
+
+func BenchmarkResolveRevision(b *testing.B) {
+	for _, cacheSize := range []int{0, 100} {
+		dir, err := ioutil.TempDir("", "go-vcs-hg")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		messages := make([]string, 1000)
+		for i := range messages {
+			messages[i] = "commit"
+		}
+		ids := writeTestRepo(b, dir, messages...)
+		r, err := Open(dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		r.SetResolveCacheSize(cacheSize)
+
+		name := "uncached"
+		if cacheSize > 0 {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := r.ResolveRevision(ids[i%len(ids)][:12]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_DefaultBranch_renamed(t *testing.T) {
+	var mainHead string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// The repository has no "default" branch. The tip is the closed
+		// head of "feature", so the open branch "main" is the default.
+		texts := []string{
+			fmt.Sprintf("%040x\na <a@a.com>\n1136214245 0 branch:main\n\non main", 0),
+			fmt.Sprintf("%040x\na <a@a.com>\n1136214246 0 branch:feature\x00close:1\n\non feature", 0),
+		}
+		changelog, nodes := buildRevlog(texts, [][]int{nil, {0}})
+		mainHead = hex.EncodeToString(nodes[0])
+		tip := hex.EncodeToString(nodes[1])
+		writeTestFiles(t, dir, map[string]string{
+			".hg/requires":            "revlogv1\nstore\n",
+			".hg/store/00changelog.i": string(changelog),
+			".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s main\n%s feature\n", tip, 1, mainHead, tip),
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	if branch, err := r.DefaultBranch(); err != nil {
+		t.Fatal(err)
+	} else if branch != "main" {
+		t.Errorf("got default branch %q, want %q", branch, "main")
+	}
+	if id, err := r.ResolveRevision(""); err != nil {
+		t.Fatal(err)
+	} else if id != vcs.CommitID(mainHead) {
+		t.Errorf("got empty spec resolved to %s, want %s (the head of main)", id, mainHead)
+	}
+
+	// The hgrc setting takes precedence, but only if it names an
+	// existing branch.
+	hgrc := filepath.Join(dir, ".hg", "hgrc")
+	for setting, want := range map[string]string{"feature": "feature", "missing": "main"} {
+		if err := ioutil.WriteFile(hgrc, []byte("[go-vcs]\ndefault-branch = "+setting+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if branch, err := r.DefaultBranch(); err != nil {
+			t.Fatal(err)
+		} else if branch != want {
+			t.Errorf("default-branch = %s: got default branch %q, want %q", setting, branch, want)
+		}
+	}
+}
+
+// TestRepository_ClassifyRevision_noBranchHeads checks that ClassifyRevision
+// fails, instead of classifying every commit as detached, if the
+// branch heads can't be read. Resolving a commit ID, which doesn't
+// need them, still works.
+func TestRepository_ClassifyRevision_noBranchHeads(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit1")
+		if err := os.Remove(filepath.Join(dir, ".hg", "cache", "branchheads")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer os.RemoveAll(dir)
+
+	if id, err := r.ResolveRevision(ids[0]); err != nil || id != vcs.CommitID(ids[0]) {
+		t.Errorf("got ResolveRevision %q, %v, want %q", id, err, ids[0])
+	}
+	if _, kind, err := r.ClassifyRevision(ids[0]); err == nil {
+		t.Errorf("got ClassifyRevision kind %q, want an error", kind)
+	}
+}
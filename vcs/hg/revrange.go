@@ -0,0 +1,79 @@
+package hg
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// ErrNotRevisionRange is returned by ParseRevisionRange when the spec
+// isn't of the form "A..B".
+var ErrNotRevisionRange = errors.New("revision spec is not a range of the form A..B")
+
+// ParseRevisionRange resolves a revision range spec of the form
+// "A..B" (like `git log A..B`) into the commits that its ends refer
+// to, so that its commits can be listed with Commits (with Base set
+// to base and Head set to head). Each end is resolved with
+// ResolveRevision. If A is omitted ("..B"), base is empty, so the
+// range includes all of B's history; if B is omitted ("A.."), head is
+// the tip. If spec isn't a range, ErrNotRevisionRange is returned.
+func (r *Repository) ParseRevisionRange(spec string) (base, head vcs.CommitID, err error) {
+	baseSpec, headSpec, ok := splitRevisionRange(spec)
+	if !ok {
+		return "", "", ErrNotRevisionRange
+	}
+	if baseSpec != "" {
+		if base, err = r.ResolveRevision(baseSpec); err != nil {
+			return "", "", err
+		}
+	}
+	if headSpec == "" {
+		headSpec = "tip"
+	}
+	if head, err = r.ResolveRevision(headSpec); err != nil {
+		return "", "", err
+	}
+	return base, head, nil
+}
+
+// CommitsBetween returns the commits reachable from head but not from
+// base (like `git log base..head`), newest first: for a pull request,
+// the commits on its branch. All of base's ancestors are excluded,
+// not only those on its first-parent line, so commits merged into
+// base from other branches are excluded too.
+func (r *Repository) CommitsBetween(base, head vcs.CommitID) ([]*vcs.Commit, error) {
+	headRec, err := r.getRec(head)
+	if err != nil {
+		return nil, err
+	}
+	baseRec, err := r.getRec(base)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors := ancestorRecs(headRec)
+	for rev := range ancestorRecs(baseRec) {
+		delete(ancestors, rev)
+	}
+	revs := make([]int, 0, len(ancestors))
+	for rev := range ancestors {
+		revs = append(revs, rev)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(revs)))
+
+	commits, _, err := r.commitsPage(revs, vcs.CommitsOptions{NoTotal: true})
+	return commits, err
+}
+
+// splitRevisionRange splits a revision range spec "A..B" into A and
+// B. It reports false if spec isn't a range (including if it is a
+// "A...B" symmetric difference, which isn't supported).
+func splitRevisionRange(spec string) (base, head string, ok bool) {
+	i := strings.Index(spec, "..")
+	if i < 0 || spec == ".." || strings.Contains(spec, "...") || strings.Contains(spec[i+2:], "..") {
+		return "", "", false
+	}
+	return spec[:i], spec[i+2:], true
+}
@@ -0,0 +1,84 @@
+package hg
+
+import (
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestSplitRevisionRange(t *testing.T) {
+	tests := []struct {
+		spec       string
+		base, head string
+		ok         bool
+	}{
+		{"a..b", "a", "b", true},
+		{"..b", "", "b", true},
+		{"a..", "a", "", true},
+		{"v1.0..v2.0", "v1.0", "v2.0", true},
+		{"a", "", "", false},
+		{"..", "", "", false},
+		{"a...b", "", "", false},
+		{"a..b..c", "", "", false},
+	}
+	for _, test := range tests {
+		base, head, ok := splitRevisionRange(test.spec)
+		if base != test.base || head != test.head || ok != test.ok {
+			t.Errorf("%q: got (%q, %q, %v), want (%q, %q, %v)", test.spec, base, head, ok, test.base, test.head, test.ok)
+		}
+	}
+}
+
+func TestRepository_ParseRevisionRange(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepo(t, dir, "commit0", "commit1", "commit2")
+		writeTestFiles(t, dir, map[string]string{".hg/localtags": ids[0] + " v1.0\n"})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		base, head string
+	}{
+		"v1.0..default":             {base: ids[0], head: ids[2]},
+		"..1":                       {base: "", head: ids[1]},
+		"0..":                       {base: ids[0], head: ids[2]},
+		ids[0][:12] + ".." + ids[1]: {base: ids[0], head: ids[1]},
+	}
+	for spec, test := range tests {
+		base, head, err := r.ParseRevisionRange(spec)
+		if err != nil {
+			t.Errorf("%q: %s", spec, err)
+			continue
+		}
+		if base != vcs.CommitID(test.base) || head != vcs.CommitID(test.head) {
+			t.Errorf("%q: got (%q, %q), want (%q, %q)", spec, base, head, test.base, test.head)
+		}
+	}
+
+	// The range's commits can be listed with Commits.
+	base, head, err := r.ParseRevisionRange("v1.0..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, _, err := r.Commits(vcs.CommitsOptions{Base: base, Head: head})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].ID != vcs.CommitID(ids[2]) || commits[1].ID != vcs.CommitID(ids[1]) {
+		t.Errorf("got commits %v, want commits 2 and 1", commits)
+	}
+
+	errTests := map[string]error{
+		"default":          ErrNotRevisionRange,
+		"0...2":            ErrNotRevisionRange,
+		"doesntexist..tip": vcs.ErrRevisionNotFound,
+		"0..doesntexist":   vcs.ErrRevisionNotFound,
+	}
+	for spec, want := range errTests {
+		if _, _, err := r.ParseRevisionRange(spec); err != want {
+			t.Errorf("%q: got error %v, want %v", spec, err, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package hg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/internal"
+)
+
+// Search implements vcs.Searcher.
+func (r *Repository) Search(at vcs.CommitID, opt vcs.SearchOptions) ([]*vcs.SearchResult, error) {
+	return r.SearchContext(context.Background(), at, opt)
+}
+
+// SearchContext searches the text of the files at the given commit
+// ID, like `git grep`. Binary files and symlinks are skipped, as are
+// files excluded by opt.PathInclude and opt.PathExclude. Regexp
+// queries use the syntax of Go's regexp package.
+//
+// Files are read and matched by a pool of opt.Concurrency workers,
+// but results are always ordered by file path and then by line. Once
+// opt.Offset+opt.N results have been found in path order, the
+// remaining files are not searched. If ctx is canceled, SearchContext
+// stops promptly and returns ctx.Err().
+func (r *Repository) SearchContext(ctx context.Context, at vcs.CommitID, opt vcs.SearchOptions) ([]*vcs.SearchResult, error) {
+	var match func(line []byte) bool
+	switch opt.QueryType {
+	case vcs.FixedQuery:
+		query := []byte(opt.Query)
+		match = func(line []byte) bool { return bytes.Contains(line, query) }
+	case vcs.RegexpQuery:
+		re, err := regexp.Compile(opt.Query)
+		if err != nil {
+			return nil, err
+		}
+		match = re.Match
+	default:
+		return nil, fmt.Errorf("unrecognized QueryType: %q", opt.QueryType)
+	}
+	for _, pattern := range append(append([]string{}, opt.PathInclude...), opt.PathExclude...) {
+		if _, err := internal.MatchGlob(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	fs, err := r.fileSystem(at)
+	if err != nil {
+		return nil, err
+	}
+	m, err := fs.getManifest(fs.at)
+	if err != nil {
+		return nil, err
+	}
+	ents := make([]hg_store.ManifestEnt, 0, len(m))
+	for _, ent := range m {
+		if searchPath(ent.FileName, opt.PathInclude, opt.PathExclude) {
+			ents = append(ents, ent)
+		}
+	}
+	sort.Sort(manifestByName(ents))
+
+	workers := int(opt.Concurrency)
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	limit := -1
+	if opt.N > 0 {
+		limit = int(opt.Offset + opt.N)
+	}
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		results  = make([][]*vcs.SearchResult, len(ents))
+		done     = make([]bool, len(ents))
+		prefix   int // ents[:prefix] have all been searched
+		nPrefix  int // number of results in ents[:prefix]
+		firstErr error
+	)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				res, err := fs.searchFile(&ents[i], match, int(opt.ContextLines))
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				results[i], done[i] = res, true
+				for prefix < len(ents) && done[prefix] {
+					nPrefix += len(results[prefix])
+					prefix++
+				}
+				if limit != -1 && nPrefix >= limit {
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range ents {
+		select {
+		case work <- i:
+		case <-searchCtx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var res []*vcs.SearchResult
+	for _, fileRes := range results[:prefix] {
+		res = append(res, fileRes...)
+	}
+	if int(opt.Offset) >= len(res) {
+		return nil, nil
+	}
+	res = res[opt.Offset:]
+	if opt.N > 0 && len(res) > int(opt.N) {
+		res = res[:opt.N]
+	}
+	return res, nil
+}
+
+// searchPath reports whether the file at name is searched: if include
+// is non-empty, it must match one of its glob patterns, and it must
+// match none of exclude's.
+func searchPath(name string, include, exclude []string) bool {
+	matchesAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := internal.MatchGlob(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(include) == 0 || matchesAny(include)) && !matchesAny(exclude)
+}
+
+// searchFile returns the lines of the file for ent that match. Each
+// result is a run of matching lines plus contextLines of context
+// around them; runs that touch or overlap are merged.
+func (fs *hgFSNative) searchFile(ent *hg_store.ManifestEnt, match func(line []byte) bool, contextLines int) ([]*vcs.SearchResult, error) {
+	if ent.IsLink() {
+		return nil, nil
+	}
+	rec, err := fs.entryRec(ent)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.readFile(rec)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return nil, nil // binary file
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	var res []*vcs.SearchResult
+	var start, end int // current run of lines (0-indexed, inclusive)
+	flush := func() {
+		res = append(res, &vcs.SearchResult{
+			File:      ent.FileName,
+			StartLine: uint32(start + 1),
+			EndLine:   uint32(end + 1),
+			Match:     bytes.Join(lines[start:end+1], []byte("\n")),
+		})
+	}
+	inRun := false
+	for i, line := range lines {
+		if !match(line) {
+			continue
+		}
+		s, e := i-contextLines, i+contextLines
+		if s < 0 {
+			s = 0
+		}
+		if e >= len(lines) {
+			e = len(lines) - 1
+		}
+		if inRun && s <= end+1 {
+			end = e
+			continue
+		}
+		if inRun {
+			flush()
+		}
+		start, end, inRun = s, e, true
+	}
+	if inRun {
+		flush()
+	}
+	return res, nil
+}
+
+type manifestByName []hg_store.ManifestEnt
+
+func (v manifestByName) Len() int           { return len(v) }
+func (v manifestByName) Less(i, j int) bool { return v[i].FileName < v[j].FileName }
+func (v manifestByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
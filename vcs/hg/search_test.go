@@ -0,0 +1,228 @@
+package hg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/beyang/hgo"
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestSearchPath(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             bool
+	}{
+		{name: "a.go", want: true},
+		{name: "a.go", include: []string{"*.go"}, want: true},
+		{name: "a.txt", include: []string{"*.go"}, want: false},
+		{name: "d/a.go", include: []string{"*.go"}, want: false},
+		{name: "d/a.go", include: []string{"**/*.go"}, want: true},
+		{name: "d/a.go", include: []string{"*.txt", "d/*"}, want: true},
+		{name: "vendor/a.go", exclude: []string{"vendor/**"}, want: false},
+		{name: "vendor/a.go", include: []string{"**/*.go"}, exclude: []string{"vendor/**"}, want: false},
+		{name: "a.go", include: []string{"**/*.go"}, exclude: []string{"vendor/**"}, want: true},
+	}
+	for _, test := range tests {
+		if got := searchPath(test.name, test.include, test.exclude); got != test.want {
+			t.Errorf("searchPath(%q, %q, %q): got %v, want %v", test.name, test.include, test.exclude, got, test.want)
+		}
+	}
+}
+
+func TestRepository_SearchContext(t *testing.T) {
+	var id string
+	r, dir := makeTestRepo(t, func(dir string) {
+		id = writeTestRepoContents(t, dir, map[string]string{
+			"a":           "foo\nbar\nfoo\n",
+			"b/c":         "foo\n",
+			"b/d.go":      "x foo\n",
+			"bin":         "foo\x00",
+			"link\x00l":   "foo",
+			"vendor/v.go": "foo\n",
+			"z":           "bar\n",
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	result := func(file string, startLine, endLine uint32, match string) *vcs.SearchResult {
+		return &vcs.SearchResult{File: file, StartLine: startLine, EndLine: endLine, Match: []byte(match)}
+	}
+	tests := map[string]struct {
+		opt  vcs.SearchOptions
+		want []*vcs.SearchResult
+	}{
+		"fixed": {
+			opt: vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery},
+			want: []*vcs.SearchResult{
+				result("a", 1, 1, "foo"),
+				result("a", 3, 3, "foo"),
+				result("b/c", 1, 1, "foo"),
+				result("b/d.go", 1, 1, "x foo"),
+				result("vendor/v.go", 1, 1, "foo"),
+			},
+		},
+		"regexp": {
+			opt: vcs.SearchOptions{Query: "^foo$", QueryType: vcs.RegexpQuery},
+			want: []*vcs.SearchResult{
+				result("a", 1, 1, "foo"),
+				result("a", 3, 3, "foo"),
+				result("b/c", 1, 1, "foo"),
+				result("vendor/v.go", 1, 1, "foo"),
+			},
+		},
+		"context lines": {
+			opt: vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, ContextLines: 1, PathInclude: []string{"a"}},
+			want: []*vcs.SearchResult{
+				result("a", 1, 3, "foo\nbar\nfoo"),
+			},
+		},
+		"N and Offset": {
+			opt: vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, N: 2, Offset: 1},
+			want: []*vcs.SearchResult{
+				result("a", 3, 3, "foo"),
+				result("b/c", 1, 1, "foo"),
+			},
+		},
+		"Offset past the end": {
+			opt:  vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, N: 2, Offset: 5},
+			want: nil,
+		},
+		"PathInclude": {
+			opt: vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, PathInclude: []string{"**/*.go"}},
+			want: []*vcs.SearchResult{
+				result("b/d.go", 1, 1, "x foo"),
+				result("vendor/v.go", 1, 1, "foo"),
+			},
+		},
+		"PathExclude": {
+			opt: vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, PathExclude: []string{"vendor/**", "a"}},
+			want: []*vcs.SearchResult{
+				result("b/c", 1, 1, "foo"),
+				result("b/d.go", 1, 1, "x foo"),
+			},
+		},
+		"PathInclude and PathExclude": {
+			opt: vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, PathInclude: []string{"**/*.go"}, PathExclude: []string{"vendor/**"}},
+			want: []*vcs.SearchResult{
+				result("b/d.go", 1, 1, "x foo"),
+			},
+		},
+	}
+	for label, test := range tests {
+		// The results are in the same order however many files are
+		// searched at once.
+		for _, concurrency := range []int32{1, 2, 8} {
+			opt := test.opt
+			opt.Concurrency = concurrency
+			res, err := r.SearchContext(context.Background(), vcs.CommitID(id), opt)
+			if err != nil {
+				t.Errorf("%s (concurrency %d): %s", label, concurrency, err)
+				continue
+			}
+			if !reflect.DeepEqual(res, test.want) {
+				t.Errorf("%s (concurrency %d): got %v, want %v", label, concurrency, res, test.want)
+			}
+		}
+	}
+
+	for _, opt := range []vcs.SearchOptions{
+		{Query: "(", QueryType: vcs.RegexpQuery},
+		{Query: "foo", QueryType: "x"},
+		{Query: "foo", QueryType: vcs.FixedQuery, PathInclude: []string{"["}},
+	} {
+		if _, err := r.SearchContext(context.Background(), vcs.CommitID(id), opt); err == nil {
+			t.Errorf("%+v: got no error", opt)
+		}
+	}
+}
+
+// A searchStore is like a countingStore, but it can be used by
+// concurrent searches, and it calls onOpen (if set) before each open.
+type searchStore struct {
+	Store
+	onOpen func()
+
+	mu     sync.Mutex
+	opened int
+}
+
+func (s *searchStore) OpenRevlog(fileName string) (*hg_revlog.Index, error) {
+	s.mu.Lock()
+	s.opened++
+	s.mu.Unlock()
+	if s.onOpen != nil {
+		s.onOpen()
+	}
+	return s.Store.OpenRevlog(fileName)
+}
+
+// openCountingRepo writes a repository with n files (f00, f01, ...)
+// that each contain "foo" and opens it through a searchStore.
+func openSearchRepo(t *testing.T, n int) (r *Repository, st *searchStore, id, dir string) {
+	files := map[string]string{}
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("f%02d", i)] = "foo\n"
+	}
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = writeTestRepoContents(t, dir, files)
+	u, err := hgo.OpenRepository(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	st = &searchStore{Store: u.NewStore()}
+	r, err = OpenStore(dir, st)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return r, st, id, dir
+}
+
+func TestRepository_SearchContext_limit(t *testing.T) {
+	const n = 20
+	r, st, id, dir := openSearchRepo(t, n)
+	defer os.RemoveAll(dir)
+
+	res, err := r.SearchContext(context.Background(), vcs.CommitID(id), vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, N: 1, Offset: 1, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*vcs.SearchResult{{File: "f01", StartLine: 1, EndLine: 1, Match: []byte("foo")}}; !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	// Once Offset+N results have been found, the remaining files
+	// aren't searched.
+	if st.opened >= n {
+		t.Errorf("got %d files searched, want fewer than %d", st.opened, n)
+	}
+}
+
+func TestRepository_SearchContext_canceled(t *testing.T) {
+	const n = 20
+	r, st, id, dir := openSearchRepo(t, n)
+	defer os.RemoveAll(dir)
+
+	// The search is canceled while the first file is being read.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st.onOpen = cancel
+
+	if _, err := r.SearchContext(ctx, vcs.CommitID(id), vcs.SearchOptions{Query: "foo", QueryType: vcs.FixedQuery, Concurrency: 1}); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if st.opened >= n {
+		t.Errorf("got %d files searched, want fewer than %d", st.opened, n)
+	}
+}
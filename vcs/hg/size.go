@@ -0,0 +1,45 @@
+package hg
+
+import (
+	"os"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/util"
+)
+
+// recSize returns the size of the file revision rec's full text,
+// which the revlog index records alongside the (possibly compressed
+// and delta-encoded) data, so the text doesn't need to be rebuilt.
+func recSize(rec *hg_revlog.Rec) int64 {
+	return int64(rec.FileLength)
+}
+
+// setSizes sets the Size of each file in fis (the entries of the
+// directory dir) from its revlog index. Subdirectories are left
+// unchanged. No file contents are read, but each file's revlog must
+// still be opened.
+func (fs *hgFSNative) setSizes(dir string, fis []os.FileInfo) error {
+	ents, err := fs.manifestEnts()
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		name := fi.Name()
+		if dir != "." {
+			name = dir + "/" + name
+		}
+		ent, ok := ents[name]
+		if !ok {
+			continue
+		}
+		rec, err := fs.entryRec(ent)
+		if err != nil {
+			return standardizeHgError(err)
+		}
+		fi.(*util.FileInfo).Size_ = recSize(rec)
+	}
+	return nil
+}
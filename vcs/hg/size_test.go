@@ -0,0 +1,70 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestRepository_ReadDirSizes(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		ids = writeTestRepoCommits(t, dir, []testCommit{
+			{files: map[string]string{"a": "1", "d/x": "x"}},
+			{parents: []int{0}, files: map[string]string{"a": "12345", "empty": "", "bin": "\x00ab", "link\x00l": "d/x", "d/x": "x"}},
+		})
+	})
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		sizes bool
+		dir   string
+		want  map[string]int64
+	}{
+		// A symlink's size is the length of its target, and
+		// subdirectories' sizes are 0.
+		"sizes":        {sizes: true, dir: ".", want: map[string]int64{"a": 5, "bin": 3, "d": 0, "empty": 0, "link": 3}},
+		"subdirectory": {sizes: true, dir: "d", want: map[string]int64{"x": 1}},
+		"no sizes":     {dir: ".", want: map[string]int64{"a": 0, "bin": 0, "d": 0, "empty": 0, "link": 0}},
+	}
+	for label, test := range tests {
+		r.ReadDirSizes = test.sizes
+		fs, err := r.FileSystem(vcs.CommitID(ids[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fis, err := fs.ReadDir(test.dir)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		got := make(map[string]int64, len(fis))
+		for _, fi := range fis {
+			got[fi.Name()] = fi.Size()
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got sizes %v, want %v", label, got, test.want)
+		}
+
+		// The sizes match Stat's.
+		if test.sizes {
+			for _, fi := range fis {
+				if fi.IsDir() {
+					continue
+				}
+				name := fi.Name()
+				if test.dir != "." {
+					name = test.dir + "/" + name
+				}
+				st, err := fs.Lstat(name)
+				if err != nil {
+					t.Errorf("%s: %s", label, err)
+				} else if st.Size() != fi.Size() {
+					t.Errorf("%s: %s: got size %d, but Lstat's is %d", label, name, fi.Size(), st.Size())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package hg
+
+import "time"
+
+// A RepoStat summarizes a repository, for an overview of it.
+type RepoStat struct {
+	Files    int       // number of files at the tip
+	Branches int       // number of named branches, including closed ones
+	Tags     int       // number of tags (as returned by Tags)
+	TipDate  time.Time // author date of the tip commit
+}
+
+// Stat returns summary statistics of the repository. The file count
+// comes from the tip's manifest (which is cached, so that a
+// FileSystem at the tip can reuse it), and the branch and tag counts
+// come from the branch heads and tags read when the repository was
+// opened (or last refreshed), so only the tip's changeset and
+// manifest are read. An empty repository has a zero RepoStat.
+func (r *Repository) Stat() (*RepoStat, error) {
+	if err := r.refreshIfStale(); err != nil {
+		return nil, err
+	}
+	state := r.state()
+	if state.branchHeadsErr != nil {
+		return nil, state.branchHeadsErr
+	}
+	tip := state.cl.Tip()
+	if tip == nil || tip.FileRev() < 0 {
+		return &RepoStat{}, nil
+	}
+
+	m, err := r.manifest(tip)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := readChangeset(tip)
+	if err != nil {
+		return nil, err
+	}
+	st := &RepoStat{
+		Files:    len(m),
+		Branches: len(state.branchHeads.IdByName),
+		Tags:     len(state.allTags.IdByName),
+		TipDate:  cs.Date,
+	}
+	if r.ExcludeTipTag {
+		st.Tags--
+	}
+	return st, nil
+}
@@ -0,0 +1,36 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepository_Stat(t *testing.T) {
+	r, dir := makeTestRepo(t, func(dir string) {
+		writeTestRepoTree(t, dir, []string{"a", "b/c", "b/d"})
+	})
+	defer os.RemoveAll(dir)
+
+	st, err := r.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &RepoStat{Files: 3, Branches: 1, Tags: 1, TipDate: time.Unix(1136214245, 0)}
+	if !st.TipDate.Equal(want.TipDate) {
+		t.Errorf("got TipDate %v, want %v", st.TipDate, want.TipDate)
+	}
+	st.TipDate = want.TipDate
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("got %+v, want %+v", st, want)
+	}
+
+	// The synthetic "tip" tag is counted only if Tags returns it.
+	r.ExcludeTipTag = true
+	if st, err := r.Stat(); err != nil {
+		t.Fatal(err)
+	} else if st.Tags != 0 {
+		t.Errorf("ExcludeTipTag: got %d tags, want 0", st.Tags)
+	}
+}
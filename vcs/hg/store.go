@@ -0,0 +1,151 @@
+package hg
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	hg_store "github.com/beyang/hgo/store"
+)
+
+// A Store opens the revlogs of a repository's store. The default,
+// used by Open, is hgo's *store.Store, which reads them from the
+// repository's .hg/store directory; another can be passed to
+// OpenStore to read them from elsewhere (e.g., a cache of the
+// indexes, or a fake in tests).
+type Store interface {
+	OpenChangeLog() (*hg_revlog.Index, error)
+	OpenManifests() (*hg_revlog.Index, error)
+
+	// OpenRevlog opens the filelog of the named file (a path
+	// relative to the repository root, with "/" separators).
+	OpenRevlog(fileName string) (*hg_revlog.Index, error)
+}
+
+var _ Store = (*hg_store.Store)(nil)
+
+// store wraps a Store to limit the number of file and manifest revlogs
+// that are opened or read from concurrently to the repository's
+// MaxConcurrentReads.
+type store struct {
+	Store
+	maxReads *int // points to Repository.MaxConcurrentReads
+
+	once sync.Once
+	sem  chan struct{} // nil if unlimited
+}
+
+// acquire waits until a read may proceed and returns a func to be
+// called when it is done.
+func (s *store) acquire() (release func()) {
+	s.once.Do(func() {
+		if *s.maxReads > 0 {
+			s.sem = make(chan struct{}, *s.maxReads)
+		}
+	})
+	if s.sem == nil {
+		return func() {}
+	}
+	s.sem <- struct{}{}
+	return func() { <-s.sem }
+}
+
+func (s *store) OpenRevlog(fileName string) (*hg_revlog.Index, error) {
+	defer s.acquire()()
+	return s.Store.OpenRevlog(fileName)
+}
+
+func (s *store) OpenManifests() (*hg_revlog.Index, error) {
+	defer s.acquire()()
+	return s.Store.OpenManifests()
+}
+
+// build reads the text of the file or manifest revlog record rec.
+func (s *store) build(fb *hg_revlog.FileBuilder, rec *hg_revlog.Rec) ([]byte, error) {
+	defer s.acquire()()
+	return fb.Build(rec)
+}
+
+// buildManifest reads the manifest revlog record rec.
+func (s *store) buildManifest(fb *hg_revlog.FileBuilder, rec *hg_revlog.Rec) (hg_store.Manifest, error) {
+	defer s.acquire()()
+	return hg_store.BuildManifest(rec, fb)
+}
+
+// storeFile returns the path of the named file in the repository's
+// store directory (.hg/store, or .hg itself in repositories created
+// by old versions of hg).
+func (r *Repository) storeFile(name string) string {
+	if fi, err := os.Stat(filepath.Join(r.Dir, ".hg", "store")); err == nil && fi.IsDir() {
+		return filepath.Join(r.Dir, ".hg", "store", name)
+	}
+	return filepath.Join(r.Dir, ".hg", name)
+}
+
+// errNoFncache is returned by AllTrackedPaths for repositories that
+// don't use the fncache store format.
+var errNoFncache = errors.New("hg repository has no fncache (it was created by an old version of hg)")
+
+// AllTrackedPaths returns the paths of all files that have ever been
+// tracked in the repository (including deleted files), sorted. It is
+// read from the store's fncache, which lists every filelog, so it is
+// much cheaper than reading the manifests of the whole history.
+func (r *Repository) AllTrackedPaths() ([]string, error) {
+	data, err := ioutil.ReadFile(r.storeFile("fncache"))
+	if os.IsNotExist(err) {
+		requires, err := ioutil.ReadFile(filepath.Join(r.Dir, ".hg", "requires"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, req := range strings.Fields(string(requires)) {
+			if req == "fncache" {
+				return nil, nil // no files have been committed yet
+			}
+		}
+		return nil, errNoFncache
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseFncache(data), nil
+}
+
+// parseFncache returns the sorted file paths of the filelogs listed
+// in the fncache data. Each line of the fncache is the store path of
+// a filelog's index or data file (e.g., "data/dir/file.txt.i"), with
+// hg's directory encoding applied.
+func parseFncache(data []byte) []string {
+	seen := map[string]struct{}{}
+	var paths []string
+	for _, line := range strings.Split(decodeDir(string(data)), "\n") {
+		if !strings.HasPrefix(line, "data/") {
+			continue // e.g., "meta/" entries for tree manifests
+		}
+		path := strings.TrimPrefix(line, "data/")
+		if !strings.HasSuffix(path, ".i") && !strings.HasSuffix(path, ".d") {
+			continue
+		}
+		path = path[:len(path)-len(".i")]
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// decodeDir reverses hg's directory encoding of store paths, which
+// appends ".hg" to directory names ending in ".i", ".d", or ".hg" so
+// they can't collide with revlog file names.
+func decodeDir(path string) string {
+	if !strings.Contains(path, ".hg/") {
+		return path
+	}
+	return strings.NewReplacer(".d.hg/", ".d/", ".i.hg/", ".i/", ".hg.hg/", ".hg/").Replace(path)
+}
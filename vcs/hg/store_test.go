@@ -0,0 +1,156 @@
+package hg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beyang/hgo"
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestStore_acquire(t *testing.T) {
+	max := 1
+	s := &store{maxReads: &max}
+
+	release := s.acquire()
+	acquired := make(chan struct{})
+	go func() {
+		s.acquire()()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second read proceeded while the first was in progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second read didn't proceed after the first finished")
+	}
+}
+
+// A concurrencyStore records the most filelogs that were being opened
+// through it at once.
+type concurrencyStore struct {
+	Store
+
+	mu         sync.Mutex
+	opening    int
+	maxOpening int
+}
+
+func (s *concurrencyStore) OpenRevlog(fileName string) (*hg_revlog.Index, error) {
+	s.mu.Lock()
+	s.opening++
+	if s.opening > s.maxOpening {
+		s.maxOpening = s.opening
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.opening--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond) // so that concurrent opens overlap
+	return s.Store.OpenRevlog(fileName)
+}
+
+func TestRepository_MaxConcurrentReads(t *testing.T) {
+	const n = 8
+	files := map[string]string{}
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("f%d", i)] = fmt.Sprintf("%d\n", i)
+	}
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := writeTestRepoContents(t, dir, files)
+	u, err := hgo.OpenRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &concurrencyStore{Store: u.NewStore()}
+	r, err := OpenStore(dir, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.MaxConcurrentReads = 1
+
+	fs, err := r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for name, want := range files {
+		wg.Add(1)
+		go func(name, want string) {
+			defer wg.Done()
+			if data, err := vfs.ReadFile(fs, name); err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if string(data) != want {
+				t.Errorf("%s: got contents %q, want %q", name, data, want)
+			}
+		}(name, want)
+	}
+	wg.Wait()
+	if st.maxOpening != 1 {
+		t.Errorf("got %d filelogs opened at once, want 1", st.maxOpening)
+	}
+
+	// Reading a file revision also waits for a slot, even once its
+	// filelog is open. A new FileSystem is used so that the file isn't
+	// cached.
+	fs, err = r.FileSystem(vcs.CommitID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _, err := fs.(*hgFSNative).getEntry("f0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := r.st.acquire()
+	read := make(chan struct{})
+	go func() {
+		if _, err := fs.(*hgFSNative).readFile(rec); err != nil {
+			t.Error(err)
+		}
+		close(read)
+	}()
+	select {
+	case <-read:
+		t.Fatal("file was read while all slots were taken")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Fatal("file wasn't read after a slot was released")
+	}
+}
+
+func TestParseFncache(t *testing.T) {
+	data := []byte("data/b.txt.i\n" +
+		"data/a/big.bin.i\n" +
+		"data/a/big.bin.d\n" +
+		"data/x.i.hg/y.i\n" +
+		"meta/a/00manifest.i\n")
+	want := []string{"a/big.bin", "b.txt", "x.i/y"}
+	if got := parseFncache(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package hg
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	hg_store "github.com/beyang/hgo/store"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/util"
+)
+
+// maxSymlinkDepth is the maximum number of symlinks followed when
+// resolving a symlink, to avoid looping forever on symlink cycles.
+const maxSymlinkDepth = 40
+
+// ErrSymlinkLoop is returned (wrapped in an *os.PathError) by a
+// FileSystem's Stat method when a path can't be resolved within
+// maxSymlinkDepth symlinks, which usually means that the symlinks
+// form a cycle.
+var ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// followSymlink returns the FileInfo of the final target of the
+// symlink ent, under the symlink's own name. If the target is a
+// directory, a directory FileInfo is returned. If the target is
+// outside of the repository, doesn't exist, or can't be resolved
+// within maxSymlinkDepth links, the symlink's own FileInfo is
+// returned.
+func (fs *hgFSNative) followSymlink(m hg_store.Manifest, ents map[string]*hg_store.ManifestEnt, ent *hg_store.ManifestEnt, mtime time.Time) (*util.FileInfo, error) {
+	link := fileInfo(ent, mtime)
+	target := ent
+	for i := 0; target.IsLink(); i++ {
+		if i == maxSymlinkDepth {
+			return link, nil
+		}
+		rec, err := fs.entryRec(target)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.readFile(rec)
+		if err != nil {
+			return nil, err
+		}
+
+		dest, ok := symlinkTarget(target.FileName, string(data))
+		if !ok {
+			return link, nil
+		}
+		if e := ents[dest]; e != nil {
+			target = e
+			continue
+		}
+		if isManifestDir(m, dest) {
+			return &util.FileInfo{Name_: link.Name_, Mode_: os.ModeDir, ModTime_: mtime}, nil
+		}
+		return link, nil // dangling symlink
+	}
+
+	fi := fileInfo(target, mtime)
+	fi.Name_ = link.Name_
+	return fi, nil
+}
+
+// ReadLink implements vcs.SymlinkReader. hg stores a symlink's target
+// as the contents of its file revision.
+func (fs *hgFSNative) ReadLink(name string) (string, error) {
+	name, err := cleanPath("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	rec, ent, err := fs.getEntry(name)
+	if err != nil {
+		return "", standardizeHgError(err)
+	}
+	if !ent.IsLink() {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: vcs.ErrNotSymlink}
+	}
+	data, err := fs.readFile(rec)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// symlinkTarget returns the path (relative to the repository root) of
+// the target of the symlink at name whose contents are dest. Relative
+// targets are resolved against the symlink's directory. It reports
+// false if the target is outside of the repository (or absolute).
+func symlinkTarget(name, dest string) (string, bool) {
+	if path.IsAbs(dest) {
+		return "", false
+	}
+	dest = path.Join(path.Dir(name), dest)
+	if dest == ".." || strings.HasPrefix(dest, "../") {
+		return "", false
+	}
+	return dest, true
+}
+
+// isManifestDir reports whether dir is a directory in manifest m
+// (i.e., whether any files are beneath it).
+func isManifestDir(m hg_store.Manifest, dir string) bool {
+	if dir == "." {
+		return true
+	}
+	prefix := dir + "/"
+	for _, e := range m {
+		if strings.HasPrefix(e.FileName, prefix) {
+			return true
+		}
+	}
+	return false
+}
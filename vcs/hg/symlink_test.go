@@ -0,0 +1,78 @@
+package hg
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestSymlinkTarget(t *testing.T) {
+	tests := []struct {
+		name, dest string
+		want       string
+		ok         bool
+	}{
+		{"link", "file", "file", true},
+		{"dir/link", "file", "dir/file", true},
+		{"dir/link", "../file", "file", true},
+		{"dir/sub/link", "../other/./file", "dir/other/file", true},
+		{"link", "../file", "", false},
+		{"dir/link", "../../file", "", false},
+		{"link", "/etc/passwd", "", false},
+	}
+	for _, test := range tests {
+		got, ok := symlinkTarget(test.name, test.dest)
+		if got != test.want || ok != test.ok {
+			t.Errorf("symlinkTarget(%q, %q): got (%q, %v), want (%q, %v)", test.name, test.dest, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRepository_FileSystem_ReadDirSymlinkedDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// link1 points to a directory, link2 to a file, and link3 to
+	// nothing.
+	id := writeTestRepoContents(t, dir, map[string]string{
+		"dir1/file1": "a",
+		"link1\x00l": "dir1",
+		"link2\x00l": "dir1/file1",
+		"link3\x00l": "missing",
+	})
+
+	tests := map[bool]map[string]os.FileMode{
+		false: {"dir1": os.ModeDir, "link1": os.ModeSymlink, "link2": os.ModeSymlink, "link3": os.ModeSymlink},
+		true:  {"dir1": os.ModeDir, "link1": os.ModeDir, "link2": 0, "link3": os.ModeSymlink},
+	}
+	for follow, want := range tests {
+		r, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ReadDirFollowSymlinks = follow
+		fs, err := r.FileSystem(vcs.CommitID(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := fs.ReadDir(".")
+		if err != nil {
+			t.Errorf("follow=%v: %s", follow, err)
+			continue
+		}
+		got := make(map[string]os.FileMode, len(entries))
+		for _, e := range entries {
+			got[e.Name()] = e.Mode()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("follow=%v: got modes %v, want %v", follow, got, want)
+		}
+	}
+}
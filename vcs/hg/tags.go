@@ -0,0 +1,260 @@
+package hg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"sort"
+
+	hg_revlog "github.com/beyang/hgo/revlog"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+// tagsByID returns a map from commit ID to the names of the tags
+// that point to it. The synthetic "tip" tag is omitted.
+func (r *Repository) tagsByID() map[string][]string {
+	allTags := r.state().allTags
+	m := make(map[string][]string, len(allTags.IdByName))
+	for name, id := range allTags.IdByName {
+		if name == "tip" {
+			continue
+		}
+		m[id] = append(m[id], name)
+	}
+	for _, names := range m {
+		sort.Strings(names)
+	}
+	return m
+}
+
+// TagsInRange returns the tags that point to commits reachable from
+// head but not from base (like `git log base..head`), ordered by
+// commit (oldest first). If base is empty, all tags reachable from
+// head are returned.
+func (r *Repository) TagsInRange(base, head vcs.CommitID) ([]*vcs.Tag, error) {
+	headRec, err := r.getRec(head)
+	if err != nil {
+		return nil, err
+	}
+	recs := ancestorRecs(headRec)
+
+	if base != "" {
+		baseRec, err := r.getRec(base)
+		if err != nil {
+			return nil, err
+		}
+		for rev := range ancestorRecs(baseRec) {
+			delete(recs, rev)
+		}
+	}
+
+	revs := make([]int, 0, len(recs))
+	for rev := range recs {
+		revs = append(revs, rev)
+	}
+	sort.Ints(revs)
+
+	byID := r.tagsByID()
+	var tags []*vcs.Tag
+	for _, rev := range revs {
+		id := hex.EncodeToString(recs[rev].Id())
+		for _, name := range byID[id] {
+			tags = append(tags, &vcs.Tag{Name: name, CommitID: vcs.CommitID(id)})
+		}
+	}
+	return tags, nil
+}
+
+// LatestTagFirstParent returns the tag nearest to from along from's
+// first-parent history (from itself, its first parent, that commit's
+// first parent, and so on) and the commit it points to. Tags on
+// commits that were merged in from other lines of development are
+// ignored, which matches versioning schemes that tag releases on the
+// mainline. If the nearest tagged commit has more than one tag, the
+// first by name is returned. If no such commit is tagged,
+// vcs.ErrTagNotFound is returned.
+func (r *Repository) LatestTagFirstParent(from vcs.CommitID) (string, vcs.CommitID, error) {
+	rec, err := r.getRec(from)
+	if err != nil {
+		return "", "", err
+	}
+
+	byID := r.tagsByID()
+	for {
+		id := hex.EncodeToString(rec.Id())
+		if names := byID[id]; len(names) > 0 {
+			return names[0], vcs.CommitID(id), nil
+		}
+		ps := parentRecs(rec)
+		if len(ps) == 0 {
+			return "", "", vcs.ErrTagNotFound
+		}
+		rec = ps[0]
+	}
+}
+
+// hgtagsFile is the file in which hg records tags.
+const hgtagsFile = ".hgtags"
+
+// A TagInfo describes a tag and the commit that created it.
+type TagInfo struct {
+	Name     string
+	CommitID vcs.CommitID // the commit that the tag points to
+
+	// TaggedBy is the commit that added the tag to .hgtags (e.g., by
+	// running `hg tag`), and Tagger is its author, whose date is when
+	// the tag was created. They are empty for tags that aren't
+	// recorded in .hgtags, such as local tags.
+	TaggedBy vcs.CommitID
+	Tagger   *vcs.Signature
+}
+
+// TagInfo returns information about the named tag, including who
+// created it and when. The commit that created the tag is found by
+// reading the history of .hgtags (see tagAssignments), so its cost
+// is proportional to the number of commits that changed .hgtags. If
+// no such tag exists, vcs.ErrTagNotFound is returned.
+func (r *Repository) TagInfo(name string) (*TagInfo, error) {
+	id, ok := r.state().allTags.IdByName[name]
+	if !ok || name == "tip" {
+		return nil, vcs.ErrTagNotFound
+	}
+
+	info := &TagInfo{Name: name, CommitID: vcs.CommitID(id)}
+	as, err := r.tagAssignments(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		if a := as[i]; a.target == info.CommitID {
+			info.TaggedBy = vcs.CommitID(hex.EncodeToString(a.rec.Id()))
+			tagger := parseSignature(a.cs.User, a.cs.Date)
+			info.Tagger = &tagger
+			break
+		}
+	}
+	return info, nil
+}
+
+// A TagAssignment is a change to the commit that a tag points to,
+// recorded in .hgtags.
+type TagAssignment struct {
+	// CommitID is the commit that the tag was set to point to. It is
+	// empty if the tag was removed (with `hg tag --remove`).
+	CommitID vcs.CommitID
+
+	// TaggedBy is the commit that changed .hgtags, and Tagger is its
+	// author, whose date is when the assignment was made.
+	TaggedBy vcs.CommitID
+	Tagger   vcs.Signature
+}
+
+// TagHistory returns each assignment of the named tag recorded in the
+// history of .hgtags, oldest first, so that a tag that was moved
+// (retagged) has more than one. Like TagInfo, it reads the history of
+// .hgtags, and the assignments are in changelog order. If the tag was
+// never recorded in .hgtags and doesn't currently exist,
+// vcs.ErrTagNotFound is returned; a local tag has no assignments.
+func (r *Repository) TagHistory(name string) ([]TagAssignment, error) {
+	as, err := r.tagAssignments(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := r.state().allTags.IdByName[name]; len(as) == 0 && (!ok || name == "tip") {
+		return nil, vcs.ErrTagNotFound
+	}
+
+	history := make([]TagAssignment, len(as))
+	for i, a := range as {
+		history[i] = TagAssignment{
+			CommitID: a.target,
+			TaggedBy: vcs.CommitID(hex.EncodeToString(a.rec.Id())),
+			Tagger:   parseSignature(a.cs.User, a.cs.Date),
+		}
+	}
+	return history, nil
+}
+
+// A tagAssignment is a commit that changed .hgtags so that a tag
+// points to a different commit (or, if target is empty, so that the
+// tag was removed).
+type tagAssignment struct {
+	target vcs.CommitID
+	rec    *hg_revlog.Rec // the commit that changed .hgtags
+	cs     *changeset
+}
+
+// tagAssignments returns the assignments of the named tag recorded
+// in the history of .hgtags, in changelog order (oldest first). It
+// reads each revision of .hgtags from its filelog, attributing it to
+// the commit that introduced it (its linkrev), so only the commits
+// that changed .hgtags are read. The history is linearized in
+// changelog order, so if .hgtags was changed on several branches,
+// consecutive assignments may come from different branches. A
+// commit that removed .hgtags has no revision in the filelog, so it
+// isn't treated as removing the tags.
+func (r *Repository) tagAssignments(name string) ([]tagAssignment, error) {
+	flog, err := r.st.OpenRevlog(hgtagsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cl := r.state().cl
+
+	var as []tagAssignment
+	var cur vcs.CommitID
+	tip := flog.Tip()
+	for i := 0; tip != nil && i <= tip.FileRev(); i++ {
+		frec, err := hg_revlog.FileRevSpec(i).Lookup(flog)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.st.build(hg_revlog.NewFileBuilder(), frec)
+		if err != nil {
+			return nil, err
+		}
+		target := parseHgtags(data)[name]
+		if target == cur {
+			continue
+		}
+
+		rec, err := hg_revlog.FileRevSpec(int(frec.Linkrev)).Lookup(cl)
+		if err != nil {
+			return nil, err
+		}
+		cs, err := readChangeset(rec)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, tagAssignment{target: target, rec: rec, cs: cs})
+		cur = target
+	}
+	return as, nil
+}
+
+// parseHgtags parses the contents of an .hgtags file, whose lines
+// have the form:
+//
+//	<node> <tag name>
+//
+// and returns the commit that each tag points to. If a tag appears
+// on more than one line, the last line wins. A tag whose last line
+// has the null node was removed, and it maps to the empty commit ID.
+func parseHgtags(data []byte) map[string]vcs.CommitID {
+	tags := map[string]vcs.CommitID{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		i := bytes.IndexByte(line, ' ')
+		if i != 40 {
+			continue // blank or malformed
+		}
+		id := vcs.CommitID(line[:i])
+		if id == NullCommitID {
+			id = ""
+		}
+		tags[string(line[i+1:])] = id
+	}
+	return tags
+}
@@ -0,0 +1,216 @@
+package hg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestParseHgtags(t *testing.T) {
+	const (
+		a = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		b = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	data := []byte(a + " v1\n" +
+		a + " v2\r\n" +
+		b + " v2\n" +
+		"\n" +
+		"malformed\n" +
+		a + " with space\n" +
+		a + " removed\n" +
+		string(NullCommitID) + " removed\n")
+	want := map[string]vcs.CommitID{
+		"v1":         a,
+		"v2":         b,
+		"with space": a,
+		"removed":    "",
+	}
+	if got := parseHgtags(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// writeTaggedTestRepo writes a repository in which commit 3 merges
+// commits 1 and 2, commit 4 follows the merge, and commit 5 is an
+// unrelated root, and which has local tags on commits 0, 1, 2, and 4
+// (which has two tags).
+func writeTaggedTestRepo(t *testing.T, dir string) []string {
+	ids := writeTestRepoGraph(t, dir,
+		[]string{"root", "a", "side", "merge", "b", "unrelated"},
+		[][]int{nil, {0}, {0}, {1, 2}, {3}, nil},
+	)
+	writeTestFiles(t, dir, map[string]string{
+		".hg/localtags": ids[0] + " v0\n" + ids[1] + " v1\n" + ids[2] + " side\n" + ids[4] + " v2\n" + ids[4] + " a-v2\n",
+	})
+	return ids
+}
+
+func TestRepository_TagsInRange(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) { ids = writeTaggedTestRepo(t, dir) })
+	defer os.RemoveAll(dir)
+
+	tag := func(name string, rev int) *vcs.Tag { return &vcs.Tag{Name: name, CommitID: vcs.CommitID(ids[rev])} }
+	tests := map[string]struct {
+		base string
+		head int
+		want []*vcs.Tag
+	}{
+		// The synthetic "tip" tag (on commit 5) is omitted.
+		"tip": {base: "", head: 5, want: nil},
+		"all": {base: "", head: 4, want: []*vcs.Tag{tag("v0", 0), tag("v1", 1), tag("side", 2), tag("a-v2", 4), tag("v2", 4)}},
+		// v0 and v1 are reachable from base.
+		"range": {base: ids[1], head: 4, want: []*vcs.Tag{tag("side", 2), tag("a-v2", 4), tag("v2", 4)}},
+		"side":  {base: ids[1], head: 2, want: []*vcs.Tag{tag("side", 2)}},
+		"empty": {base: ids[4], head: 1, want: nil},
+	}
+	for label, test := range tests {
+		tags, err := r.TagsInRange(vcs.CommitID(test.base), vcs.CommitID(ids[test.head]))
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(tags, test.want) {
+			t.Errorf("%s: got tags %v, want %v", label, tags, test.want)
+		}
+	}
+
+	if _, err := r.TagsInRange("0123456789abcdef0123456789abcdef01234567", vcs.CommitID(ids[4])); err != vcs.ErrCommitNotFound {
+		t.Errorf("nonexistent base: got error %v, want %v", err, vcs.ErrCommitNotFound)
+	}
+}
+
+func TestRepository_LatestTagFirstParent(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) { ids = writeTaggedTestRepo(t, dir) })
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		from     int
+		wantName string
+		wantRev  int
+	}{
+		// Of the two tags on commit 4, the first by name is returned.
+		"tagged": {from: 4, wantName: "a-v2", wantRev: 4},
+
+		// The merge's second parent (2) is newer than its first (1),
+		// but its tag is ignored.
+		"merge": {from: 3, wantName: "v1", wantRev: 1},
+
+		"side branch": {from: 2, wantName: "side", wantRev: 2},
+	}
+	for label, test := range tests {
+		name, id, err := r.LatestTagFirstParent(vcs.CommitID(ids[test.from]))
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if name != test.wantName || id != vcs.CommitID(ids[test.wantRev]) {
+			t.Errorf("%s: got %s on %s, want %s on %s", label, name, id, test.wantName, ids[test.wantRev])
+		}
+	}
+
+	// The unrelated root isn't tagged (except by the synthetic "tip"
+	// tag, which is ignored).
+	if _, _, err := r.LatestTagFirstParent(vcs.CommitID(ids[5])); err != vcs.ErrTagNotFound {
+		t.Errorf("untagged history: got error %v, want %v", err, vcs.ErrTagNotFound)
+	}
+}
+
+func TestRepository_TagHistory(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 tags commit 0 as v1, and commit 2 moves v1 to commit 1
+		// (like `hg tag -f`, which keeps the old line). Commit 0's .hgtags
+		// has no tags. Each commit's .hgtags names earlier commits, so
+		// they are written one at a time.
+		contents := []string{"\n"}
+		parents := [][]int{nil, {0}, {1}}
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents[:1])
+		contents = append(contents, ids[0]+" v1\n")
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents[:2])
+		contents = append(contents, ids[0]+" v1\n"+ids[0]+" v1\n"+ids[1]+" v1\n")
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents)
+	})
+	defer os.RemoveAll(dir)
+	history, err := r.TagHistory("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagger := func(rev int) vcs.Signature {
+		return parseSignature("a <a@a.com>", time.Unix(int64(1136214245+rev), 0))
+	}
+	want := []TagAssignment{
+		{CommitID: vcs.CommitID(ids[0]), TaggedBy: vcs.CommitID(ids[1]), Tagger: tagger(1)},
+		{CommitID: vcs.CommitID(ids[1]), TaggedBy: vcs.CommitID(ids[2]), Tagger: tagger(2)},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("got history %+v, want %+v", history, want)
+	}
+}
+
+func TestRepository_TagInfo(t *testing.T) {
+	var ids []string
+	r, dir := makeTestRepo(t, func(dir string) {
+		// Commit 1 tags commit 0 as v1 and old, commit 2 moves v1 to
+		// commit 1, and commit 3 removes old (like `hg tag --remove`,
+		// which appends a line with the null node).
+		contents := []string{"\n"}
+		parents := [][]int{nil, {0}, {1}, {2}}
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents[:1])
+		contents = append(contents, ids[0]+" v1\n"+ids[0]+" old\n")
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents[:2])
+		contents = append(contents, contents[1]+ids[0]+" v1\n"+ids[1]+" v1\n")
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents[:3])
+		contents = append(contents, contents[2]+ids[0]+" old\n"+string(NullCommitID)+" old\n")
+		ids = writeTestRepoHistory(t, dir, ".hgtags", contents, parents)
+		writeTestFiles(t, dir, map[string]string{".hg/localtags": ids[2] + " local\n"})
+	})
+	defer os.RemoveAll(dir)
+
+	tagger := func(rev int) *vcs.Signature {
+		s := parseSignature("a <a@a.com>", time.Unix(int64(1136214245+rev), 0))
+		return &s
+	}
+	tests := map[string]*TagInfo{
+		// A moved tag was created by the commit that moved it.
+		"v1": {Name: "v1", CommitID: vcs.CommitID(ids[1]), TaggedBy: vcs.CommitID(ids[2]), Tagger: tagger(2)},
+
+		// A local tag isn't recorded in .hgtags.
+		"local": {Name: "local", CommitID: vcs.CommitID(ids[2])},
+	}
+	for name, want := range tests {
+		info, err := r.TagInfo(name)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s: got %+v, want %+v", name, info, want)
+		}
+	}
+
+	// A removed tag, the synthetic "tip" tag, and a tag that never
+	// existed aren't found.
+	for _, name := range []string{"old", "tip", "doesntexist"} {
+		if _, err := r.TagInfo(name); err != vcs.ErrTagNotFound {
+			t.Errorf("%s: got error %v, want %v", name, err, vcs.ErrTagNotFound)
+		}
+	}
+
+	// The removal is still in the tag's history.
+	history, err := r.TagHistory("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TagAssignment{
+		{CommitID: vcs.CommitID(ids[0]), TaggedBy: vcs.CommitID(ids[1]), Tagger: *tagger(1)},
+		{CommitID: "", TaggedBy: vcs.CommitID(ids[3]), Tagger: *tagger(3)},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("old: got history %+v, want %+v", history, want)
+	}
+}
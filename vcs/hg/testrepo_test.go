@@ -0,0 +1,414 @@
+package hg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// makeTestRepo creates a new temporary directory (which the caller
+// should remove), calls write to write an hg repository to it (e.g.,
+// with writeTestRepo or one of its variants below), and opens the
+// repository, failing the test if it can't be opened.
+func makeTestRepo(t testing.TB, write func(dir string)) (r *Repository, dir string) {
+	dir, err := ioutil.TempDir("", "go-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(dir)
+	r, err = Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Open(%q) failed: %s", dir, err)
+	}
+	return r, dir
+}
+
+// writeTestRepo writes a minimal hg repository to dir whose changelog
+// has a linear history of commits with the given messages (and no
+// files), and returns the commit IDs, oldest first. It overwrites any
+// existing changelog, so calling it again with more messages
+// simulates commits being appended to the repository (e.g., by an
+// external `hg pull`).
+func writeTestRepo(t testing.TB, dir string, messages ...string) []string {
+	parents := make([][]int, len(messages))
+	for rev := 1; rev < len(messages); rev++ {
+		parents[rev] = []int{rev - 1}
+	}
+	return writeTestRepoGraph(t, dir, messages, parents)
+}
+
+// writeTestRepoGraph is like writeTestRepo, but the commits' parents
+// are given by parents: parents[rev] lists the revisions of commit
+// rev's parents (none for a root commit, and two for a merge), each of
+// which must be less than rev.
+func writeTestRepoGraph(t testing.TB, dir string, messages []string, parents [][]int) []string {
+	texts := make([]string, len(messages))
+	for rev, msg := range messages {
+		texts[rev] = fmt.Sprintf("%040x\na <a@a.com>\n%d 0\n\n%s", 0, 1136214245+rev, msg)
+	}
+	changelog, nodes := buildRevlog(texts, parents)
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = hex.EncodeToString(node)
+	}
+
+	tip := ids[len(ids)-1]
+	writeTestFiles(t, dir, map[string]string{
+		".hg/requires":            "revlogv1\nstore\n",
+		".hg/store/00changelog.i": string(changelog),
+		".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", tip, len(ids)-1, tip),
+	})
+	return ids
+}
+
+// writeTestRepoTree writes a minimal hg repository to dir with a
+// single commit whose manifest lists the given files, and returns the
+// commit ID. The files' revlogs aren't written, so the files can be
+// listed (e.g., with ReadDir) but not read. A path may be followed by
+// "\x00" and the file's manifest flags (e.g., "run.sh\x00x" for an
+// executable file).
+func writeTestRepoTree(t testing.TB, dir string, paths []string) string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	var manifest bytes.Buffer
+	for i, path := range sorted {
+		var flags string
+		if j := strings.Index(path, "\x00"); j >= 0 {
+			path, flags = path[:j], path[j+1:]
+		}
+		fmt.Fprintf(&manifest, "%s\x00%040x%s\n", path, 1, flags)
+		sorted[i] = path
+	}
+	manifestlog, manifestNodes := buildRevlog([]string{manifest.String()}, [][]int{nil})
+
+	text := fmt.Sprintf("%x\na <a@a.com>\n%d 0\n%s\n\n%s", manifestNodes[0], 1136214245, strings.Join(sorted, "\n"), "add files")
+	changelog, nodes := buildRevlog([]string{text}, [][]int{nil})
+
+	id := hex.EncodeToString(nodes[0])
+	writeTestFiles(t, dir, map[string]string{
+		".hg/requires":            "revlogv1\nstore\n",
+		".hg/store/00changelog.i": string(changelog),
+		".hg/store/00manifest.i":  string(manifestlog),
+		".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", id, 0, id),
+	})
+	return id
+}
+
+// writeTestRepoContents is like writeTestRepoTree, but it writes the
+// files' revlogs, so that the files (keyed by path, optionally
+// followed by "\x00" and their manifest flags) have the given
+// contents. Paths must be lowercase, so that they don't need to be
+// encoded in the store.
+func writeTestRepoContents(t testing.TB, dir string, files map[string]string) string {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var manifest bytes.Buffer
+	var names []string
+	for _, path := range paths {
+		name, flags := path, ""
+		if i := strings.Index(path, "\x00"); i >= 0 {
+			name, flags = path[:i], path[i+1:]
+		}
+		filelog, fileNodes := buildRevlog([]string{files[path]}, [][]int{nil})
+		writeTestFiles(t, dir, map[string]string{".hg/store/data/" + name + ".i": string(filelog)})
+		fmt.Fprintf(&manifest, "%s\x00%x%s\n", name, fileNodes[0], flags)
+		names = append(names, name)
+	}
+	manifestlog, manifestNodes := buildRevlog([]string{manifest.String()}, [][]int{nil})
+
+	text := fmt.Sprintf("%x\na <a@a.com>\n%d 0\n%s\n\n%s", manifestNodes[0], 1136214245, strings.Join(names, "\n"), "add files")
+	changelog, nodes := buildRevlog([]string{text}, [][]int{nil})
+
+	id := hex.EncodeToString(nodes[0])
+	writeTestFiles(t, dir, map[string]string{
+		".hg/requires":            "revlogv1\nstore\n",
+		".hg/store/00changelog.i": string(changelog),
+		".hg/store/00manifest.i":  string(manifestlog),
+		".hg/cache/branchheads":   fmt.Sprintf("%s %d\n%s default\n", id, 0, id),
+	})
+	return id
+}
+
+// writeTestRepoHistory writes a minimal hg repository to dir in
+// which each commit sets the file at path (which must be lowercase)
+// to its entry in contents, and returns the commit IDs, oldest first.
+// The commits' parents are given by parents (as in
+// writeTestRepoGraph), and so are those of the file's revisions, so
+// that the file's history has the same shape as the commits'.
+func writeTestRepoHistory(t testing.TB, dir, path string, contents []string, parents [][]int) []string {
+	filelog, fileNodes := buildRevlog(contents, parents)
+	manifests := make([]string, len(contents))
+	for rev, node := range fileNodes {
+		manifests[rev] = fmt.Sprintf("%s\x00%x\n", path, node)
+	}
+	manifestlog, manifestNodes := buildRevlog(manifests, parents)
+	texts := make([]string, len(contents))
+	for rev, node := range manifestNodes {
+		texts[rev] = fmt.Sprintf("%x\na <a@a.com>\n%d 0\n%s\n\ncommit%d", node, 1136214245+rev, path, rev)
+	}
+	changelog, nodes := buildRevlog(texts, parents)
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = hex.EncodeToString(node)
+	}
+
+	tip := ids[len(ids)-1]
+	writeTestFiles(t, dir, map[string]string{
+		".hg/requires":                  "revlogv1\nstore\n",
+		".hg/store/00changelog.i":       string(changelog),
+		".hg/store/00manifest.i":        string(manifestlog),
+		".hg/store/data/" + path + ".i": string(filelog),
+		".hg/cache/branchheads":         fmt.Sprintf("%s %d\n%s default\n", tip, len(ids)-1, tip),
+	})
+	return ids
+}
+
+// A testCommit is a commit written by writeTestRepoCommits.
+type testCommit struct {
+	parents []int // as in writeTestRepoGraph
+
+	// files is the commit's tree, mapping each file's path (which must
+	// be lowercase) to its contents. A path may be followed by "\x00"
+	// and the file's manifest flags, as in writeTestRepoContents.
+	files map[string]string
+
+	date    string // "<unix time> <tz offset>", or "" for 1136214245+rev and 0
+	extra   string // the changeset's extra field (e.g., "branch:b"), if any
+	message string
+}
+
+// writeTestRepoCommits writes a minimal hg repository to dir with the
+// given commits, including their manifests and their files' revlogs,
+// and returns the commit IDs, oldest first. A file keeps its revision
+// from the commit's first (or else second) parent if its contents are
+// the same there, so that the files' revisions and linkrevs are like
+// those hg writes. The branch cache lists the heads of each branch
+// (as named by the commits' "branch" extra fields), oldest first.
+func writeTestRepoCommits(t testing.TB, dir string, commits []testCommit) []string {
+	type fileLog struct {
+		texts    []string
+		parents  [][]int
+		linkrevs []int
+	}
+	logs := map[string]*fileLog{}
+	fileRevs := make([]map[string]int, len(commits)) // per commit, from path
+	flags := make([]map[string]string, len(commits))
+	changed := make([][]string, len(commits))
+	for rev, c := range commits {
+		fileRevs[rev], flags[rev] = map[string]int{}, map[string]string{}
+		for path, data := range c.files {
+			if i := strings.Index(path, "\x00"); i >= 0 {
+				path, flags[rev][path[:i]] = path[:i], path[i+1:]
+			}
+			log := logs[path]
+			if log == nil {
+				log = &fileLog{}
+				logs[path] = log
+			}
+			fileRev := -1
+			var fileParents []int
+			for _, p := range c.parents {
+				if pr, ok := fileRevs[p][path]; ok {
+					if fileRev == -1 && log.texts[pr] == data {
+						fileRev = pr
+					}
+					if len(fileParents) == 0 || fileParents[0] != pr {
+						fileParents = append(fileParents, pr)
+					}
+				}
+			}
+			if fileRev == -1 {
+				fileRev = len(log.texts)
+				log.texts = append(log.texts, data)
+				log.parents = append(log.parents, fileParents)
+				log.linkrevs = append(log.linkrevs, rev)
+			}
+			fileRevs[rev][path] = fileRev
+		}
+
+		// Like hg, list the files that differ from the first parent.
+		for path, fileRev := range fileRevs[rev] {
+			if len(c.parents) == 0 {
+				changed[rev] = append(changed[rev], path)
+			} else if pr, ok := fileRevs[c.parents[0]][path]; !ok || pr != fileRev {
+				changed[rev] = append(changed[rev], path)
+			}
+		}
+		if len(c.parents) > 0 {
+			for path := range fileRevs[c.parents[0]] {
+				if _, ok := fileRevs[rev][path]; !ok {
+					changed[rev] = append(changed[rev], path)
+				}
+			}
+		}
+		sort.Strings(changed[rev])
+	}
+
+	fileNodes := map[string][][]byte{}
+	for path, log := range logs {
+		filelog, nodes := buildRevlogLinked(log.texts, log.parents, log.linkrevs)
+		writeTestFiles(t, dir, map[string]string{".hg/store/data/" + path + ".i": string(filelog)})
+		fileNodes[path] = nodes
+	}
+
+	manifests := make([]string, len(commits))
+	parents := make([][]int, len(commits))
+	for rev, c := range commits {
+		var paths []string
+		for path := range fileRevs[rev] {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		var manifest bytes.Buffer
+		for _, path := range paths {
+			fmt.Fprintf(&manifest, "%s\x00%x%s\n", path, fileNodes[path][fileRevs[rev][path]], flags[rev][path])
+		}
+		manifests[rev] = manifest.String()
+		parents[rev] = c.parents
+	}
+	manifestlog, manifestNodes := buildRevlog(manifests, parents)
+
+	texts := make([]string, len(commits))
+	branches := make([]string, len(commits))
+	for rev, c := range commits {
+		date := c.date
+		if date == "" {
+			date = fmt.Sprintf("%d 0", 1136214245+rev)
+		}
+		if c.extra != "" {
+			date += " " + c.extra
+		}
+		var files string
+		for _, path := range changed[rev] {
+			files += path + "\n"
+		}
+		texts[rev] = fmt.Sprintf("%x\na <a@a.com>\n%s\n%s\n%s", manifestNodes[rev], date, files, c.message)
+
+		branches[rev] = "default"
+		for _, kv := range strings.Split(c.extra, "\x00") {
+			if strings.HasPrefix(kv, "branch:") {
+				branches[rev] = strings.TrimPrefix(kv, "branch:")
+			}
+		}
+	}
+	changelog, nodes := buildRevlog(texts, parents)
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = hex.EncodeToString(node)
+	}
+
+	hasChild := make([]bool, len(commits)) // on the same branch
+	for rev, c := range commits {
+		for _, p := range c.parents {
+			if branches[p] == branches[rev] {
+				hasChild[p] = true
+			}
+		}
+	}
+	branchheads := fmt.Sprintf("%s %d\n", ids[len(ids)-1], len(ids)-1)
+	for rev := range commits {
+		if !hasChild[rev] {
+			branchheads += fmt.Sprintf("%s %s\n", ids[rev], branches[rev])
+		}
+	}
+	writeTestFiles(t, dir, map[string]string{
+		".hg/requires":            "revlogv1\nstore\n",
+		".hg/store/00changelog.i": string(changelog),
+		".hg/store/00manifest.i":  string(manifestlog),
+		".hg/cache/branchheads":   branchheads,
+	})
+	return ids
+}
+
+// buildRevlog returns an inline version 1 revlog whose revisions have
+// the given texts and parents (as in writeTestRepoGraph), each linked
+// to the changelog revision with the same number, and the revisions'
+// node IDs.
+func buildRevlog(texts []string, parents [][]int) ([]byte, [][]byte) {
+	return buildRevlogLinked(texts, parents, nil)
+}
+
+// buildRevlogLinked is like buildRevlog, but each revision rev is
+// linked to the changelog revision linkrevs[rev] (or to rev, if
+// linkrevs is nil).
+func buildRevlogLinked(texts []string, parents [][]int, linkrevs []int) ([]byte, [][]byte) {
+	var revlog bytes.Buffer
+	var nodes [][]byte
+	var offset int
+	for rev, text := range texts {
+		p1, p2 := int32(-1), int32(-1)
+		pn1, pn2 := make([]byte, 20), make([]byte, 20) // null
+		if ps := parents[rev]; len(ps) > 0 {
+			p1, pn1 = int32(ps[0]), nodes[ps[0]]
+			if len(ps) > 1 {
+				p2, pn2 = int32(ps[1]), nodes[ps[1]]
+			}
+		}
+		h := sha1.New()
+		if bytes.Compare(pn1, pn2) < 0 { // parents are hashed in sorted order
+			h.Write(pn1)
+			h.Write(pn2)
+		} else {
+			h.Write(pn2)
+			h.Write(pn1)
+		}
+		h.Write([]byte(text))
+		node := h.Sum(nil)
+
+		var data bytes.Buffer
+		zw := zlib.NewWriter(&data)
+		zw.Write([]byte(text))
+		zw.Close()
+
+		entry := struct {
+			OffsetFlags        uint64
+			CompLen, UncompLen int32
+			BaseRev, LinkRev   int32
+			P1, P2             int32
+			Node               [32]byte
+		}{uint64(offset) << 16, int32(data.Len()), int32(len(text)), int32(rev), int32(rev), p1, p2, [32]byte{}}
+		if linkrevs != nil {
+			entry.LinkRev = int32(linkrevs[rev])
+		}
+		copy(entry.Node[:], node)
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, entry)
+		b := buf.Bytes()
+		if rev == 0 {
+			binary.BigEndian.PutUint32(b, 0x00010001) // inline revlog, version 1
+		}
+		revlog.Write(b)
+		revlog.Write(data.Bytes())
+
+		offset += data.Len()
+		nodes = append(nodes, node)
+	}
+	return revlog.Bytes(), nodes
+}
+
+// writeTestFiles writes files (keyed by path relative to dir) to dir.
+func writeTestFiles(t testing.TB, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -245,11 +245,16 @@ func (r *Repository) commitLog(opt vcs.CommitsOptions) ([]*vcs.Commit, uint, err
 			return nil, 0, fmt.Errorf("r.GetParents failed: %s. Output was:\n\n%s", err, out)
 		}
 
+		// hg records a single user per changeset, so the committer
+		// mirrors the author.
+		author := vcs.Signature{string(parts[1]), string(parts[2]), pbtypes.NewTimestamp(authorTime)}
+		committer := author
 		commits[i] = &vcs.Commit{
-			ID:      id,
-			Author:  vcs.Signature{string(parts[1]), string(parts[2]), pbtypes.NewTimestamp(authorTime)},
-			Message: string(parts[4]),
-			Parents: parents,
+			ID:        id,
+			Author:    author,
+			Committer: &committer,
+			Message:   string(parts[4]),
+			Parents:   parents,
 		}
 	}
 
@@ -313,7 +318,11 @@ func (r *Repository) getParents(revSpec vcs.CommitID) ([]vcs.CommitID, error) {
 }
 
 func (r *Repository) Diff(base, head vcs.CommitID, opt *vcs.DiffOptions) (*vcs.Diff, error) {
-	cmd := exec.Command("hg", "-v", "diff", "-p", "--git", "--rev="+string(base), "--rev="+string(head), "--")
+	cmd := exec.Command("hg", "-v", "diff", "-p", "--git", "--rev="+string(base), "--rev="+string(head))
+	if opt != nil && opt.ContextLines > 0 {
+		cmd.Args = append(cmd.Args, "--unified="+strconv.Itoa(opt.ContextLines))
+	}
+	cmd.Args = append(cmd.Args, "--")
 	if opt != nil {
 		cmd.Args = append(cmd.Args, opt.Paths...)
 	}
@@ -347,6 +356,10 @@ func (r *Repository) Diff(base, head vcs.CommitID, opt *vcs.DiffOptions) (*vcs.D
 	if err != nil {
 		return nil, err
 	}
+	if opt.WordDiff {
+		// hg has no word diff, so compute it from the line diff.
+		out = internal.WordDiff(out)
+	}
 
 	return &vcs.Diff{
 		Raw: string(out),
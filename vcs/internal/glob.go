@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether name (a slash-separated path relative to
+// the repository root) matches the shell pattern. The pattern is
+// matched against the whole path, one path element at a time, using
+// the syntax of path.Match, so "*" doesn't match "/". In addition, an
+// element that is exactly "**" matches zero or more whole path
+// elements, so "**/*.go" matches "a.go" and "a/b/c.go", and "a/**"
+// matches everything beneath "a". Consecutive "**" elements behave
+// like a single one. The only possible returned error is
+// path.ErrBadPattern, when pattern is malformed.
+func MatchGlob(pattern, name string) (bool, error) {
+	pelems := strings.Split(pattern, "/")
+	for _, e := range pelems {
+		if e == "**" {
+			continue
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			return false, err
+		}
+	}
+	return matchElems(pelems, strings.Split(name, "/")), nil
+}
+
+// matchElems reports whether the path elements names match the
+// (already validated) pattern elements pelems.
+func matchElems(pelems, names []string) bool {
+	for len(pelems) > 0 {
+		if pelems[0] == "**" {
+			for len(pelems) > 0 && pelems[0] == "**" {
+				pelems = pelems[1:]
+			}
+			if len(pelems) == 0 {
+				return true
+			}
+			for i := range names {
+				if matchElems(pelems, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pelems[0], names[0]); !ok {
+			return false
+		}
+		pelems, names = pelems[1:], names[1:]
+	}
+	return len(names) == 0
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"path"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "a/b.go", false},
+		{"a/*.go", "a/b.go", true},
+		{"a/?.go", "a/bc.go", false},
+		{"**/*.go", "a.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"**/*.go", "a/b/c.txt", false},
+		{"**/**/*.txt", "a.txt", true},
+		{"**/**/*.txt", "a/b/c.txt", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "b/c", false},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/x/c", true},
+		{"a/**/c", "a/b/x/d", false},
+		{"**", "a/b", true},
+		{"[ab]/*", "b/x", true},
+		{"a", "a/b", false},
+	}
+	for _, test := range tests {
+		got, err := MatchGlob(test.pattern, test.name)
+		if err != nil {
+			t.Errorf("%q, %q: %s", test.pattern, test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q, %q: got %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+
+	if _, err := MatchGlob("a/[", "a/b"); err != path.ErrBadPattern {
+		t.Errorf("bad pattern: got error %v, want %v", err, path.ErrBadPattern)
+	}
+}
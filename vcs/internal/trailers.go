@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+var trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)[ \t]*:[ \t]*(.*)$`)
+
+// gitGeneratedTrailerPrefixes are the prefixes of the trailer lines
+// that git itself writes, which let git recognize a trailer block
+// that also contains other lines.
+var gitGeneratedTrailerPrefixes = []string{"Signed-off-by: ", "(cherry picked from commit "}
+
+// ParseTrailers parses the trailers (such as "Signed-off-by: a
+// <a@a.com>" and "Co-authored-by: b <b@b.com>") at the end of a commit
+// message, following the rules of `git interpret-trailers`: the
+// trailers are the lines of the message's last paragraph (other than
+// its first paragraph, the title) if all of them are trailers or
+// continuation lines, or if it contains a git-generated trailer and at
+// least 25% of its lines are trailers. Lines that begin with
+// whitespace continue the previous trailer's value. The values are
+// keyed by trailer key, as written, in the order they appear. If there
+// are no trailers, an empty map is returned.
+func ParseTrailers(message string) map[string][]string {
+	trailers := map[string][]string{}
+
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	// Find the last paragraph, which must not be the title paragraph.
+	start := len(lines)
+	for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+		start--
+	}
+	if strings.TrimSpace(strings.Join(lines[:start], "")) == "" {
+		return trailers
+	}
+	block := lines[start:]
+
+	type trailer struct{ key, value string }
+	var parsed []trailer
+	nTrailers, nOther := 0, 0
+	gitGenerated := false
+	for _, line := range block {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(parsed) > 0 {
+			parsed[len(parsed)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		for _, prefix := range gitGeneratedTrailerPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				gitGenerated = true
+			}
+		}
+		if m := trailerLine.FindStringSubmatch(line); m != nil {
+			parsed = append(parsed, trailer{m[1], strings.TrimSpace(m[2])})
+			nTrailers++
+		} else {
+			nOther++
+		}
+	}
+	if nTrailers == 0 || (nOther > 0 && !(gitGenerated && nTrailers*3 >= nOther)) {
+		return trailers
+	}
+
+	for _, t := range parsed {
+		trailers[t.key] = append(trailers[t.key], t.value)
+	}
+	return trailers
+}
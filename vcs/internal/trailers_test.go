@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrailers(t *testing.T) {
+	tests := map[string]struct {
+		message string
+		want    map[string][]string
+	}{
+		"no trailers": {
+			message: "title\n\nbody text\n",
+			want:    map[string][]string{},
+		},
+		"title only": {
+			message: "Signed-off-by: a <a@a.com>\n",
+			want:    map[string][]string{},
+		},
+		"trailers": {
+			message: "title\n\nbody\n\nCo-authored-by: b <b@b.com>\nSigned-off-by: a <a@a.com>\nCo-authored-by: c <c@c.com>\n",
+			want: map[string][]string{
+				"Co-authored-by": {"b <b@b.com>", "c <c@c.com>"},
+				"Signed-off-by":  {"a <a@a.com>"},
+			},
+		},
+		"continuation line": {
+			message: "title\n\nReviewed-by: a\n  and b\n",
+			want:    map[string][]string{"Reviewed-by": {"a and b"}},
+		},
+		"last paragraph is not all trailers": {
+			message: "title\n\nFixes: x\nsome text\n",
+			want:    map[string][]string{},
+		},
+		"git-generated trailer with other lines": {
+			message: "title\n\nsome text\nmore text\nSigned-off-by: a <a@a.com>\n",
+			want:    map[string][]string{"Signed-off-by": {"a <a@a.com>"}},
+		},
+	}
+	for label, test := range tests {
+		if got := ParseTrailers(test.message); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// maxUnifiedDiffLines bounds the size of the line matrix computed
+// for the differing middle of two files (after their common prefix
+// and suffix are trimmed). Larger files are diffed as if all of the
+// lines in the middle were replaced.
+const maxUnifiedDiffLines = 1 << 22
+
+// A lineOp is an operation in a line-level edit script: ' ' (keep),
+// '-' (delete), or '+' (insert). a and b are the indexes of the
+// lines in the old and new texts at the point of the operation.
+type lineOp struct {
+	kind byte
+	a, b int
+}
+
+// UnifiedHunks returns the hunks of a unified diff (without file
+// headers) from a to b, with context lines of unchanged context
+// around each change, as printed by `diff -u`. It returns nil if a
+// and b are equal. A final line that doesn't end with a newline is
+// followed by a "\ No newline at end of file" marker.
+func UnifiedHunks(a, b []byte, context int) []byte {
+	al, bl := SplitLines(string(a)), SplitLines(string(b))
+	ops := diffLines(al, bl)
+
+	var out bytes.Buffer
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk over later changes that are separated from
+		// it by at most 2*context unchanged lines.
+		end := i + 1
+		for j := end; j < len(ops) && j-end < 2*context+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		stop := end + context
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		var aLen, bLen int
+		for _, op := range ops[start:stop] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(ops[start].a, aLen), hunkRange(ops[start].b, bLen))
+		for _, op := range ops[start:stop] {
+			line := ""
+			switch op.kind {
+			case '+':
+				line = bl[op.b]
+			default:
+				line = al[op.a]
+			}
+			out.WriteByte(op.kind)
+			out.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	if out.Len() == 0 {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// hunkRange formats the range of a hunk header starting at the
+// 0-based line index start and spanning n lines.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
+
+// SplitLines splits s into lines, each including its trailing
+// newline (except possibly the last). A "\r\n" line ending is kept
+// as part of its line.
+func SplitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// LineMatches returns, for each of the lines b, the index of the
+// line of a that it is unchanged from in a line diff from a to b, or
+// -1 if the line was inserted.
+func LineMatches(a, b []string) []int {
+	m := make([]int, len(b))
+	for _, op := range diffLines(a, b) {
+		switch op.kind {
+		case ' ':
+			m[op.b] = op.a
+		case '+':
+			m[op.b] = -1
+		}
+	}
+	return m
+}
+
+// diffLines returns an edit script that turns the lines a into the
+// lines b.
+func diffLines(a, b []string) []lineOp {
+	var ops []lineOp
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		ops = append(ops, lineOp{' ', pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	am, bm := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	if len(am)*len(bm) > maxUnifiedDiffLines {
+		for i := range am {
+			ops = append(ops, lineOp{'-', pre + i, pre})
+		}
+		for j := range bm {
+			ops = append(ops, lineOp{'+', pre + len(am), pre + j})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence
+		// of am[i:] and bm[j:].
+		lcs := make([][]int, len(am)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(bm)+1)
+		}
+		for i := len(am) - 1; i >= 0; i-- {
+			for j := len(bm) - 1; j >= 0; j-- {
+				if am[i] == bm[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(am) || j < len(bm) {
+			switch {
+			case i < len(am) && j < len(bm) && am[i] == bm[j]:
+				ops = append(ops, lineOp{' ', pre + i, pre + j})
+				i++
+				j++
+			case j == len(bm) || (i < len(am) && lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, lineOp{'-', pre + i, pre + j})
+				i++
+			default:
+				ops = append(ops, lineOp{'+', pre + i, pre + j})
+				j++
+			}
+		}
+	}
+
+	for k := 0; k < suf; k++ {
+		ops = append(ops, lineOp{' ', len(a) - suf + k, len(b) - suf + k})
+	}
+	return ops
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnifiedHunks(t *testing.T) {
+	tests := map[string]struct {
+		a, b    string
+		context int
+		want    string
+	}{
+		"equal": {
+			a: "a\nb\n", b: "a\nb\n", context: 3,
+			want: "",
+		},
+		"changed line": {
+			a: "a\nb\nc\n", b: "a\nx\nc\n", context: 3,
+			want: "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		"added file": {
+			a: "", b: "a\nb\n", context: 3,
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		"removed file": {
+			a: "a\n", b: "", context: 3,
+			want: "@@ -1 +0,0 @@\n-a\n",
+		},
+		"separate hunks": {
+			a: "1\n2\n3\n4\n5\n6\n7\n", b: "x\n2\n3\n4\n5\n6\ny\n", context: 1,
+			want: "@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+y\n",
+		},
+		"merged hunks": {
+			a: "1\n2\n3\n4\n", b: "x\n2\n3\ny\n", context: 1,
+			want: "@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n",
+		},
+		"no newline at end": {
+			a: "a\nb", b: "a\nb\n", context: 3,
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for label, test := range tests {
+		if got := string(UnifiedHunks([]byte(test.a), []byte(test.b), test.context)); got != test.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", label, got, test.want)
+		}
+	}
+}
+
+func TestLineMatches(t *testing.T) {
+	a := SplitLines("a\nb\r\nc\n")
+	b := SplitLines("x\na\nb\r\nc")
+	if got, want := LineMatches(a, b), []int{-1, 0, 1, -1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
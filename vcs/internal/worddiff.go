@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+	wordToken  = regexp.MustCompile(`\n|[ \t]+|[^ \t\n]+`)
+)
+
+// maxWordDiffTokens bounds the size of the token matrix computed for
+// a single block of changed lines. Larger blocks are marked line by
+// line instead.
+const maxWordDiffTokens = 1 << 20
+
+// WordDiff rewrites the hunks of a unified diff to mark changes at
+// word granularity, using the format of `git diff --word-diff=plain`:
+// removed words are wrapped in "[-" and "-]" and added words in "{+"
+// and "+}", and lines no longer have a " ", "-", or "+" prefix. File
+// headers, hunk headers, and "Binary files differ" notices are left
+// as is.
+func WordDiff(unified []byte) []byte {
+	var out bytes.Buffer
+	var oldText, newText bytes.Buffer
+	flush := func() {
+		writeWordDiff(&out, oldText.String(), newText.String())
+		oldText.Reset()
+		newText.Reset()
+	}
+
+	origLeft, newLeft := 0, 0 // lines remaining in the current hunk
+	s := bufio.NewScanner(bytes.NewReader(unified))
+	s.Buffer(nil, len(unified)+1)
+	for s.Scan() {
+		line := s.Text()
+		if origLeft <= 0 && newLeft <= 0 {
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				origLeft, newLeft = hunkLen(m[1]), hunkLen(m[2])
+			}
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "-"):
+			oldText.WriteString(line[1:] + "\n")
+			origLeft--
+		case strings.HasPrefix(line, "+"):
+			newText.WriteString(line[1:] + "\n")
+			newLeft--
+		case strings.HasPrefix(line, `\`):
+			flush()
+			out.WriteString(line + "\n")
+		default:
+			flush()
+			out.WriteString(strings.TrimPrefix(line, " ") + "\n")
+			origLeft--
+			newLeft--
+		}
+		if origLeft <= 0 && newLeft <= 0 {
+			flush()
+		}
+	}
+	flush()
+	return out.Bytes()
+}
+
+func hunkLen(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// writeWordDiff writes the word-level changes between a block of
+// removed lines and the block of added lines that replaced it.
+func writeWordDiff(out *bytes.Buffer, oldText, newText string) {
+	a := wordToken.FindAllString(oldText, -1)
+	b := wordToken.FindAllString(newText, -1)
+	if len(a) == 0 || len(b) == 0 || len(a)*len(b) > maxWordDiffTokens {
+		writeMarked(out, "[-", "-]", a)
+		writeMarked(out, "{+", "+}", b)
+		return
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var del, ins []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			writeMarked(out, "[-", "-]", del)
+			writeMarked(out, "{+", "+}", ins)
+			del, ins = del[:0], ins[:0]
+			out.WriteString(a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			del = append(del, a[i])
+			i++
+		default:
+			ins = append(ins, b[j])
+			j++
+		}
+	}
+	writeMarked(out, "[-", "-]", del)
+	writeMarked(out, "{+", "+}", ins)
+}
+
+// writeMarked writes toks wrapped in the open and close markers. The
+// markers never span a newline; each line's portion is wrapped
+// separately.
+func writeMarked(out *bytes.Buffer, open, close string, toks []string) {
+	var seg bytes.Buffer
+	end := func() {
+		if seg.Len() > 0 {
+			out.WriteString(open)
+			out.Write(seg.Bytes())
+			out.WriteString(close)
+			seg.Reset()
+		}
+	}
+	for _, tok := range toks {
+		if tok == "\n" {
+			end()
+			out.WriteString("\n")
+			continue
+		}
+		seg.WriteString(tok)
+	}
+	end()
+}
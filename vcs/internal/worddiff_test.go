@@ -0,0 +1,37 @@
+package internal
+
+import "testing"
+
+func TestWordDiff(t *testing.T) {
+	tests := map[string]struct {
+		diff, want string
+	}{
+		"changed word": {
+			diff: "diff --git f f\n--- f\n+++ f\n@@ -1,2 +1,2 @@\n a b\n-foo bar qux\n+foo baz qux\n",
+			want: "diff --git f f\n--- f\n+++ f\n@@ -1,2 +1,2 @@\na b\nfoo [-bar-]{+baz+} qux\n",
+		},
+		"added and removed lines": {
+			diff: "--- f\n+++ f\n@@ -1,2 +1,2 @@\n-x\n a\n+y z\n",
+			want: "--- f\n+++ f\n@@ -1,2 +1,2 @@\n[-x-]\na\n{+y z+}\n",
+		},
+		"multiple files": {
+			diff: "--- f\n+++ f\n@@ -1 +1 @@\n-a\n+b\n--- g\n+++ g\n@@ -1 +1 @@\n-c d\n+c e\n",
+			want: "--- f\n+++ f\n@@ -1 +1 @@\n[-a-]{+b+}\n--- g\n+++ g\n@@ -1 +1 @@\nc [-d-]{+e+}\n",
+		},
+		// hg's diffs, whose ranges always have line counts, with a new
+		// file.
+		"hg new file": {
+			diff: "diff --git a a\nnew file mode 100644\n--- /dev/null\n+++ a\n@@ -0,0 +1,1 @@\n+x y\ndiff --git f f\n--- f\n+++ f\n@@ -1,1 +1,2 @@\n line1\n+line2\n",
+			want: "diff --git a a\nnew file mode 100644\n--- /dev/null\n+++ a\n@@ -0,0 +1,1 @@\n{+x y+}\ndiff --git f f\n--- f\n+++ f\n@@ -1,1 +1,2 @@\nline1\n{+line2+}\n",
+		},
+		"binary": {
+			diff: "diff --git f f\nBinary files f and f differ\n",
+			want: "diff --git f f\nBinary files f and f differ\n",
+		},
+	}
+	for label, test := range tests {
+		if got := string(WordDiff([]byte(test.diff))); got != test.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", label, got, test.want)
+		}
+	}
+}
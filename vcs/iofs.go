@@ -0,0 +1,142 @@
+//go:build go1.16
+// +build go1.16
+
+package vcs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// AsFS returns an io/fs file system (which also implements
+// fs.ReadDirFS and fs.StatFS) that reads from fsys, such as a
+// repository's FileSystem, so that it can be used with the standard
+// library's io/fs-based APIs (e.g., http.FS and template.ParseFS).
+// Directories opened with its Open method implement fs.ReadDirFile.
+// Errors satisfying os.IsNotExist are reported as *fs.PathErrors
+// wrapping fs.ErrNotExist.
+func AsFS(fsys vfs.FileSystem) fs.FS {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fs vfs.FileSystem
+}
+
+var (
+	_ fs.ReadDirFS = ioFS{}
+	_ fs.StatFS    = ioFS{}
+)
+
+func (f ioFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fi, err := f.fs.Stat(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if fi.IsDir() {
+		return &ioDir{fs: f, name: name, fi: fi}, nil
+	}
+	rc, err := f.fs.Open(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &ioFile{ReadSeekCloser: rc, fi: fi}, nil
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	fi, err := f.fs.Stat(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return fi, nil
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	fis, err := f.fs.ReadDir(name)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, len(fis))
+	for i, fi := range fis {
+		entries[i] = fs.FileInfoToDirEntry(fi)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// pathError returns err as an *fs.PathError for the operation op on
+// name, with errors satisfying os.IsNotExist mapped to
+// fs.ErrNotExist.
+func pathError(op, name string, err error) error {
+	if os.IsNotExist(err) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if _, ok := err.(*fs.PathError); ok {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// An ioFile is a file opened by an ioFS.
+type ioFile struct {
+	vfs.ReadSeekCloser
+	fi fs.FileInfo
+}
+
+func (f *ioFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+
+// An ioDir is a directory opened by an ioFS.
+type ioDir struct {
+	fs      ioFS
+	name    string
+	fi      fs.FileInfo
+	entries []fs.DirEntry // nil until the first ReadDir call
+	offset  int
+}
+
+var errIsDir = errors.New("is a directory")
+
+func (d *ioDir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+func (d *ioDir) Close() error               { return nil }
+
+func (d *ioDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDir}
+}
+
+func (d *ioDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = append([]fs.DirEntry{}, entries...)
+	}
+
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
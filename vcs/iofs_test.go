@@ -0,0 +1,32 @@
+//go:build go1.16
+// +build go1.16
+
+package vcs_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/tools/godoc/vfs/mapfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestAsFS(t *testing.T) {
+	fsys := vcs.AsFS(mapfs.New(map[string]string{
+		"a":     "a",
+		"b/c":   "bc",
+		"b/d/e": "bde",
+	}))
+	if err := fstest.TestFS(fsys, "a", "b/c", "b/d/e"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := fs.Stat(fsys, "nonexistent"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(nonexistent): got error %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fsys.Open("/a"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(/a): got error %v, want fs.ErrInvalid", err)
+	}
+}
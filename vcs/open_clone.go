@@ -1,6 +1,11 @@
 package vcs
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
 
 // An Opener is a function that opens a repository rooted at dir in the
 // filesystem. An Opener should fail if there exists no repository rooted at
@@ -49,6 +54,46 @@ func Open(vcs, dir string) (Repository, error) {
 	return opener(dir)
 }
 
+// ErrNotARepository is returned by DetectVCS and OpenRepository when
+// a directory isn't the root of a repository of any known VCS type.
+// Openers may also return it (or an error wrapping it) when a
+// directory isn't a repository of their VCS type.
+var ErrNotARepository = errors.New("not a repository")
+
+// DetectVCS returns the VCS type ("git" or "hg") of the repository
+// rooted at dir, by looking for a .git directory (or a .git file, as
+// used by git worktrees and submodules) or a .hg directory. A bare git
+// repository is detected by its HEAD file and objects directory. If
+// dir has both .git and .hg (e.g., a working copy that is used with
+// both VCSs), "git" takes precedence. If no repository is found,
+// ErrNotARepository is returned.
+func DetectVCS(dir string) (string, error) {
+	exists := func(name string, wantDir bool) bool {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		return err == nil && fi.IsDir() == wantDir
+	}
+	switch {
+	case exists(".git", true), exists(".git", false):
+		return "git", nil
+	case exists(".hg", true):
+		return "hg", nil
+	case exists("HEAD", false) && exists("objects", true):
+		return "git", nil
+	}
+	return "", ErrNotARepository
+}
+
+// OpenRepository opens the repository rooted at dir, whose VCS type
+// is detected by DetectVCS. As with Open, an opener for its VCS must
+// be registered.
+func OpenRepository(dir string) (Repository, error) {
+	vcs, err := DetectVCS(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Open(vcs, dir)
+}
+
 // A cloner is a function that clones a repository from a URL to dir
 // in the filesystem.
 type Cloner func(url, dir string, opt CloneOpt) (Repository, error)
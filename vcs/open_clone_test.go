@@ -0,0 +1,54 @@
+package vcs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestDetectVCS(t *testing.T) {
+	tests := map[string]struct {
+		dirs, files []string
+		want        string
+		wantErr     error
+	}{
+		"git":            {dirs: []string{".git"}, want: "git"},
+		"git worktree":   {files: []string{".git"}, want: "git"},
+		"hg":             {dirs: []string{".hg"}, want: "hg"},
+		"git and hg":     {dirs: []string{".git", ".hg"}, want: "git"},
+		"bare git":       {dirs: []string{"objects"}, files: []string{"HEAD"}, want: "git"},
+		"empty":          {wantErr: vcs.ErrNotARepository},
+		"hg file":        {files: []string{".hg"}, wantErr: vcs.ErrNotARepository},
+		"HEAD only":      {files: []string{"HEAD"}, wantErr: vcs.ErrNotARepository},
+		"objects only":   {dirs: []string{"objects"}, wantErr: vcs.ErrNotARepository},
+		"unrelated file": {files: []string{"README"}, wantErr: vcs.ErrNotARepository},
+	}
+	for label, test := range tests {
+		dir, err := ioutil.TempDir("", "go-vcs-detect")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for _, d := range test.dirs {
+			if err := os.Mkdir(filepath.Join(dir, d), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, f := range test.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := vcs.DetectVCS(dir)
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("%s: got VCS %q, want %q", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package vcs
+
+import (
+	"io"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// A ProgressFunc is called periodically during a long-running read
+// (such as reading a large file or writing an archive) with the total
+// number of bytes processed so far.
+type ProgressFunc func(bytesDone int64)
+
+// ProgressInterval is the number of bytes processed between calls to
+// a ProgressFunc.
+const ProgressInterval = 1 << 20 // 1 MB
+
+// WithProgress wraps f so that progress is reported to fn as f is
+// read. The fn is called each time another ProgressInterval bytes
+// have been read, and once more when the end of the file is reached.
+// If fn is nil, f is returned unchanged.
+//
+// It is typically used on the files returned by a repository
+// FileSystem's Open method:
+//
+//	f, err := fs.Open(name)
+//	...
+//	f = vcs.WithProgress(f, func(n int64) { bar.Set(n) })
+func WithProgress(f vfs.ReadSeekCloser, fn ProgressFunc) vfs.ReadSeekCloser {
+	if fn == nil {
+		return f
+	}
+	return &progressReader{ReadSeekCloser: f, fn: fn}
+}
+
+type progressReader struct {
+	vfs.ReadSeekCloser
+	fn           ProgressFunc
+	done         int64 // bytes read so far
+	lastReported int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.done += int64(n)
+	if r.done-r.lastReported >= ProgressInterval || (err == io.EOF && r.done != r.lastReported) {
+		r.lastReported = r.done
+		r.fn(r.done)
+	}
+	return n, err
+}
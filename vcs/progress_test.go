@@ -0,0 +1,46 @@
+package vcs_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/util"
+)
+
+func TestWithProgress(t *testing.T) {
+	tests := map[string]struct {
+		size int
+		want []int64
+	}{
+		"empty":             {size: 0, want: nil},
+		"smaller than step": {size: 10, want: []int64{10}},
+		"exactly one step":  {size: vcs.ProgressInterval, want: []int64{vcs.ProgressInterval}},
+		"several steps": {
+			size: 2*vcs.ProgressInterval + 10,
+			want: []int64{vcs.ProgressInterval, 2 * vcs.ProgressInterval, 2*vcs.ProgressInterval + 10},
+		},
+	}
+	for label, test := range tests {
+		var got []int64
+		f := vcs.WithProgress(util.NopCloser{bytes.NewReader(make([]byte, test.size))}, func(n int64) {
+			got = append(got, n)
+		})
+		// Read in chunks that evenly divide ProgressInterval so that
+		// the reported byte counts are deterministic.
+		n, err := io.CopyBuffer(struct{ io.Writer }{ioutil.Discard}, f, make([]byte, 4096))
+		if err != nil {
+			t.Errorf("%s: Copy: %s", label, err)
+			continue
+		}
+		if n != int64(test.size) {
+			t.Errorf("%s: got %d bytes, want %d", label, n, test.size)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got progress %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package vcs
+
+// A RefKind describes what kind of ref a revision specifier matched
+// when it was resolved.
+type RefKind string
+
+const (
+	RefKindBranch   RefKind = "branch"   // a branch name
+	RefKindTag      RefKind = "tag"      // a tag name
+	RefKindBookmark RefKind = "bookmark" // an hg bookmark name
+	RefKindCommit   RefKind = "commit"   // a commit ID (or other revision spec that isn't a ref)
+
+	// RefKindDetached describes a commit that is neither a branch
+	// head nor tagged.
+	RefKindDetached RefKind = "detached"
+)
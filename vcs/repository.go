@@ -2,6 +2,8 @@ package vcs
 
 import (
 	"errors"
+	"io"
+	"os"
 
 	"golang.org/x/tools/godoc/vfs"
 )
@@ -101,9 +103,39 @@ type CrossRepoDiffer interface {
 	CrossRepoDiff(base CommitID, headRepo Repository, head CommitID, opt *DiffOptions) (*Diff, error)
 }
 
+// An Archiver is a repository that can write an archive of the files
+// at a commit without checking it out.
+type Archiver interface {
+	// Archive writes an archive of the files at the commit to w. If
+	// the commit doesn't exist, an error is returned.
+	Archive(at CommitID, w io.Writer, opt *ArchiveOptions) error
+}
+
+// ArchiveOptions configures an archive. A nil *ArchiveOptions is
+// the same as the zero value.
+type ArchiveOptions struct {
+	Format ArchiveFormat // the file format of the archive ("" means ArchiveTar)
+
+	// Progress, if non-nil, is called with the number of bytes
+	// written to the archive so far, each time another
+	// ProgressInterval bytes have been written and once more when
+	// the archive is complete.
+	Progress ProgressFunc
+}
+
+// An ArchiveFormat is the file format of an archive written by an
+// Archiver.
+type ArchiveFormat string
+
+const (
+	ArchiveTar ArchiveFormat = "tar" // an uncompressed tarball
+	ArchiveZip ArchiveFormat = "zip"
+)
+
 var (
 	ErrRefNotFound      = errors.New("ref not found")
 	ErrBranchNotFound   = errors.New("branch not found")
+	ErrBookmarkNotFound = errors.New("bookmark not found")
 	ErrCommitNotFound   = errors.New("commit not found")
 	ErrRevisionNotFound = errors.New("revision not found")
 	ErrTagNotFound      = errors.New("tag not found")
@@ -122,6 +154,13 @@ func (c *CommitID) Unmarshal(data []byte) error {
 	return nil
 }
 
+// IsMerge reports whether the commit is a merge commit (i.e., it has
+// more than one parent). Root commits, which have no parents, aren't
+// merges.
+func (c *Commit) IsMerge() bool {
+	return len(c.Parents) > 1
+}
+
 // CommitsOptions specifies limits on the list of commits returned by
 // (Repository).Commits.
 type CommitsOptions struct {
@@ -149,8 +188,15 @@ type DiffOptions struct {
 	Paths                 []string // constrain diff to these pathspecs
 	DetectRenames         bool
 	OrigPrefix, NewPrefix string // prefixes for orig and new filenames (e.g., "a/", "b/")
+	ContextLines          int    // lines of context around each change (0 means the default, 3)
 
 	ExcludeReachableFromBoth bool // like "<rev1>...<rev2>" (see `git rev-parse --help`)
+
+	// WordDiff marks changes within lines at word granularity (like
+	// `git diff --word-diff=plain`): removed words are wrapped in
+	// "[-" and "-]" and added words in "{+" and "+}". Binary files
+	// are unaffected.
+	WordDiff bool
 }
 
 // A Diff represents changes between two commits.
@@ -158,6 +204,25 @@ type Diff struct {
 	Raw string // the raw diff output
 }
 
+// A FileChange describes how a single file was changed by a commit.
+type FileChange struct {
+	Path   string     // the file's path (its new path, if it was renamed)
+	Status FileStatus // how the file was changed
+
+	// Diff is the file's diff, if it was requested (e.g., by
+	// CommitDiffFunc).
+	Diff *Diff
+}
+
+// A FileStatus describes how a file was changed by a commit.
+type FileStatus string
+
+const (
+	FileAdded    FileStatus = "added"
+	FileModified FileStatus = "modified"
+	FileRemoved  FileStatus = "removed"
+)
+
 type Branches []*Branch
 
 func (p Branches) Len() int           { return len(p) }
@@ -188,3 +253,52 @@ type FileLister interface {
 	// alphabetically. E.g., returned paths have the form "path/to/file.txt".
 	ListFiles(CommitID) ([]string, error)
 }
+
+// A SymlinkReader is a FileSystem (as returned by a repository's
+// FileSystem method) that can read the targets of symlinks.
+type SymlinkReader interface {
+	// ReadLink returns the target of the symlink at name, without
+	// following it. If name isn't a symlink, an *os.PathError
+	// wrapping ErrNotSymlink is returned.
+	ReadLink(name string) (string, error)
+}
+
+// A Globber is a FileSystem (as returned by a repository's FileSystem
+// method) that can list the files whose paths match a pattern without
+// walking its directories.
+type Globber interface {
+	// Glob returns the paths (relative to the root, with "/"
+	// separators, and sorted) of the files whose full paths match
+	// pattern. Each element of pattern is matched against one path
+	// element using the syntax of path.Match, except that an element
+	// that is exactly "**" matches zero or more path elements (so
+	// "**/*.go" matches every .go file). Directories themselves aren't
+	// returned. If pattern is malformed, path.ErrBadPattern is
+	// returned.
+	Glob(pattern string) ([]string, error)
+}
+
+// A ModeReader is a FileSystem (as returned by a repository's
+// FileSystem method) that can report a file's mode (e.g., whether it
+// is executable or a symlink) without reading the file.
+type ModeReader interface {
+	// Mode returns the mode of the file or directory at name, as
+	// Lstat would report it. If name doesn't exist, os.ErrNotExist is
+	// returned.
+	Mode(name string) (os.FileMode, error)
+}
+
+// An ExistsChecker is a FileSystem (as returned by a repository's
+// FileSystem method) that can report whether a path exists without
+// reading any file's contents.
+type ExistsChecker interface {
+	// Exists reports whether a file or directory exists at name, as
+	// Lstat would find it (so a symlink exists even if its target
+	// doesn't). If name doesn't exist, it returns false and a nil
+	// error; an error is returned only if the check itself failed.
+	Exists(name string) (bool, error)
+}
+
+// ErrNotSymlink is returned by ReadLink when the path isn't a
+// symlink.
+var ErrNotSymlink = errors.New("not a symlink")
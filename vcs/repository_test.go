@@ -804,10 +804,11 @@ func TestRepository_GetCommit(t *testing.T) {
 		"hg commit -m bar --date '2006-12-06 13:18:30 UTC' --user 'a <a@a.com>'",
 	}
 	wantHgCommit := &vcs.Commit{
-		ID:      "c6320cdba5ebc6933bd7c94751dcd633d6aa0759",
-		Author:  vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
-		Message: "bar",
-		Parents: []vcs.CommitID{"e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf"},
+		ID:        "c6320cdba5ebc6933bd7c94751dcd633d6aa0759",
+		Author:    vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
+		Committer: &vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
+		Message:   "bar",
+		Parents:   []vcs.CommitID{"e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf"},
 	}
 	tests := map[string]struct {
 		repo interface {
@@ -863,8 +864,6 @@ func TestRepository_GetCommit(t *testing.T) {
 func TestRepository_Commits(t *testing.T) {
 	t.Parallel()
 
-	// TODO(sqs): test CommitsOptions.Base
-
 	gitCommands := []string{
 		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
 		"GIT_COMMITTER_NAME=c GIT_COMMITTER_EMAIL=c@c.com GIT_COMMITTER_DATE=2006-01-02T15:04:07Z git commit --allow-empty -m bar --author='a <a@a.com>' --date 2006-01-02T15:04:06Z",
@@ -895,16 +894,18 @@ func TestRepository_Commits(t *testing.T) {
 	}
 	wantHgCommits := []*vcs.Commit{
 		{
-			ID:      "c6320cdba5ebc6933bd7c94751dcd633d6aa0759",
-			Author:  vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
-			Message: "bar",
-			Parents: []vcs.CommitID{"e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf"},
+			ID:        "c6320cdba5ebc6933bd7c94751dcd633d6aa0759",
+			Author:    vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
+			Committer: &vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
+			Message:   "bar",
+			Parents:   []vcs.CommitID{"e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf"},
 		},
 		{
-			ID:      "e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf",
-			Author:  vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:29Z")},
-			Message: "foo",
-			Parents: nil,
+			ID:        "e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf",
+			Author:    vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:29Z")},
+			Committer: &vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:29Z")},
+			Message:   "foo",
+			Parents:   nil,
 		},
 	}
 	tests := map[string]struct {
@@ -1026,10 +1027,11 @@ func TestRepository_Commits_options(t *testing.T) {
 	}
 	wantHgCommits := []*vcs.Commit{
 		{
-			ID:      "c6320cdba5ebc6933bd7c94751dcd633d6aa0759",
-			Author:  vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
-			Message: "bar",
-			Parents: []vcs.CommitID{"e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf"},
+			ID:        "c6320cdba5ebc6933bd7c94751dcd633d6aa0759",
+			Author:    vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
+			Committer: &vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, "2006-12-06T13:18:30Z")},
+			Message:   "bar",
+			Parents:   []vcs.CommitID{"e8e11ff1be92a7be71b9b5cdb4cc674b7dc9facf"},
 		},
 	}
 	tests := map[string]struct {
@@ -1136,6 +1138,134 @@ func TestRepository_Commits_options(t *testing.T) {
 	}
 }
 
+func TestRepository_Commits_merge(t *testing.T) {
+	t.Parallel()
+
+	gitCommands := []string{
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m root --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:06Z git commit --allow-empty -m main --author='a <a@a.com>' --date 2006-01-02T15:04:06Z",
+		"git checkout -q -b side HEAD~1",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:07Z git commit --allow-empty -m side --author='a <a@a.com>' --date 2006-01-02T15:04:07Z",
+		"git checkout -q -",
+		"GIT_AUTHOR_NAME=a GIT_AUTHOR_EMAIL=a@a.com GIT_AUTHOR_DATE=2006-01-02T15:04:08Z GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:08Z git merge -q --no-ff side -m merge",
+	}
+	const (
+		root  = "27cee561a08eb93d2345a662dd4ea852017723b8"
+		main  = "2068fa633c2531ce1a52f76a9ceb567f0b870729"
+		side  = "bd61f2515ef5dcd0553044cfbcd9e839f141400e"
+		merge = "42eabd0755b1353da87b4dfc881ae91900d21d4f"
+	)
+	commit := func(id vcs.CommitID, msg, date string, parents ...vcs.CommitID) *vcs.Commit {
+		if len(parents) == 0 {
+			parents = nil
+		}
+		return &vcs.Commit{
+			ID:        id,
+			Author:    vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, date)},
+			Committer: &vcs.Signature{"a", "a@a.com", mustParseTime(time.RFC3339, date)},
+			Message:   msg,
+			Parents:   parents,
+		}
+	}
+	var (
+		rootCommit  = commit(root, "root", "2006-01-02T15:04:05Z")
+		mainCommit  = commit(main, "main", "2006-01-02T15:04:06Z", root)
+		sideCommit  = commit(side, "side", "2006-01-02T15:04:07Z", root)
+		mergeCommit = commit(merge, "merge", "2006-01-02T15:04:08Z", main, side)
+	)
+	tests := map[string]struct {
+		opt         vcs.CommitsOptions
+		wantCommits []*vcs.Commit
+		wantTotal   uint
+	}{
+		"all": {
+			opt:         vcs.CommitsOptions{Head: merge},
+			wantCommits: []*vcs.Commit{mergeCommit, sideCommit, mainCommit, rootCommit},
+			wantTotal:   4,
+		},
+		"Base is first parent": {
+			// root is reachable from both sides of the merge, but
+			// it's hidden because it's reachable from Base.
+			opt:         vcs.CommitsOptions{Head: merge, Base: main},
+			wantCommits: []*vcs.Commit{mergeCommit, sideCommit},
+			wantTotal:   2,
+		},
+		"Base is second parent": {
+			opt:         vcs.CommitsOptions{Head: merge, Base: side},
+			wantCommits: []*vcs.Commit{mergeCommit, mainCommit},
+			wantTotal:   2,
+		},
+		"Base is Head": {
+			opt:         vcs.CommitsOptions{Head: merge, Base: merge},
+			wantCommits: nil,
+			wantTotal:   0,
+		},
+		"Base..Head with N and Skip": {
+			opt:         vcs.CommitsOptions{Head: merge, Base: root, N: 1, Skip: 1},
+			wantCommits: []*vcs.Commit{sideCommit},
+			wantTotal:   3,
+		},
+		"NoTotal": {
+			opt:         vcs.CommitsOptions{Head: merge, N: 2, NoTotal: true},
+			wantCommits: []*vcs.Commit{mergeCommit, sideCommit},
+			wantTotal:   0,
+		},
+		"Skip past the end": {
+			opt:         vcs.CommitsOptions{Head: merge, Skip: 4},
+			wantCommits: nil,
+			wantTotal:   4,
+		},
+		"Head is not a commit ID": {
+			opt:         vcs.CommitsOptions{Head: "HEAD", Base: main},
+			wantCommits: []*vcs.Commit{mergeCommit, sideCommit},
+			wantTotal:   2,
+		},
+		"Base is not a commit ID": {
+			opt:         vcs.CommitsOptions{Head: merge, Base: "side"},
+			wantCommits: []*vcs.Commit{mergeCommit, mainCommit},
+			wantTotal:   2,
+		},
+	}
+	repos := map[string]interface {
+		Commits(opt vcs.CommitsOptions) ([]*vcs.Commit, uint, error)
+	}{
+		"git cmd":    makeGitRepositoryCmd(t, gitCommands...),
+		"git go-git": makeGitRepositoryGoGit(t, gitCommands...),
+	}
+
+	for repoLabel, repo := range repos {
+		for label, test := range tests {
+			label = repoLabel + " " + label
+			commits, total, err := repo.Commits(test.opt)
+			if err != nil {
+				t.Errorf("%s: Commits(): %s", label, err)
+				continue
+			}
+
+			if total != test.wantTotal {
+				t.Errorf("%s: got %d total commits, want %d", label, total, test.wantTotal)
+			}
+
+			if len(commits) != len(test.wantCommits) {
+				t.Errorf("%s: got %d commits, want %d", label, len(commits), len(test.wantCommits))
+			}
+
+			for i := 0; i < len(commits) || i < len(test.wantCommits); i++ {
+				var gotC, wantC *vcs.Commit
+				if i < len(commits) {
+					gotC = commits[i]
+				}
+				if i < len(test.wantCommits) {
+					wantC = test.wantCommits[i]
+				}
+				if !commitsEqual(gotC, wantC) {
+					t.Errorf("%s: got commit %d == %+v, want %+v", label, i, gotC, wantC)
+				}
+			}
+		}
+	}
+}
+
 func TestRepository_Commits_options_path(t *testing.T) {
 	t.Parallel()
 
@@ -1182,6 +1312,24 @@ func TestRepository_Commits_options_path(t *testing.T) {
 			wantCommits: wantGitCommits,
 			wantTotal:   1,
 		},
+		"git go-git Path 0": {
+			repo: makeGitRepositoryGoGit(t, gitCommands...),
+			opt: vcs.CommitsOptions{
+				Head: "master",
+				Path: "doesnt-exist",
+			},
+			wantCommits: nil,
+			wantTotal:   0,
+		},
+		"git go-git Path 1": {
+			repo: makeGitRepositoryGoGit(t, gitCommands...),
+			opt: vcs.CommitsOptions{
+				Head: "master",
+				Path: "file1",
+			},
+			wantCommits: wantGitCommits,
+			wantTotal:   1,
+		},
 	}
 
 	for label, test := range tests {
@@ -1366,6 +1514,152 @@ func TestRepository_FileSystem_Symlinks(t *testing.T) {
 	}
 }
 
+func TestRepository_FileSystem_ReadDirModes(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks and executable bits are not supported on Windows")
+	}
+
+	// The repository has a regular file, an executable file, a symlink,
+	// and a file in a subdirectory. (The hg native FileSystem's modes
+	// are tested in the hg package.)
+	gitCommands := []string{
+		"echo -n a > file1",
+		"echo -n b > exec1",
+		"chmod +x exec1",
+		"ln -s file1 link1",
+		"mkdir dir1",
+		"echo -n c > dir1/file2",
+		"git add file1 exec1 link1 dir1/file2",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	}
+	tests := map[string]struct {
+		repo interface {
+			ResolveRevision(spec string) (vcs.CommitID, error)
+			FileSystem(vcs.CommitID) (vfs.FileSystem, error)
+		}
+		spec string
+	}{
+		"git cmd": {
+			repo: makeGitRepositoryCmd(t, gitCommands...),
+			spec: "master",
+		},
+		"git go-git": {
+			repo: makeGitRepositoryGoGit(t, gitCommands...),
+			spec: "master",
+		},
+	}
+	for label, test := range tests {
+		commitID, err := test.repo.ResolveRevision(test.spec)
+		if err != nil {
+			t.Errorf("%s: ResolveRevision: %s", label, err)
+			continue
+		}
+		fs, err := test.repo.FileSystem(commitID)
+		if err != nil {
+			t.Errorf("%s: FileSystem: %s", label, err)
+			continue
+		}
+
+		entries, err := fs.ReadDir(".")
+		if err != nil {
+			t.Errorf("%s: fs.ReadDir(.): %s", label, err)
+			continue
+		}
+		modes := make(map[string]os.FileMode, len(entries))
+		for _, e := range entries {
+			modes[e.Name()] = e.Mode()
+		}
+		if got, want := len(modes), 4; got != want {
+			t.Errorf("%s: got %d entries (%v), want %d", label, got, modes, want)
+			continue
+		}
+
+		if mode := modes["file1"]; !mode.IsRegular() || mode&0111 != 0 {
+			t.Errorf("%s: file1: got mode %o, want regular non-executable file", label, mode)
+		}
+		if mode := modes["exec1"]; !mode.IsRegular() || mode&0111 == 0 {
+			t.Errorf("%s: exec1: got mode %o, want regular executable file", label, mode)
+		}
+		if mode := modes["link1"]; mode&os.ModeSymlink == 0 {
+			t.Errorf("%s: link1: got mode %o, want symlink", label, mode)
+		}
+		if mode := modes["dir1"]; !mode.IsDir() {
+			t.Errorf("%s: dir1: got mode %o, want dir", label, mode)
+		}
+	}
+}
+
+func TestRepository_FileSystem_ReadDirSymlinkedDir(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not supported on Windows")
+	}
+
+	// The repository has a directory (dir1) and a symlink to it
+	// (link1). (The hg native FileSystem, which can also follow
+	// symlinks, is tested in the hg package.)
+	gitCommands := []string{
+		"mkdir dir1",
+		"echo -n a > dir1/file1",
+		"ln -s dir1 link1",
+		"git add dir1/file1 link1",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	}
+	tests := map[string]struct {
+		repo interface {
+			ResolveRevision(spec string) (vcs.CommitID, error)
+			FileSystem(vcs.CommitID) (vfs.FileSystem, error)
+		}
+		spec     string
+		wantMode os.FileMode // of link1
+	}{
+		"git cmd": {
+			repo:     makeGitRepositoryCmd(t, gitCommands...),
+			spec:     "master",
+			wantMode: os.ModeSymlink,
+		},
+	}
+	for label, test := range tests {
+		commitID, err := test.repo.ResolveRevision(test.spec)
+		if err != nil {
+			t.Errorf("%s: ResolveRevision: %s", label, err)
+			continue
+		}
+		fs, err := test.repo.FileSystem(commitID)
+		if err != nil {
+			t.Errorf("%s: FileSystem: %s", label, err)
+			continue
+		}
+
+		entries, err := fs.ReadDir(".")
+		if err != nil {
+			t.Errorf("%s: fs.ReadDir(.): %s", label, err)
+			continue
+		}
+		if got, want := len(entries), 2; got != want {
+			t.Errorf("%s: got %d entries, want %d", label, got, want)
+			continue
+		}
+		for _, e := range entries {
+			switch e.Name() {
+			case "dir1":
+				if !e.Mode().IsDir() {
+					t.Errorf("%s: dir1: got mode %o, want dir", label, e.Mode())
+				}
+			case "link1":
+				if got := e.Mode() & os.ModeType; got != test.wantMode {
+					t.Errorf("%s: link1: got mode type %o, want %o", label, got, test.wantMode)
+				}
+			default:
+				t.Errorf("%s: unexpected entry %q", label, e.Name())
+			}
+		}
+	}
+}
+
 func TestRepository_FileSystem(t *testing.T) {
 	t.Parallel()
 
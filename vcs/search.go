@@ -11,5 +11,11 @@ const (
 	// indicates the query is a fixed string, not a regex.
 	FixedQuery = "fixed"
 
-	// TODO(sqs): allow regexp searches, extended regexp searches, etc.
+	// RegexpQuery is a value for SearchOptions.QueryType that
+	// indicates the query is a regular expression, which is matched
+	// against each line. Implementations use their own regexp syntax
+	// (Go's regexp package for native searches, and POSIX extended
+	// regular expressions for those that run `git grep`), so queries
+	// should stick to the common subset.
+	RegexpQuery = "regexp"
 )
@@ -81,6 +81,44 @@ func TestRepository_Search(t *testing.T) {
 	testGitRepositorySearch(t, gitCommands, searchOpt, wantRes)
 }
 
+func TestRepository_Search_RegexpAndPaths(t *testing.T) {
+	t.Parallel()
+
+	searchOpt := vcs.SearchOptions{
+		Query:       "x[yz]+",
+		QueryType:   vcs.RegexpQuery,
+		PathInclude: []string{"**/*.txt"},
+		PathExclude: []string{"vendor/**"},
+	}
+	wantRes := []*vcs.SearchResult{
+		{
+			File:      "d/f2.txt",
+			StartLine: 1,
+			EndLine:   1,
+			Match:     []byte("xzz"),
+		},
+		{
+			File:      "f1.txt",
+			StartLine: 2,
+			EndLine:   2,
+			Match:     []byte("xyz"),
+		},
+	}
+
+	gitCommands := []string{
+		"mkdir d vendor",
+		"echo abc > f1.txt",
+		"echo xyz >> f1.txt",
+		"echo xzz > d/f2.txt",
+		"echo xyz > f3.go",
+		"echo xyz > vendor/f4.txt",
+		"git add f1.txt d/f2.txt f3.go vendor/f4.txt",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	}
+
+	testGitRepositorySearch(t, gitCommands, searchOpt, wantRes)
+}
+
 // testGitRepositorySearch is a helper that tests repository search
 // over a git repository specified by the initializtion in
 // repoInitCommands
@@ -36,12 +36,30 @@ var _ = fmt.Errorf
 var _ = math.Inf
 
 type Commit struct {
-	ID        CommitID   `protobuf:"bytes,1,opt,name=ID,proto3,customtype=CommitID" json:"ID,omitempty"`
-	Author    Signature  `protobuf:"bytes,2,opt,name=Author" json:"Author"`
+	ID     CommitID  `protobuf:"bytes,1,opt,name=ID,proto3,customtype=CommitID" json:"ID,omitempty"`
+	Author Signature `protobuf:"bytes,2,opt,name=Author" json:"Author"`
+	// Committer is the person who committed the change, which may
+	// differ from Author (e.g., for a cherry-picked or rebased git
+	// commit). Mercurial records only a single user per changeset, so
+	// hg repositories set Committer to a copy of Author, unless the
+	// changeset was converted from git and kept its git committer.
 	Committer *Signature `protobuf:"bytes,3,opt,name=Committer" json:"Committer,omitempty"`
 	Message   string     `protobuf:"bytes,4,opt,name=Message,proto3" json:"Message,omitempty"`
 	// Parents are the commit IDs of this commit's parent commits.
 	Parents []CommitID `protobuf:"bytes,5,rep,name=Parents,customtype=CommitID" json:"Parents,omitempty"`
+	// FirstParent is the commit ID of this commit's first parent. It
+	// is only set by repositories that reorder Parents (e.g., to sort
+	// them canonically), in which case Parents[0] might not be the
+	// first parent.
+	FirstParent CommitID `protobuf:"bytes,6,opt,name=FirstParent,proto3,customtype=CommitID" json:"FirstParent,omitempty"`
+	// Branch is the name of the branch that the commit was made on,
+	// for VCSs that record it in the commit (e.g., hg's named
+	// branches). It is empty for other VCSs (e.g., git).
+	Branch string `protobuf:"bytes,7,opt,name=Branch,proto3" json:"Branch,omitempty"`
+	// Extra is the VCS-specific metadata recorded in the commit, if
+	// any (e.g., an hg changeset's extra fields, such as "branch" and
+	// "close").
+	Extra map[string]string `protobuf:"bytes,8,rep,name=Extra" json:"Extra,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (m *Commit) Reset()         { *m = Commit{} }
@@ -69,6 +87,10 @@ type Branch struct {
 	Commit *Commit `protobuf:"bytes,4,opt,name=Commit" json:"Commit,omitempty"`
 	// Counts optionally contains the commit counts relative to specified branch.
 	Counts *BehindAhead `protobuf:"bytes,3,opt,name=Counts" json:"Counts,omitempty"`
+	// Closed is whether the branch is closed. Only hg has closed
+	// branches (whose heads were all committed with
+	// `hg commit --close-branch`); it is always false for git.
+	Closed bool `protobuf:"varint,5,opt,name=Closed,proto3" json:"Closed,omitempty"`
 }
 
 func (m *Branch) Reset()         { *m = Branch{} }
@@ -121,7 +143,7 @@ func (*Tag) ProtoMessage()    {}
 type SearchOptions struct {
 	// the query string
 	Query string `protobuf:"bytes,1,opt,name=Query,proto3" json:"Query,omitempty"`
-	// currently only FixedQuery ("fixed") is supported
+	// FixedQuery ("fixed") or RegexpQuery ("regexp")
 	QueryType string `protobuf:"bytes,2,opt,name=QueryType,proto3" json:"QueryType,omitempty"`
 	// the number of lines before and after each hit to display
 	ContextLines int32 `protobuf:"varint,3,opt,name=ContextLines,proto3" json:"ContextLines,omitempty"`
@@ -129,6 +151,16 @@ type SearchOptions struct {
 	N int32 `protobuf:"varint,4,opt,name=N,proto3" json:"N,omitempty"`
 	// starting offset for matches (use with N for pagination)
 	Offset int32 `protobuf:"varint,5,opt,name=Offset,proto3" json:"Offset,omitempty"`
+	// the number of files to search in parallel (0 means one per CPU);
+	// only used by implementations that search natively
+	Concurrency int32 `protobuf:"varint,6,opt,name=Concurrency,proto3" json:"Concurrency,omitempty"`
+	// if set, only files whose paths match at least one of these
+	// glob patterns are searched ("**" matches any number of
+	// directories)
+	PathInclude []string `protobuf:"bytes,7,rep,name=PathInclude" json:"PathInclude,omitempty"`
+	// files whose paths match any of these glob patterns are not
+	// searched
+	PathExclude []string `protobuf:"bytes,8,rep,name=PathExclude" json:"PathExclude,omitempty"`
 }
 
 func (m *SearchOptions) Reset()         { *m = SearchOptions{} }
@@ -225,6 +257,35 @@ func (m *Commit) MarshalTo(data []byte) (int, error) {
 			i += copy(data[i:], s)
 		}
 	}
+	if len(m.FirstParent) > 0 {
+		data[i] = 0x32
+		i++
+		i = encodeVarintVcs(data, i, uint64(len(m.FirstParent)))
+		i += copy(data[i:], m.FirstParent)
+	}
+	if len(m.Branch) > 0 {
+		data[i] = 0x3a
+		i++
+		i = encodeVarintVcs(data, i, uint64(len(m.Branch)))
+		i += copy(data[i:], m.Branch)
+	}
+	if len(m.Extra) > 0 {
+		for k := range m.Extra {
+			data[i] = 0x42
+			i++
+			v := m.Extra[k]
+			mapSize := 1 + len(k) + sovVcs(uint64(len(k))) + 1 + len(v) + sovVcs(uint64(len(v)))
+			i = encodeVarintVcs(data, i, uint64(mapSize))
+			data[i] = 0xa
+			i++
+			i = encodeVarintVcs(data, i, uint64(len(k)))
+			i += copy(data[i:], k)
+			data[i] = 0x12
+			i++
+			i = encodeVarintVcs(data, i, uint64(len(v)))
+			i += copy(data[i:], v)
+		}
+	}
 	return i, nil
 }
 
@@ -313,6 +374,16 @@ func (m *Branch) MarshalTo(data []byte) (int, error) {
 		}
 		i += n5
 	}
+	if m.Closed {
+		data[i] = 0x28
+		i++
+		if m.Closed {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -462,6 +533,41 @@ func (m *SearchOptions) MarshalTo(data []byte) (int, error) {
 		i++
 		i = encodeVarintVcs(data, i, uint64(m.Offset))
 	}
+	if m.Concurrency != 0 {
+		data[i] = 0x30
+		i++
+		i = encodeVarintVcs(data, i, uint64(m.Concurrency))
+	}
+	if len(m.PathInclude) > 0 {
+		for _, s := range m.PathInclude {
+			data[i] = 0x3a
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
+	if len(m.PathExclude) > 0 {
+		for _, s := range m.PathExclude {
+			data[i] = 0x42
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
 	return i, nil
 }
 
@@ -602,6 +708,20 @@ func (m *Commit) Size() (n int) {
 			n += 1 + l + sovVcs(uint64(l))
 		}
 	}
+	l = len(m.FirstParent)
+	if l > 0 {
+		n += 1 + l + sovVcs(uint64(l))
+	}
+	l = len(m.Branch)
+	if l > 0 {
+		n += 1 + l + sovVcs(uint64(l))
+	}
+	if len(m.Extra) > 0 {
+		for k, v := range m.Extra {
+			mapEntrySize := 1 + len(k) + sovVcs(uint64(len(k))) + 1 + len(v) + sovVcs(uint64(len(v)))
+			n += mapEntrySize + 1 + sovVcs(uint64(mapEntrySize))
+		}
+	}
 	return n
 }
 
@@ -640,6 +760,9 @@ func (m *Branch) Size() (n int) {
 		l = m.Commit.Size()
 		n += 1 + l + sovVcs(uint64(l))
 	}
+	if m.Closed {
+		n += 2
+	}
 	return n
 }
 
@@ -710,6 +833,21 @@ func (m *SearchOptions) Size() (n int) {
 	if m.Offset != 0 {
 		n += 1 + sovVcs(uint64(m.Offset))
 	}
+	if m.Concurrency != 0 {
+		n += 1 + sovVcs(uint64(m.Concurrency))
+	}
+	if len(m.PathInclude) > 0 {
+		for _, s := range m.PathInclude {
+			l = len(s)
+			n += 1 + l + sovVcs(uint64(l))
+		}
+	}
+	if len(m.PathExclude) > 0 {
+		for _, s := range m.PathExclude {
+			l = len(s)
+			n += 1 + l + sovVcs(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -950,6 +1088,146 @@ func (m *Commit) Unmarshal(data []byte) error {
 			}
 			m.Parents = append(m.Parents, CommitID(data[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FirstParent", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthVcs
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.FirstParent = CommitID(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Branch", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthVcs
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Branch = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Extra", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthVcs
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			var mapkey, mapvalue string
+			for iNdEx < postIndex {
+				var entryWire uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowVcs
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := data[iNdEx]
+					iNdEx++
+					entryWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if entryWire&0x7 != 2 {
+					return fmt.Errorf("proto: wrong wireType = %d for field Extra", entryWire&0x7)
+				}
+				var stringLen uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowVcs
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := data[iNdEx]
+					iNdEx++
+					stringLen |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				intStringLen := int(stringLen)
+				if intStringLen < 0 {
+					return ErrInvalidLengthVcs
+				}
+				postStringIndex := iNdEx + intStringLen
+				if postStringIndex > postIndex {
+					return io.ErrUnexpectedEOF
+				}
+				switch entryWire >> 3 {
+				case 1:
+					mapkey = string(data[iNdEx:postStringIndex])
+				case 2:
+					mapvalue = string(data[iNdEx:postStringIndex])
+				}
+				iNdEx = postStringIndex
+			}
+			if m.Extra == nil {
+				m.Extra = make(map[string]string)
+			}
+			m.Extra[mapkey] = mapvalue
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipVcs(data[iNdEx:])
@@ -1262,6 +1540,26 @@ func (m *Branch) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Closed", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Closed = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipVcs(data[iNdEx:])
@@ -1780,6 +2078,83 @@ func (m *SearchOptions) Unmarshal(data []byte) error {
 					break
 				}
 			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Concurrency", wireType)
+			}
+			m.Concurrency = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Concurrency |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PathInclude", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthVcs
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.PathInclude = append(m.PathInclude, string(data[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PathExclude", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowVcs
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthVcs
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.PathExclude = append(m.PathExclude, string(data[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipVcs(data[iNdEx:])
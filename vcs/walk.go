@@ -0,0 +1,60 @@
+package vcs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/util"
+)
+
+// Walk walks the file tree rooted at root in fs (such as a
+// repository's FileSystem), calling fn for each file or directory in
+// the tree, including root, like filepath.Walk. The files are walked
+// in lexical order, and paths passed to fn are joined with "/". As
+// with filepath.Walk, symlinks are reported with Lstat and not
+// followed, fn may return filepath.SkipDir to skip a directory's
+// contents (or, when called for a file, the remaining files in its
+// directory), and an error reading a directory is passed to fn.
+//
+// Each directory is listed with ReadDir, so the cost depends on fs's
+// implementation; for the native hg FileSystem, which indexes its
+// manifest's directories, each ReadDir is a map lookup.
+func Walk(fs vfs.FileSystem, root string, fn filepath.WalkFunc) error {
+	info, err := fs.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(fs, root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walk recursively descends p, calling fn.
+func walk(fs vfs.FileSystem, p string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(p, info, nil)
+	}
+
+	fis, err := fs.ReadDir(p)
+	err1 := fn(p, info, err)
+	// If err != nil, walk can't descend into this directory. If
+	// err1 != nil, fn doesn't want it to, or wants to stop.
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	util.SortFileInfosByName(fis)
+	for _, fi := range fis {
+		if err := walk(fs, path.Join(p, fi.Name()), fi, fn); err != nil {
+			if !fi.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
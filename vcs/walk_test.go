@@ -0,0 +1,77 @@
+package vcs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/mapfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs"
+)
+
+func TestWalk(t *testing.T) {
+	fs := mapfs.New(map[string]string{
+		"a":       "",
+		"b/c":     "",
+		"b/d/e":   "",
+		"b/d/f/g": "",
+		"h/i":     "",
+	})
+
+	walk := func(root string, skip string) []string {
+		var visited []string
+		err := vcs.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			visited = append(visited, path)
+			if path == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Walk(%q): %s", root, err)
+		}
+		return visited
+	}
+
+	tests := []struct {
+		root, skip string
+		want       []string
+	}{
+		{root: ".", want: []string{".", "a", "b", "b/c", "b/d", "b/d/e", "b/d/f", "b/d/f/g", "h", "h/i"}},
+		{root: "b/d", want: []string{"b/d", "b/d/e", "b/d/f", "b/d/f/g"}},
+		{root: ".", skip: "b/d", want: []string{".", "a", "b", "b/c", "b/d", "h", "h/i"}},
+		{root: ".", skip: "b/c", want: []string{".", "a", "b", "b/c", "h", "h/i"}},
+		{root: "a", want: []string{"a"}},
+	}
+	for _, test := range tests {
+		if got := walk(test.root, test.skip); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Walk(%q) skipping %q: got %v, want %v", test.root, test.skip, got, test.want)
+		}
+	}
+
+	// Errors returned by fn stop the walk.
+	stop := errors.New("stop")
+	var n int
+	err := vcs.Walk(fs, ".", func(path string, info os.FileInfo, err error) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("got error %v after %d calls, want %v after 3", err, n, stop)
+	}
+
+	// An error for the root is passed to fn.
+	err = vcs.Walk(fs, "nonexistent", func(path string, info os.FileInfo, err error) error {
+		return err
+	})
+	if !os.IsNotExist(err) {
+		t.Errorf("nonexistent root: got error %v, want not-exist error", err)
+	}
+}